@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"github.com/MShekow/directory-checksum/directory_checksum"
+	"github.com/spf13/afero"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// stdinRoot is the root argument that makes the tool read a tar archive from stdin, like "docker build -" does.
+const stdinRoot = "-"
+
+// isArchiveRoot returns true if root is not a directory but an archive file (or stdinRoot).
+func isArchiveRoot(root string) bool {
+	if root == stdinRoot {
+		return true
+	}
+	info, err := os.Stat(root)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// scanRoot scans the directory at root or, if root is an archive (see isArchiveRoot) or an image (with --image), the
+// directory at archivePath inside of the archive or the image's root file system. It also returns the scanned
+// directory as fs.FS, from which files such as go.mod can be read.
+func scanRoot(root string, options ...directory_checksum.ScanOption) (*directory_checksum.Directory, fs.FS, error) {
+	var fsys fs.FS
+	switch {
+	case isImage:
+		fsys = readImageRootFSOrExit(root)
+	case isArchiveRoot(root):
+		fsys = readArchiveOrExit(root)
+	default:
+		directory, err := directory_checksum.ScanDirectory(root, afero.NewOsFs(), options...)
+		return directory, os.DirFS(root), err
+	}
+	fsRoot := strings.Trim(path.Clean("/"+archivePath), "/")
+	if fsRoot == "" {
+		fsRoot = "."
+	}
+	directory, err := directory_checksum.ScanFS(fsys, fsRoot, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	scannedFS, err := fs.Sub(fsys, fsRoot)
+	return directory, scannedFS, err
+}
+
+// readImageRootFSOrExit returns the root file system of the image at root, exiting the program if reading it fails.
+func readImageRootFSOrExit(root string) *directory_checksum.ArchiveFS {
+	image, err := directory_checksum.OpenImage(root, directory_checksum.ImageOptions{Reference: imageReference,
+		Platform: imagePlatform})
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to read the image %s", root), err)
+	}
+	defer image.Close()
+	rootFS, err := image.RootFS()
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to apply the layers of the image %s", root), err)
+	}
+	return rootFS
+}
+
+// readArchiveOrExit reads the archive file at root (or the tar archive on stdin, for stdinRoot), exiting the program
+// if this fails.
+func readArchiveOrExit(root string) *directory_checksum.ArchiveFS {
+	f := os.Stdin
+	if root != stdinRoot {
+		var err error
+		if f, err = os.Open(root); err != nil {
+			exitWithError(fmt.Sprintf("Unable to open %s", root), err)
+		}
+		defer f.Close()
+	}
+	archiveFS, err := directory_checksum.ReadArchive(f)
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to read the archive %s", root), err)
+	}
+	return archiveFS
+}
+
+// scannedName returns the name of the scanned directory, which is used in SBOMs: the base name of the directory, of
+// the path inside the archive or image, or of the archive file or image.
+func scannedName(root string) string {
+	if isImage || isArchiveRoot(root) {
+		if name := path.Base(path.Clean("/" + archivePath)); name != "/" {
+			return name
+		}
+	}
+	if absoluteRoot, err := filepath.Abs(root); err == nil {
+		return filepath.Base(absoluteRoot)
+	}
+	return filepath.Base(root)
+}
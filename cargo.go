@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/MShekow/directory-checksum/directory_checksum"
+	"github.com/spf13/afero"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// cargoCrateDirs returns the crate directories that paths refer to: every path that contains a .cargo-checksum.json
+// file is a crate directory, any other path is treated as a vendor directory, whose immediate sub-directories that
+// contain a .cargo-checksum.json file are crate directories.
+func cargoCrateDirs(paths []string) []string {
+	var crateDirs []string
+	for _, p := range paths {
+		if _, err := os.Stat(filepath.Join(p, directory_checksum.CargoChecksumFileName)); err == nil {
+			crateDirs = append(crateDirs, p)
+			continue
+		}
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			exitWithError(fmt.Sprintf("Unable to read %s", p), err)
+		}
+		found := false
+		for _, entry := range entries {
+			crateDir := filepath.Join(p, entry.Name())
+			if _, err = os.Stat(filepath.Join(crateDir, directory_checksum.CargoChecksumFileName)); err == nil {
+				crateDirs = append(crateDirs, crateDir)
+				found = true
+			}
+		}
+		if !found {
+			log.Fatalf("'%s' is neither a vendored crate nor a vendor directory: no %s file was found", p,
+				directory_checksum.CargoChecksumFileName)
+		}
+	}
+	return crateDirs
+}
+
+// readCargoChecksums reads the .cargo-checksum.json file of the crate directory at crateDir, and returns its parsed
+// and its raw content.
+func readCargoChecksums(crateDir string) (*directory_checksum.CargoChecksums, []byte) {
+	checksumPath := filepath.Join(crateDir, directory_checksum.CargoChecksumFileName)
+	data, err := os.ReadFile(checksumPath)
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to read %s", checksumPath), err)
+	}
+	checksums, err := directory_checksum.ReadCargoChecksums(bytes.NewReader(data))
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to read %s", checksumPath), err)
+	}
+	return checksums, data
+}
+
+// scanCargoCrate scans the regular files of the crate directory at crateDir (except for its .cargo-checksum.json file)
+// and computes their SHA-256 checksums.
+func scanCargoCrate(crateDir string) *directory_checksum.Directory {
+	directory, err := directory_checksum.ScanDirectory(crateDir, afero.NewOsFs(),
+		directory_checksum.WithHasher(directory_checksum.SHA256),
+		directory_checksum.WithFilter(directory_checksum.CargoCrateFilter))
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to scan %s", crateDir), err)
+	}
+	directory = directory.RegularFilesOnly()
+	if _, err = directory.ComputeDirectoryChecksums(); err != nil {
+		exitWithError("Unexpected error while computing directory checksums", err)
+	}
+	return directory
+}
+
+// runVerifyCargo implements the "verify-cargo" subcommand, which checks vendored crates against their
+// .cargo-checksum.json files.
+func runVerifyCargo(arguments []string) {
+	flagSet := flag.NewFlagSet("verify-cargo", flag.ExitOnError)
+	flagSet.SetOutput(os.Stdout)
+	flagSet.Usage = func() {
+		fmt.Printf("Usage of Directory Checksum Tool %s:\n\n", version)
+		fmt.Println("directory-checksum verify-cargo <crate-or-vendor-dir>...")
+		fmt.Println("\nChecks the files of vendored crates (as created by 'cargo vendor') against their " +
+			directory_checksum.CargoChecksumFileName + "\nfiles, and reports every file that was modified, is " +
+			"missing ('removed'), or is not listed ('added').\nEach path is either a crate directory, or a vendor " +
+			"directory whose crates are all verified.")
+		flagSet.PrintDefaults()
+		os.Exit(1)
+	}
+	_ = flagSet.Parse(arguments)
+
+	if flagSet.NArg() == 0 {
+		log.Fatal("You must provide at least one argument: the path to a vendored crate or a vendor directory")
+	}
+
+	crateDirs := cargoCrateDirs(flagSet.Args())
+	differenceCount := 0
+	for _, crateDir := range crateDirs {
+		checksums, _ := readCargoChecksums(crateDir)
+		expected, err := checksums.Tree()
+		if err != nil {
+			exitWithError(fmt.Sprintf("Unable to read the checksums of %s", crateDir), err)
+		}
+		for _, difference := range directory_checksum.Compare(expected, scanCargoCrate(crateDir)) {
+			fmt.Printf("%s: %s\n", difference.Kind, filepath.Join(crateDir, filepath.FromSlash(difference.Path)))
+			differenceCount++
+		}
+	}
+	if differenceCount > 0 {
+		fmt.Printf("Verification FAILED: found %d differences\n", differenceCount)
+		os.Exit(1)
+	}
+	fmt.Printf("Verification succeeded: %d crates match their %s files\n", len(crateDirs),
+		directory_checksum.CargoChecksumFileName)
+}
+
+// runUpdateCargoChecksum implements the "update-cargo-checksum" subcommand, which regenerates the
+// .cargo-checksum.json files of vendored crates after they were patched.
+func runUpdateCargoChecksum(arguments []string) {
+	flagSet := flag.NewFlagSet("update-cargo-checksum", flag.ExitOnError)
+	flagSet.SetOutput(os.Stdout)
+	flagSet.Usage = func() {
+		fmt.Printf("Usage of Directory Checksum Tool %s:\n\n", version)
+		fmt.Println("directory-checksum update-cargo-checksum <crate-or-vendor-dir>...")
+		fmt.Println("\nRewrites the " + directory_checksum.CargoChecksumFileName + " files of vendored crates, " +
+			"so that they list the current\nchecksums of all files, e.g. after the crates were patched " +
+			"intentionally. The 'package' checksum\n(of the .crate archive) is kept. Each path is either a crate " +
+			"directory, or a vendor directory whose\ncrates are all updated. Files are only written if their " +
+			"content changes.")
+		flagSet.PrintDefaults()
+		os.Exit(1)
+	}
+	_ = flagSet.Parse(arguments)
+
+	if flagSet.NArg() == 0 {
+		log.Fatal("You must provide at least one argument: the path to a vendored crate or a vendor directory")
+	}
+
+	updated := 0
+	crateDirs := cargoCrateDirs(flagSet.Args())
+	for _, crateDir := range crateDirs {
+		checksumPath := filepath.Join(crateDir, directory_checksum.CargoChecksumFileName)
+		oldChecksums, oldData := readCargoChecksums(crateDir)
+		checksums, err := scanCargoCrate(crateDir).CargoChecksums(oldChecksums.Package)
+		if err != nil {
+			exitWithError(fmt.Sprintf("Unable to compute the checksums of %s", crateDir), err)
+		}
+		data := bytes.Buffer{}
+		if err = checksums.Write(&data); err != nil {
+			exitWithError("Unable to encode the checksums", err)
+		}
+		if bytes.Equal(oldData, data.Bytes()) {
+			continue
+		}
+		if err = os.WriteFile(checksumPath, data.Bytes(), 0644); err != nil {
+			exitWithError(fmt.Sprintf("Unable to write %s", checksumPath), err)
+		}
+		fmt.Printf("Updated %s\n", checksumPath)
+		updated++
+	}
+	fmt.Printf("Updated %d of %d %s files\n", updated, len(crateDirs), directory_checksum.CargoChecksumFileName)
+}
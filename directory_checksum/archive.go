@@ -0,0 +1,536 @@
+package directory_checksum
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"github.com/go-errors/errors"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveMaxSymlinks is the maximum number of symbolic links that are followed when resolving a path, like Linux's
+// limit.
+const archiveMaxSymlinks = 40
+
+// The magic numbers at the start of the archive formats and compressed streams that ReadArchive detects.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	zipMagic  = []byte("PK\x03\x04")
+	// zipEmptyMagic starts the end of central directory record, which is all that an empty zip archive contains
+	zipEmptyMagic = []byte("PK\x05\x06")
+)
+
+// An ArchiveFS is a read-only, in-memory file system with the entries of tar or zip archives, which can be scanned with
+// ScanFS (which yields the same checksums as scanning the extracted tree). It supports symbolic links (see ReadLink
+// and Lstat), and the owner and extended attributes stored in tar headers are part of the scanned Metadata. Hard links
+// become regular files with the content of their target, like when extracting the archive. Directories that are
+// missing from an archive are added implicitly, with mode 0755.
+type ArchiveFS struct {
+	root *archiveEntry
+	// layers is the number of layers applied with ApplyLayer
+	layers int
+}
+
+// archiveEntry is a file, directory or symbolic link of an ArchiveFS. children is only set for directories. layer is
+// the number of the layer that added the entry (see LayerOf).
+type archiveEntry struct {
+	layer      int
+	mode       fs.FileMode
+	uid        int
+	gid        int
+	modTime    time.Time
+	linkTarget string
+	xattrs     map[string]string
+	content    []byte
+	children   map[string]*archiveEntry
+}
+
+// newArchiveDirectory returns the archiveEntry of a directory that is not part of the archive itself.
+func newArchiveDirectory() *archiveEntry {
+	return &archiveEntry{mode: fs.ModeDir | 0755, uid: -1, gid: -1, children: map[string]*archiveEntry{}}
+}
+
+// NewArchiveFS returns an empty ArchiveFS, to which archives can be added with AddTar and AddZip.
+func NewArchiveFS() *ArchiveFS {
+	return &ArchiveFS{root: newArchiveDirectory()}
+}
+
+// ReadArchive returns an ArchiveFS with the entries of the archive read from r, which is a zip archive, or a tar
+// archive that is either uncompressed or compressed with gzip or zstd. The format is detected from the content.
+func ReadArchive(r io.Reader) (*ArchiveFS, error) {
+	a := NewArchiveFS()
+	bufferedReader := bufio.NewReader(r)
+	magic, _ := bufferedReader.Peek(len(zipMagic))
+	if bytes.Equal(magic, zipMagic) || bytes.Equal(magic, zipEmptyMagic) {
+		data, err := io.ReadAll(bufferedReader)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		return a, a.AddZip(bytes.NewReader(data), int64(len(data)))
+	}
+
+	tarReader, err := decompressedReader(bufferedReader)
+	if err != nil {
+		return nil, err
+	}
+	defer tarReader.Close()
+	return a, a.AddTar(tarReader)
+}
+
+// decompressedReader returns a reader of the decompressed content of r, which is compressed with gzip or zstd, or is
+// not compressed at all. The compression is detected from the content.
+func decompressedReader(r *bufio.Reader) (io.ReadCloser, error) {
+	magic, _ := r.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gzipReader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		return gzipReader, nil
+	case bytes.Equal(magic, zstdMagic):
+		zstdReader, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		return zstdReader.IOReadCloser(), nil
+	}
+	return io.NopCloser(r), nil
+}
+
+// AddTar adds the entries of the uncompressed tar archive read from r. Entries replace existing entries with the same
+// path, except that the children of a directory are kept if it is replaced by another directory.
+func (a *ArchiveFS) AddTar(r io.Reader) error {
+	return a.addTar(r, false)
+}
+
+// ApplyLayer applies the uncompressed tar archive read from r as a layer of an OCI image, i.e. like AddTar, but
+// whiteout files are not added: instead, ".wh.<name>" removes the existing entry <name> in the same directory, and
+// ".wh..wh..opq" removes all existing entries of its directory, except for those added by the same layer.
+func (a *ArchiveFS) ApplyLayer(r io.Reader) error {
+	a.layers++
+	return a.addTar(r, true)
+}
+
+// addTar implements AddTar, and ApplyLayer if applyWhiteouts is true.
+func (a *ArchiveFS) addTar(r io.Reader, applyWhiteouts bool) error {
+	// added contains the entries that were added by this tar archive, as well as the existing directories that contain
+	// them, which opaque whiteouts keep
+	added := map[*archiveEntry]bool{}
+	tarReader := tar.NewReader(r)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, 0)
+		}
+		if applyWhiteouts {
+			if isWhiteout := a.applyWhiteout(archivePath(header.Name), added); isWhiteout {
+				continue
+			}
+		}
+		entry, err := a.tarEntry(header, tarReader)
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			entry.layer = a.layers
+			if err := a.add(header.Name, entry, added); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// applyWhiteout applies the whiteout file at name (see ApplyLayer), keeping the entries in added. It returns false if
+// name is not a whiteout file.
+func (a *ArchiveFS) applyWhiteout(name string, added map[*archiveEntry]bool) bool {
+	baseName := path.Base(name)
+	if !strings.HasPrefix(baseName, imageWhiteoutPrefix) {
+		return false
+	}
+	parent := a.existingDirectory(path.Dir(name))
+	if parent == nil {
+		// there is nothing to remove
+		return true
+	}
+	switch {
+	case baseName == imageOpaqueWhiteout:
+		parent.layer = a.layers
+		removeLowerEntries(parent, added, a.layers)
+	case !strings.HasPrefix(baseName, imageWhiteoutMetaPrefix):
+		// other files with the ".wh..wh." prefix are internal files of AUFS, which are skipped
+		childName := strings.TrimPrefix(baseName, imageWhiteoutPrefix)
+		if _, exists := parent.children[childName]; exists {
+			delete(parent.children, childName)
+			parent.layer = a.layers
+		}
+	}
+	return true
+}
+
+// removeLowerEntries removes the entries below the directory dir that are not in added, i.e. that were not added by
+// the current layer. Directories that are in added may still contain such entries, e.g. if the layer re-declares a
+// directory of a lower layer, which keeps its children (see AddTar). Directories whose entries are removed count as
+// written by the provided layer.
+func removeLowerEntries(dir *archiveEntry, added map[*archiveEntry]bool, layer int) {
+	for childName, child := range dir.children {
+		if !added[child] {
+			delete(dir.children, childName)
+			dir.layer = layer
+		} else if child.mode.IsDir() {
+			removeLowerEntries(child, added, layer)
+		}
+	}
+}
+
+// tarEntry returns the archiveEntry of the tar header, whose content is read from r. It returns nil for headers that
+// do not describe an entry, such as PAX global headers.
+func (a *ArchiveFS) tarEntry(header *tar.Header, r io.Reader) (*archiveEntry, error) {
+	switch header.Typeflag {
+	case tar.TypeXGlobalHeader:
+		return nil, nil
+	case tar.TypeLink:
+		target, err := a.lookup("link", archivePath(header.Linkname), false)
+		if err != nil || target.mode.IsDir() {
+			return nil, errors.Errorf("the hard link %s refers to %s, which is not a file in the archive", header.Name,
+				header.Linkname)
+		}
+		hardLink := *target
+		return &hardLink, nil
+	}
+
+	entry := &archiveEntry{mode: header.FileInfo().Mode(), uid: header.Uid, gid: header.Gid, modTime: header.ModTime}
+	switch {
+	case entry.mode.IsDir():
+		entry.children = map[string]*archiveEntry{}
+	case entry.mode&fs.ModeSymlink != 0:
+		entry.linkTarget = header.Linkname
+	case entry.mode.IsRegular():
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		entry.content = content
+	}
+	for key, value := range header.PAXRecords {
+		if name, isXattr := strings.CutPrefix(key, "SCHILY.xattr."); isXattr {
+			if entry.xattrs == nil {
+				entry.xattrs = map[string]string{}
+			}
+			entry.xattrs[name] = value
+		}
+	}
+	return entry, nil
+}
+
+// AddZip adds the entries of the zip archive read from r, which has the provided size. Entries replace existing
+// entries with the same path, like in AddTar. Zip archives do not store owners, so they are unknown.
+func (a *ArchiveFS) AddZip(r io.ReaderAt, size int64) error {
+	zipReader, err := zip.NewReader(r, size)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	for _, file := range zipReader.File {
+		entry := &archiveEntry{mode: file.Mode(), uid: -1, gid: -1, modTime: file.Modified}
+		if strings.HasSuffix(file.Name, "/") {
+			entry.mode |= fs.ModeDir
+		}
+		if entry.mode.IsDir() {
+			entry.children = map[string]*archiveEntry{}
+		} else {
+			content, err := readZipFile(file)
+			if err != nil {
+				return err
+			}
+			// the content of a symbolic link is its target
+			if entry.mode&fs.ModeSymlink != 0 {
+				entry.linkTarget = string(content)
+			} else {
+				entry.content = content
+			}
+		}
+		if err := a.add(file.Name, entry, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readZipFile returns the decompressed content of file.
+func readZipFile(file *zip.File) ([]byte, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return content, nil
+}
+
+// archivePath returns the path of an archive member (e.g. "./a/b/" or "/a/b") in the notation of io/fs (e.g. "a/b").
+// Like when extracting an archive, ".." cannot escape the root.
+func archivePath(name string) string {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// add adds entry at the path of the archive member with the provided name, replacing an existing entry (see AddTar).
+// Missing parent directories are created. If added is not nil, the entry and its parent directories are added to it.
+func (a *ArchiveFS) add(name string, entry *archiveEntry, added map[*archiveEntry]bool) error {
+	if added != nil {
+		added[entry] = true
+	}
+	name = archivePath(name)
+	if name == "." {
+		if !entry.mode.IsDir() {
+			return errors.Errorf("the root of the archive must be a directory, but is %s", entry.mode.Type())
+		}
+		entry.children = a.root.children
+		a.root = entry
+		return nil
+	}
+
+	parent, baseName := a.parentDirectory(name, added)
+	if existing := parent.children[baseName]; existing != nil && existing.mode.IsDir() && entry.mode.IsDir() {
+		entry.children = existing.children
+	}
+	parent.children[baseName] = entry
+	return nil
+}
+
+// parentDirectory returns the parent directory of the entry at name (a path in the notation of io/fs, other than
+// "."), which is created if it is missing, as well as the base name of the entry. Symbolic links are not followed,
+// but replaced by directories, like other entries that are not directories. If added is not nil, all directories
+// along name are added to it.
+func (a *ArchiveFS) parentDirectory(name string, added map[*archiveEntry]bool) (*archiveEntry, string) {
+	parent := a.root
+	components := strings.Split(name, "/")
+	for _, component := range components[:len(components)-1] {
+		child := parent.children[component]
+		if child == nil || !child.mode.IsDir() {
+			child = newArchiveDirectory()
+			child.layer = a.layers
+			parent.children[component] = child
+		}
+		if added != nil {
+			added[child] = true
+		}
+		parent = child
+	}
+	return parent, components[len(components)-1]
+}
+
+// existingDirectory returns the directory at name (a path in the notation of io/fs), or nil if it does not exist.
+// Unlike lookup, it does not follow symbolic links.
+func (a *ArchiveFS) existingDirectory(name string) *archiveEntry {
+	dir := a.root
+	if name == "." {
+		return dir
+	}
+	for _, component := range strings.Split(name, "/") {
+		dir = dir.children[component]
+		if dir == nil || !dir.mode.IsDir() {
+			return nil
+		}
+	}
+	return dir
+}
+
+// lookup returns the entry at name (a path in the notation of io/fs), resolving symbolic links in all but the last
+// component, and in the last component too if followLast is true. op is used in errors.
+func (a *ArchiveFS) lookup(op string, name string, followLast bool) (*archiveEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	var components []string
+	if name != "." {
+		components = strings.Split(name, "/")
+	}
+	entry, resolvedPath, links := a.root, "", 0
+	for i := 0; i < len(components); i++ {
+		if !entry.mode.IsDir() {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		child := entry.children[components[i]]
+		if child == nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if child.mode&fs.ModeSymlink != 0 && (i < len(components)-1 || followLast) {
+			links++
+			if links > archiveMaxSymlinks {
+				return nil, &fs.PathError{Op: op, Path: name, Err: errors.New("too many levels of symbolic links")}
+			}
+			// continue with the target (which is relative to the link's directory, or to the root if it is absolute),
+			// followed by the remaining components
+			target := child.linkTarget
+			if !path.IsAbs(target) {
+				target = path.Join("/", resolvedPath, target)
+			}
+			components = append(strings.Split(archivePath(target), "/"), components[i+1:]...)
+			if components[0] == "." {
+				components = components[1:]
+			}
+			entry, resolvedPath, i = a.root, "", -1
+			continue
+		}
+		entry, resolvedPath = child, path.Join(resolvedPath, components[i])
+	}
+	return entry, nil
+}
+
+// LayerOf returns the number of the layer (counting from 1, in the order of ApplyLayer calls) that last wrote the
+// entry at name, without following a symbolic link in the last component. Missing directories that are created
+// implicitly count as written by the layer that contains their descendants, and directories whose entries are removed
+// by whiteout files count as written by the layer that contains the whiteout files. It returns 0 for entries added by
+// AddTar or AddZip, and for the root directory unless a layer contains or modifies it.
+func (a *ArchiveFS) LayerOf(name string) (int, error) {
+	entry, err := a.lookup("layerof", name, false)
+	if err != nil {
+		return 0, err
+	}
+	return entry.layer, nil
+}
+
+// Open opens the file or directory at name, following symbolic links.
+func (a *ArchiveFS) Open(name string) (fs.File, error) {
+	entry, err := a.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	info := archiveFileInfo{name: path.Base(name), entry: entry}
+	if entry.mode.IsDir() {
+		return &archiveDirectory{archiveFileInfo: info}, nil
+	}
+	return &archiveFile{archiveFileInfo: info, Reader: bytes.NewReader(entry.content)}, nil
+}
+
+// ReadLink returns the target of the symbolic link at name.
+func (a *ArchiveFS) ReadLink(name string) (string, error) {
+	entry, err := a.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if entry.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return entry.linkTarget, nil
+}
+
+// Lstat returns the fs.FileInfo of the file, directory or symbolic link at name, without following a symbolic link
+// in the last component.
+func (a *ArchiveFS) Lstat(name string) (fs.FileInfo, error) {
+	entry, err := a.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return archiveFileInfo{name: path.Base(name), entry: entry}, nil
+}
+
+// archiveFileInfo is the fs.FileInfo of an archiveEntry. Its Sys method returns the archiveEntry, from which
+// metadataFromFileInfo takes the owner.
+type archiveFileInfo struct {
+	name  string
+	entry *archiveEntry
+}
+
+func (i archiveFileInfo) Name() string {
+	return i.name
+}
+
+func (i archiveFileInfo) Size() int64 {
+	return int64(len(i.entry.content))
+}
+
+func (i archiveFileInfo) Mode() fs.FileMode {
+	return i.entry.mode
+}
+
+func (i archiveFileInfo) ModTime() time.Time {
+	return i.entry.modTime
+}
+
+func (i archiveFileInfo) IsDir() bool {
+	return i.entry.mode.IsDir()
+}
+
+func (i archiveFileInfo) Sys() any {
+	return i.entry
+}
+
+// archiveFile is an opened file of an ArchiveFS.
+type archiveFile struct {
+	archiveFileInfo
+	*bytes.Reader
+}
+
+func (f *archiveFile) Stat() (fs.FileInfo, error) {
+	return f.archiveFileInfo, nil
+}
+
+func (f *archiveFile) Close() error {
+	return nil
+}
+
+// archiveDirectory is an opened directory of an ArchiveFS. entries holds the entries that ReadDir has not returned
+// yet, and is populated on the first call.
+type archiveDirectory struct {
+	archiveFileInfo
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *archiveDirectory) Stat() (fs.FileInfo, error) {
+	return d.archiveFileInfo, nil
+}
+
+func (d *archiveDirectory) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *archiveDirectory) Close() error {
+	return nil
+}
+
+// ReadDir returns the next n entries of the directory (or all remaining ones if n <= 0), sorted by name, as specified
+// by fs.ReadDirFile.
+func (d *archiveDirectory) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		for name, child := range d.entry.children {
+			d.entries = append(d.entries, fs.FileInfoToDirEntry(archiveFileInfo{name: name, entry: child}))
+		}
+		sort.Slice(d.entries, func(i, j int) bool {
+			return d.entries[i].Name() < d.entries[j].Name()
+		})
+		d.read = true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,257 @@
+package directory_checksum
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// testTarEntry describes an entry of a tar archive created by newTestTar.
+type testTarEntry struct {
+	name     string
+	typeFlag byte
+	content  string
+	linkname string
+}
+
+// newTestTar returns an uncompressed tar archive with the provided entries, which are owned by 1000:100.
+func newTestTar(t *testing.T, entries ...testTarEntry) []byte {
+	buffer := bytes.Buffer{}
+	tarWriter := tar.NewWriter(&buffer)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Typeflag: entry.typeFlag, Linkname: entry.linkname, Mode: 0644,
+			Uid: 1000, Gid: 100, Size: int64(len(entry.content))}
+		if entry.typeFlag == tar.TypeDir {
+			header.Mode = 0755
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		tarWriter.Write([]byte(entry.content))
+	}
+	tarWriter.Close()
+	return buffer.Bytes()
+}
+
+// testArchiveEntries are the entries of the test archives, whose extracted tree equals newTestArchiveTree.
+var testArchiveEntries = []testTarEntry{
+	{name: "./", typeFlag: tar.TypeDir},
+	{name: "./a/b.txt", typeFlag: tar.TypeReg, content: "foo"},
+	{name: "./a/hard", typeFlag: tar.TypeLink, linkname: "./a/b.txt"},
+	{name: "./c", typeFlag: tar.TypeSymlink, linkname: "a"},
+	{name: "./d/", typeFlag: tar.TypeDir},
+	{name: "/../e.txt", typeFlag: tar.TypeReg, content: "old"},
+	{name: "e.txt", typeFlag: tar.TypeReg, content: "bar"},
+}
+
+// newTestArchiveTree returns the tree that results from extracting testArchiveEntries.
+func newTestArchiveTree() *Directory {
+	d, _ := NewTree(WithHasher(SHA256)).
+		AddFile("a/b.txt", strings.NewReader("foo")).
+		AddFile("a/hard", strings.NewReader("foo")).
+		AddSymlink("c", "a").
+		AddDir("d").
+		AddFile("e.txt", strings.NewReader("bar")).
+		Build()
+	d.ComputeDirectoryChecksums()
+	return d
+}
+
+func TestReadArchive(t *testing.T) {
+	tarArchive := newTestTar(t, testArchiveEntries...)
+	gzipArchive := bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(&gzipArchive)
+	gzipWriter.Write(tarArchive)
+	gzipWriter.Close()
+	zstdArchive := bytes.Buffer{}
+	zstdWriter, _ := zstd.NewWriter(&zstdArchive)
+	zstdWriter.Write(tarArchive)
+	zstdWriter.Close()
+	zipArchive := bytes.Buffer{}
+	zipWriter := zip.NewWriter(&zipArchive)
+	for _, entry := range []testTarEntry{
+		{name: "a/b.txt", content: "foo"},
+		{name: "a/hard", content: "foo"},
+		{name: "c", typeFlag: tar.TypeSymlink, content: "a"},
+		{name: "d/"},
+		{name: "e.txt", content: "bar"},
+	} {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		if entry.typeFlag == tar.TypeSymlink {
+			header.SetMode(fs.ModeSymlink | 0777)
+		}
+		w, _ := zipWriter.CreateHeader(header)
+		w.Write([]byte(entry.content))
+	}
+	zipWriter.Close()
+
+	want := newTestArchiveTree()
+	for name, archive := range map[string][]byte{
+		"tar":    tarArchive,
+		"tar.gz": gzipArchive.Bytes(),
+		"tar.zs": zstdArchive.Bytes(),
+		"zip":    zipArchive.Bytes(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			archiveFS, err := ReadArchive(bytes.NewReader(archive))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			got, err := ScanFS(archiveFS, ".", WithHasher(SHA256))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			got.ComputeDirectoryChecksums()
+			if differences := Compare(want, got); len(differences) > 0 {
+				t.Fatalf("Got differences %v", differences)
+			}
+		})
+	}
+}
+
+func TestArchiveFSMetadata(t *testing.T) {
+	archive := newTestTar(t, testArchiveEntries...)
+	archiveFS, _ := ReadArchive(bytes.NewReader(archive))
+	d, err := ScanFS(archiveFS, "a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if metadata := d.Metadata(); metadata.Mode != fs.ModeDir|0755 || metadata.UID != -1 || metadata.GID != -1 {
+		t.Fatalf("Got metadata %+v of the implicit directory", metadata)
+	}
+	hardLink, _ := d.Lookup("hard")
+	if metadata := hardLink.(*File).Metadata(); metadata.Mode != 0644 || metadata.Size != 3 || metadata.UID != 1000 ||
+		metadata.GID != 100 {
+		t.Fatalf("Got metadata %+v of the hard link", metadata)
+	}
+}
+
+func TestArchiveFSExtendedAttributes(t *testing.T) {
+	buffer := bytes.Buffer{}
+	tarWriter := tar.NewWriter(&buffer)
+	tarWriter.WriteHeader(&tar.Header{Name: "f", Typeflag: tar.TypeReg, Mode: 0644, Format: tar.FormatPAX,
+		PAXRecords: map[string]string{"SCHILY.xattr.user.foo": "bar", "comment": "ignored"}})
+	tarWriter.Close()
+	archiveFS, _ := ReadArchive(&buffer)
+
+	for _, scanOptions := range [][]ScanOption{nil, {WithExtendedAttributes()}} {
+		d, _ := ScanFS(archiveFS, ".", scanOptions...)
+		file, _ := d.Lookup("f")
+		xattrs := file.(*File).Metadata().Xattrs
+		if scanOptions == nil && xattrs != nil || scanOptions != nil && xattrs["user.foo"] != "bar" {
+			t.Fatalf("Got extended attributes %v with %d options", xattrs, len(scanOptions))
+		}
+	}
+}
+
+func TestArchiveFSReplacesEntries(t *testing.T) {
+	archiveFS := NewArchiveFS()
+	layers := [][]testTarEntry{
+		{{name: "d/f", typeFlag: tar.TypeReg, content: "1"}, {name: "x/y", typeFlag: tar.TypeReg, content: "2"}},
+		{{name: "d/", typeFlag: tar.TypeDir}, {name: "x", typeFlag: tar.TypeSymlink, linkname: "d"}},
+	}
+	for _, layer := range layers {
+		if err := archiveFS.AddTar(bytes.NewReader(newTestTar(t, layer...))); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// replacing a directory by a directory keeps its children, other entries are replaced
+	if err := fstest.TestFS(archiveFS, "d/f", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat(archiveFS, "x/y"); err == nil {
+		t.Fatal("Expected error for the replaced directory but did not get any")
+	}
+	if content, err := fs.ReadFile(archiveFS, "x/f"); err != nil || string(content) != "1" {
+		t.Fatalf("Got content %q and error %v via the symbolic link", content, err)
+	}
+	if target, err := archiveFS.ReadLink("x"); err != nil || target != "d" {
+		t.Fatalf("Got target %q and error %v", target, err)
+	}
+}
+
+func TestArchiveFSOpaqueWhiteout(t *testing.T) {
+	lowerLayer := []testTarEntry{
+		{name: "a/sub/old", typeFlag: tar.TypeReg, content: "old"},
+		{name: "a/other/old", typeFlag: tar.TypeReg, content: "old"},
+	}
+	// the position of the opaque whiteout in the layer does not matter, and it also removes the lower entries of
+	// directories that the layer re-declares, explicitly or implicitly
+	for name, upperLayer := range map[string][]testTarEntry{
+		"whiteout last": {
+			{name: "a/", typeFlag: tar.TypeDir},
+			{name: "a/sub/", typeFlag: tar.TypeDir},
+			{name: "a/sub/new", typeFlag: tar.TypeReg, content: "new"},
+			{name: "a/.wh..wh..opq", typeFlag: tar.TypeReg},
+		},
+		"whiteout first": {
+			{name: "a/.wh..wh..opq", typeFlag: tar.TypeReg},
+			{name: "a/", typeFlag: tar.TypeDir},
+			{name: "a/sub/", typeFlag: tar.TypeDir},
+			{name: "a/sub/new", typeFlag: tar.TypeReg, content: "new"},
+		},
+		"implicit directories": {
+			{name: "a/sub/new", typeFlag: tar.TypeReg, content: "new"},
+			{name: "a/.wh..wh..opq", typeFlag: tar.TypeReg},
+		},
+	} {
+		archiveFS := NewArchiveFS()
+		for _, layer := range [][]testTarEntry{lowerLayer, upperLayer} {
+			if err := archiveFS.ApplyLayer(bytes.NewReader(newTestTar(t, layer...))); err != nil {
+				t.Fatalf("Unexpected error for %s: %v", name, err)
+			}
+		}
+		if err := fstest.TestFS(archiveFS, "a/sub/new"); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, removed := range []string{"a/sub/old", "a/other"} {
+			if _, err := fs.Stat(archiveFS, removed); err == nil {
+				t.Fatalf("Expected error for the removed entry %s with %s but did not get any", removed, name)
+			}
+		}
+		if layer, err := archiveFS.LayerOf("a/sub/new"); err != nil || layer != 2 {
+			t.Fatalf("Got layer %d and error %v for %s", layer, err, name)
+		}
+	}
+}
+
+func TestArchiveFSWhiteoutOfMissingEntry(t *testing.T) {
+	archiveFS := NewArchiveFS()
+	layer := newTestTar(t,
+		testTarEntry{name: "missing/.wh.f", typeFlag: tar.TypeReg},
+		testTarEntry{name: "gone/.wh..wh..opq", typeFlag: tar.TypeReg},
+		testTarEntry{name: "f", typeFlag: tar.TypeReg, content: "f"})
+	if err := archiveFS.ApplyLayer(bytes.NewReader(layer)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// whiteout files do not create the directories that contain them
+	entries, err := fs.ReadDir(archiveFS, ".")
+	if err != nil || len(entries) != 1 || entries[0].Name() != "f" {
+		t.Fatalf("Got entries %v and error %v", entries, err)
+	}
+}
+
+func TestArchiveFSErrors(t *testing.T) {
+	for name, archive := range map[string][]byte{
+		"missing hard link target": newTestTar(t, testTarEntry{name: "l", typeFlag: tar.TypeLink, linkname: "f"}),
+		"root is not a directory":  newTestTar(t, testTarEntry{name: ".", typeFlag: tar.TypeReg}),
+		"not an archive":           []byte(strings.Repeat("no tar", 100)),
+	} {
+		if _, err := ReadArchive(bytes.NewReader(archive)); err == nil {
+			t.Fatalf("Expected error for %s but did not get any", name)
+		}
+	}
+
+	archiveFS, _ := ReadArchive(bytes.NewReader(newTestTar(t,
+		testTarEntry{name: "loop", typeFlag: tar.TypeSymlink, linkname: "loop"})))
+	if _, err := archiveFS.Open("loop"); err == nil {
+		t.Fatal("Expected error for a symbolic link loop but did not get any")
+	}
+}
@@ -0,0 +1,144 @@
+package directory_checksum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/go-errors/errors"
+	"hash"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// buildKitEmptyDigest is the digest of empty content, which BuildKit uses as the header digest of the build context's
+// root directory, and as the checksum of sources that match no files.
+const buildKitEmptyDigest = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// BuildKitScheme computes the checksums that BuildKit's content hash cache computes for the files of a local build
+// context (see BuildKitChecksum for the checksums of COPY and ADD sources). The checksum of a file or symbolic link is
+// the SHA-256 hash of its tar header fields (see buildKitHeader), followed by the content of regular files. The
+// checksum of a directory is the hash of its header checksum and the names and checksums of its children. Use it with
+// the SHA256 algorithm.
+//
+// The directory on which ComputeDirectoryChecksums is called is treated as the root of the build context, whose header
+// checksum is that of empty content, like in BuildKit. The owner is always 0:0, because the Docker and BuildKit clients
+// reset it when they transfer a build context. Hard links are treated like regular files, which yields the same
+// checksums as in BuildKit. Extended attributes are only read on Linux and macOS.
+var BuildKitScheme = Scheme{
+	Name:          "buildkit",
+	newFileHasher: newBuildKitFileHasher,
+	directoryChecksum: func(d *Directory) (string, error) {
+		if d.options.hasher.Name != SHA256.Name {
+			return "", errors.Errorf("the %s scheme requires the %s algorithm", d.options.scheme.Name, SHA256.Name)
+		}
+		buildKitDirectoryDigest(d, buildKitEmptyDigest)
+		return d.checksum, nil
+	},
+	readsExtendedAttributes: true,
+}
+
+// FormatBuildKitDigest returns the BuildKitScheme checksum (in hexadecimal notation) in the notation that BuildKit
+// uses, e.g. "sha256:e3b0c442...".
+func FormatBuildKitDigest(checksum string) string {
+	return "sha256:" + checksum
+}
+
+// buildKitHeader returns the tar header fields of a file or directory with the provided Metadata, as hashed by
+// BuildKit: the fields of the "tarsum v1" format (which excludes the modification time) of a tar header without
+// name, followed by the extended attributes (sorted by name), except for those in the "security." and "system."
+// namespaces (other than "security.capability"). Each field is written as its name, directly followed by its value.
+func buildKitHeader(metadata Metadata) []byte {
+	typeFlag, size, linkTarget := "0", metadata.Size, ""
+	mode := unixPermissions(metadata.Mode)
+	switch {
+	case metadata.Mode.IsDir():
+		typeFlag, size = "5", 0
+	case metadata.Mode&fs.ModeSymlink != 0:
+		typeFlag, size, linkTarget = "2", 0, metadata.LinkTarget
+		mode |= 0777
+	}
+
+	var header strings.Builder
+	for _, field := range [][2]string{
+		{"name", ""},
+		{"mode", strconv.FormatUint(uint64(mode), 10)},
+		{"uid", "0"},
+		{"gid", "0"},
+		{"size", strconv.FormatInt(size, 10)},
+		{"typeflag", typeFlag},
+		{"linkname", linkTarget},
+		{"uname", ""},
+		{"gname", ""},
+		{"devmajor", "0"},
+		{"devminor", "0"},
+	} {
+		header.WriteString(field[0] + field[1])
+	}
+	for _, name := range sortedKeys(metadata.Xattrs) {
+		if name == "security.capability" ||
+			!strings.HasPrefix(name, "security.") && !strings.HasPrefix(name, "system.") {
+			header.WriteString(name + metadata.Xattrs[name])
+		}
+	}
+	return []byte(header.String())
+}
+
+// buildKitFileHasher is a hash.Hash that computes the BuildKitScheme checksum of a file or symbolic link. It hashes
+// the header, followed by the written content. The content written for symbolic links (i.e. their target) is ignored,
+// because the target is part of the header.
+type buildKitFileHasher struct {
+	hash.Hash
+	header         []byte
+	isSymbolicLink bool
+}
+
+// newBuildKitFileHasher returns a buildKitFileHasher for a file with the provided Metadata.
+func newBuildKitFileHasher(_ HashAlgorithm, metadata Metadata, _ int64) hash.Hash {
+	hasher := &buildKitFileHasher{
+		Hash:           sha256.New(),
+		header:         buildKitHeader(metadata),
+		isSymbolicLink: metadata.Mode&fs.ModeSymlink != 0,
+	}
+	hasher.Reset()
+	return hasher
+}
+
+func (h *buildKitFileHasher) Write(p []byte) (int, error) {
+	if h.isSymbolicLink {
+		return len(p), nil
+	}
+	return h.Hash.Write(p)
+}
+
+func (h *buildKitFileHasher) Reset() {
+	h.Hash.Reset()
+	h.Hash.Write(h.header)
+}
+
+// buildKitHeaderDigest returns the BuildKit digest of the header of a directory with the provided Metadata.
+func buildKitHeaderDigest(metadata Metadata) string {
+	digest := sha256.Sum256(buildKitHeader(metadata))
+	return FormatBuildKitDigest(hex.EncodeToString(digest[:]))
+}
+
+// buildKitDirectoryDigest sets the BuildKitScheme checksums of d and all directories below it, and returns the
+// BuildKit digest of d, whose header has the provided digest. The checksum is the hash of a NUL byte and the header
+// digest, followed by a NUL byte, the name and the digest of each child, sorted by name. Symbolic links are not
+// followed.
+func buildKitDirectoryDigest(d *Directory, headerDigest string) string {
+	digests := map[string]string{}
+	for name, subDir := range d.Dirs() {
+		digests[name] = buildKitDirectoryDigest(subDir, buildKitHeaderDigest(subDir.metadata))
+	}
+	for name, file := range d.Files() {
+		digests[name] = FormatBuildKitDigest(file.checksum)
+	}
+
+	hasher := sha256.New()
+	hasher.Write([]byte("\x00" + headerDigest))
+	for _, name := range sortedKeys(digests) {
+		hasher.Write([]byte("\x00" + name + digests[name]))
+	}
+	d.checksum = hex.EncodeToString(hasher.Sum(nil))
+	return FormatBuildKitDigest(d.checksum)
+}
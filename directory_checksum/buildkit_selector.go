@@ -0,0 +1,599 @@
+package directory_checksum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/go-errors/errors"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// buildKitMaxSymlinks is the maximum number of symbolic links that BuildKit follows when it resolves a path.
+const buildKitMaxSymlinks = 255
+
+// buildKitRecordType is the type of a buildKitRecord.
+type buildKitRecordType int
+
+const (
+	buildKitRecordFile buildKitRecordType = iota
+	// buildKitRecordDir is the record of a directory's content, whose digest is the BuildKitScheme checksum.
+	buildKitRecordDir
+	// buildKitRecordDirHeader is the record of a directory's metadata, which is stored under the directory's key,
+	// followed by a NUL byte.
+	buildKitRecordDirHeader
+	buildKitRecordSymlink
+)
+
+// buildKitRecord is an entry of BuildKit's content hash cache.
+type buildKitRecord struct {
+	recordType buildKitRecordType
+	digest     string
+	linkTarget string
+}
+
+// buildKitIndex contains the records of all files and directories of a build context, keyed like in BuildKit's content
+// hash cache: by their absolute, slash-separated path, in which all slashes are replaced with NUL bytes. Iterating over
+// the sorted keys visits every directory's record, then its header and then its children (sorted by name).
+type buildKitIndex struct {
+	records map[string]*buildKitRecord
+	keys    []string
+}
+
+// buildKitIncludedPath is a path that matched the source path and patterns of a BuildKit selector (or a directory
+// header that is tracked, because a child might match).
+type buildKitIncludedPath struct {
+	path             string
+	record           *buildKitRecord
+	included         bool
+	includeMatchInfo []bool
+	excludeMatchInfo []bool
+}
+
+// BuildKitChecksum returns the checksum (e.g. "sha256:e3b0c442...") that BuildKit computes for a source of a COPY or
+// ADD instruction of a Dockerfile, which is part of the instruction's cache key. d must be the root of the build
+// context, scanned with BuildKitScheme, and its checksums must have been computed with ComputeDirectoryChecksums.
+// sourcePath is relative to the root of the build context, and may contain wildcards (see path.Match). The patterns
+// are those of the --parents and --exclude options, which use the syntax of .dockerignore files. Like in Dockerfile
+// instructions, symbolic links are followed (but not inside of directories).
+func (d *Directory) BuildKitChecksum(sourcePath string, includePatterns, excludePatterns []string) (string, error) {
+	if d.options.scheme.Name != BuildKitScheme.Name || d.checksum == "" {
+		return "", errors.Errorf("unable to compute BuildKit checksum: the tree must be scanned with the %s scheme "+
+			"and its directory checksums must be computed", BuildKitScheme.Name)
+	}
+	index := newBuildKitIndex(d)
+	p := path.Join("/", filepath.ToSlash(sourcePath))
+	wildcard := buildKitContainsWildcards(p)
+	if !wildcard && len(includePatterns) == 0 && len(excludePatterns) == 0 {
+		return index.checksum(p)
+	}
+
+	includedPaths, err := index.includedPaths(p, wildcard, includePatterns, excludePatterns)
+	if err != nil {
+		return "", err
+	}
+	for _, includedPath := range includedPaths {
+		if includedPath.record.recordType == buildKitRecordSymlink {
+			digest, err := index.checksum(includedPath.path)
+			if err != nil {
+				return "", err
+			}
+			includedPath.record = &buildKitRecord{digest: digest}
+		}
+	}
+	if len(includedPaths) == 0 {
+		return buildKitEmptyDigest, nil
+	}
+	if len(includedPaths) == 1 && path.Base(p) == path.Base(includedPaths[0].path) {
+		return includedPaths[0].record.digest, nil
+	}
+
+	hasher := sha256.New()
+	for i, includedPath := range includedPaths {
+		if i != 0 {
+			hasher.Write([]byte{0})
+		}
+		hasher.Write([]byte(path.Base(includedPath.path) + includedPath.record.digest))
+	}
+	return FormatBuildKitDigest(hex.EncodeToString(hasher.Sum(nil))), nil
+}
+
+// newBuildKitIndex returns the buildKitIndex of the build context d, whose BuildKitScheme checksums must have been
+// computed.
+func newBuildKitIndex(d *Directory) *buildKitIndex {
+	index := &buildKitIndex{records: map[string]*buildKitRecord{}}
+	for relativePath, entry := range d.PreOrder() {
+		key := buildKitKey(buildKitPath(relativePath))
+		switch entry.Type() {
+		case TypeDir:
+			headerDigest := buildKitEmptyDigest
+			if key != "" {
+				headerDigest = buildKitHeaderDigest(entry.(*Directory).metadata)
+			}
+			index.records[key] = &buildKitRecord{recordType: buildKitRecordDir,
+				digest: FormatBuildKitDigest(entry.Checksum())}
+			index.records[key+"\x00"] = &buildKitRecord{recordType: buildKitRecordDirHeader, digest: headerDigest}
+		case TypeSymlink:
+			index.records[key] = &buildKitRecord{recordType: buildKitRecordSymlink,
+				digest: FormatBuildKitDigest(entry.Checksum()), linkTarget: entry.(*File).metadata.LinkTarget}
+		default:
+			index.records[key] = &buildKitRecord{recordType: buildKitRecordFile,
+				digest: FormatBuildKitDigest(entry.Checksum())}
+		}
+	}
+	index.keys = sortedKeys(index.records)
+	return index
+}
+
+// buildKitPath returns the path that BuildKit uses for the path p (relative to the build context root, or absolute):
+// the clean, absolute, slash-separated path, except for the root, whose path is empty.
+func buildKitPath(p string) string {
+	p = path.Join("/", filepath.ToSlash(p))
+	if p == "/" {
+		return ""
+	}
+	return p
+}
+
+// buildKitKey returns the key of the record of the provided (slash-separated) path.
+func buildKitKey(p string) string {
+	return strings.ReplaceAll(p, "/", "\x00")
+}
+
+// buildKitKeyPath returns the path of the record with the provided key.
+func buildKitKeyPath(key string) string {
+	return strings.ReplaceAll(key, "\x00", "/")
+}
+
+// checksum returns the digest of the record at path p, following symbolic links (including in the last component).
+func (index *buildKitIndex) checksum(p string) (string, error) {
+	_, record, err := index.followLinks(buildKitKey(buildKitPath(p)), true)
+	if err != nil {
+		return "", err
+	}
+	if record == nil {
+		return "", errors.Errorf("unable to compute BuildKit checksum: '%s' not found", p)
+	}
+	return record.digest, nil
+}
+
+// followLinks looks up the record with the provided key, resolving all symbolic links in its path. Like in BuildKit,
+// a symbolic link in the last component is only resolved if followTrailing is true, and paths are resolved lexically
+// within the build context (i.e. ".." in the root, and absolute link targets, refer to the build context's root). It
+// returns the key of the resolved path, and its record, which is nil if no such path exists.
+func (index *buildKitIndex) followLinks(key string, followTrailing bool) (string, *buildKitRecord, error) {
+	record, ok := index.records[key]
+	if ok && (!followTrailing || record.recordType != buildKitRecordSymlink) {
+		return key, record, nil
+	}
+	if key == "" {
+		return key, nil, nil
+	}
+
+	currentPath, remainingPath := "/", buildKitKeyPath(key)
+	remainingPath, hadTrailingSlash := strings.CutSuffix(remainingPath, "/")
+	linksWalked := 0
+	for remainingPath != "" {
+		var part string
+		if i := strings.IndexRune(remainingPath, '/'); i == -1 {
+			part, remainingPath = remainingPath, ""
+		} else {
+			part, remainingPath = remainingPath[:i], remainingPath[i+1:]
+		}
+
+		nextPath := buildKitPath(path.Join("/", currentPath, part))
+		record, ok = index.records[buildKitKey(nextPath)]
+		if !ok || record.recordType != buildKitRecordSymlink || !followTrailing && remainingPath == "" {
+			currentPath = nextPath
+			continue
+		}
+
+		linksWalked++
+		if linksWalked > buildKitMaxSymlinks {
+			return "", nil, errors.Errorf("unable to resolve '%s': too many symbolic links", buildKitKeyPath(key))
+		}
+		linkTarget := filepath.ToSlash(record.linkTarget)
+		remainingPath = linkTarget + "/" + remainingPath
+		if path.IsAbs(linkTarget) {
+			currentPath = "/"
+		}
+	}
+	if hadTrailingSlash {
+		currentPath += "/"
+		record = index.records[buildKitKey(currentPath)]
+	}
+	return buildKitKey(currentPath), record, nil
+}
+
+// includedPaths returns the files, symbolic links and directory headers that BuildKit includes in the checksum of the
+// source path p (see BuildKitChecksum), which is interpreted as a pattern if wildcard is true. Directories themselves
+// are never included, but their headers are, if the directory or anything below it matches.
+func (index *buildKitIndex) includedPaths(p string, wildcard bool, includePatterns,
+	excludePatterns []string) ([]*buildKitIncludedPath, error) {
+	endsInSeparator := strings.HasSuffix(p, "/")
+	p = buildKitPath(p)
+
+	var includeMatcher, excludeMatcher *buildKitPatternMatcher
+	var err error
+	if len(includePatterns) != 0 {
+		if includeMatcher, err = newBuildKitPatternMatcher(includePatterns); err != nil {
+			return nil, errors.Errorf("invalid include patterns %v: %v", includePatterns, err)
+		}
+	}
+	if len(excludePatterns) != 0 {
+		if excludeMatcher, err = newBuildKitPatternMatcher(excludePatterns); err != nil {
+			return nil, errors.Errorf("invalid exclude patterns %v: %v", excludePatterns, err)
+		}
+	}
+
+	var (
+		key, originalPrefix, resolvedPrefix string
+		keyOk                               bool
+		position                            int
+	)
+	if wildcard {
+		originalPrefix, key, keyOk, err = index.wildcardPrefix(p)
+	} else {
+		// Like in BuildKit, symbolic links in the path are resolved, but not in its last component
+		var record *buildKitRecord
+		originalPrefix = p
+		key, record, err = index.followLinks(buildKitKey(originalPrefix), false)
+		keyOk = record != nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	next := func() (string, bool) {
+		if position >= len(index.keys) {
+			return "", false
+		}
+		position++
+		return index.keys[position-1], true
+	}
+	if originalPrefix != "" {
+		if keyOk {
+			position = sort.SearchStrings(index.keys, key+"\x00")
+		}
+		resolvedPrefix = buildKitKeyPath(key)
+	} else {
+		key, keyOk = next()
+	}
+
+	var (
+		includedPaths    []*buildKitIncludedPath
+		parentDirHeaders []*buildKitIncludedPath
+		lastMatchedDir   string
+	)
+	for ; keyOk; key, keyOk = next() {
+		fileName := buildKitKeyPath(key)
+		// Translate the path below the resolved prefix into a path below the prefix as specified, for pattern matching
+		if strings.HasPrefix(fileName, resolvedPrefix) {
+			fileName = originalPrefix + strings.TrimPrefix(fileName, resolvedPrefix)
+		}
+
+		var parentDir *buildKitIncludedPath
+		for len(parentDirHeaders) != 0 {
+			if parentDir = parentDirHeaders[len(parentDirHeaders)-1]; strings.HasPrefix(fileName, parentDir.path+"/") {
+				break
+			}
+			parentDirHeaders, parentDir = parentDirHeaders[:len(parentDirHeaders)-1], nil
+		}
+
+		isDirHeader := strings.HasSuffix(key, "\x00")
+		if isDirHeader {
+			fileName = fileName[:len(fileName)-1]
+			if fileName == p && endsInSeparator {
+				// The header of a source directory that ends with a separator is not included
+				continue
+			}
+		}
+
+		candidate := &buildKitIncludedPath{path: fileName}
+		var shouldInclude bool
+		if wildcard {
+			if p != "" && (lastMatchedDir == "" || !strings.HasPrefix(fileName, lastMatchedDir+"/")) {
+				matches, err := path.Match(p, fileName)
+				if err != nil {
+					return nil, errors.Wrap(err, 0)
+				}
+				if !matches {
+					continue
+				}
+				lastMatchedDir = fileName
+			}
+			shouldInclude, err = candidate.matches(
+				strings.TrimSuffix(strings.TrimPrefix(fileName+"/", lastMatchedDir+"/"), "/"),
+				includeMatcher, excludeMatcher, parentDir)
+		} else {
+			if !strings.HasPrefix(fileName+"/", p+"/") {
+				break
+			}
+			shouldInclude, err = candidate.matches(strings.TrimSuffix(strings.TrimPrefix(fileName+"/", p+"/"), "/"),
+				includeMatcher, excludeMatcher, parentDir)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !shouldInclude && !isDirHeader {
+			continue
+		}
+
+		record := index.records[key]
+		candidate.record = record
+		if record.recordType == buildKitRecordDir {
+			// Only the headers of directories are included, because files below them might be excluded
+			shouldInclude = false
+		}
+		if shouldInclude {
+			for _, parentDirHeader := range parentDirHeaders {
+				if !parentDirHeader.included {
+					includedPaths = append(includedPaths, parentDirHeader)
+					parentDirHeader.included = true
+				}
+			}
+			includedPaths = append(includedPaths, candidate)
+			candidate.included = true
+		}
+		if record.recordType == buildKitRecordDirHeader {
+			// Directory headers are tracked even if they are not included, in case a child is included
+			parentDirHeaders = append(parentDirHeaders, candidate)
+		}
+	}
+	return includedPaths, nil
+}
+
+// matches returns true if the candidate path (relative to the source path) matches the include patterns (if any) and
+// does not match the exclude patterns. The match results are stored in includedPath, because the children of
+// directories are matched using the results of their parent directory.
+func (includedPath *buildKitIncludedPath) matches(candidate string, includeMatcher,
+	excludeMatcher *buildKitPatternMatcher, parentDir *buildKitIncludedPath) (bool, error) {
+	var parentIncludeMatchInfo, parentExcludeMatchInfo []bool
+	if parentDir != nil {
+		parentIncludeMatchInfo, parentExcludeMatchInfo = parentDir.includeMatchInfo, parentDir.excludeMatchInfo
+	}
+	if includeMatcher != nil {
+		matches, matchInfo, err := includeMatcher.matchesUsingParentResults(candidate, parentIncludeMatchInfo)
+		if err != nil {
+			return false, err
+		}
+		includedPath.includeMatchInfo = matchInfo
+		if !matches {
+			return false, nil
+		}
+	}
+	if excludeMatcher != nil {
+		matches, matchInfo, err := excludeMatcher.matchesUsingParentResults(candidate, parentExcludeMatchInfo)
+		if err != nil {
+			return false, err
+		}
+		includedPath.excludeMatchInfo = matchInfo
+		if matches {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// wildcardPrefix splits the source path p into the prefix without wildcards and the rest, and resolves the symbolic
+// links in the prefix (including its last component, if there is a rest). It returns the prefix (which is empty if it
+// is the root), the key of the resolved prefix, and whether it exists.
+func (index *buildKitIndex) wildcardPrefix(p string) (string, string, bool, error) {
+	prefix, rest := buildKitSplitWildcards(p)
+	if prefix == "/" {
+		return "", "", false, nil
+	}
+	key, record, err := index.followLinks(buildKitKey(prefix), rest != "")
+	if err != nil {
+		return "", "", false, err
+	}
+	return prefix, key, record != nil, nil
+}
+
+// buildKitSplitWildcards splits p into the components before the first component that contains wildcards, and the
+// remaining components.
+func buildKitSplitWildcards(p string) (string, string) {
+	var prefixParts, restParts []string
+	found := false
+	for _, part := range strings.Split(path.Join(p), "/") {
+		if !found && buildKitContainsWildcards(part) {
+			found = true
+		}
+		if part == "" {
+			part = "/"
+		}
+		if found {
+			restParts = append(restParts, part)
+		} else {
+			prefixParts = append(prefixParts, part)
+		}
+	}
+	return path.Join(prefixParts...), path.Join(restParts...)
+}
+
+// buildKitContainsWildcards returns true if name contains unescaped wildcards of path.Match.
+func buildKitContainsWildcards(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' {
+			i++
+		} else if name[i] == '*' || name[i] == '?' || name[i] == '[' {
+			return true
+		}
+	}
+	return false
+}
+
+// buildKitPatternMatcher matches slash-separated paths against patterns in the syntax of .dockerignore files, where
+// "**" matches any number of directories, and patterns starting with "!" are exceptions. It implements the matching
+// rules of the patternmatcher module that BuildKit uses.
+type buildKitPatternMatcher struct {
+	patterns []*buildKitPattern
+}
+
+// buildKitMatchType is the way in which a buildKitPattern is matched.
+type buildKitMatchType int
+
+const (
+	buildKitExactMatch buildKitMatchType = iota
+	// buildKitPrefixMatch is used for patterns without other wildcards that end with "**"
+	buildKitPrefixMatch
+	// buildKitSuffixMatch is used for patterns without other wildcards that start with "**"
+	buildKitSuffixMatch
+	buildKitRegexpMatch
+)
+
+// buildKitPattern is a compiled pattern of a buildKitPatternMatcher.
+type buildKitPattern struct {
+	cleanedPattern string
+	isExclusion    bool
+	matchType      buildKitMatchType
+	regexp         *regexp.Regexp
+}
+
+// newBuildKitPatternMatcher returns a buildKitPatternMatcher for the provided patterns. Empty patterns are ignored.
+func newBuildKitPatternMatcher(patterns []string) (*buildKitPatternMatcher, error) {
+	matcher := &buildKitPatternMatcher{}
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		p = path.Clean(p)
+		pattern := &buildKitPattern{}
+		if p[0] == '!' {
+			if len(p) == 1 {
+				return nil, errors.New("illegal exclusion pattern: \"!\"")
+			}
+			pattern.isExclusion = true
+			p = p[1:]
+		}
+		if _, err := path.Match(p, "."); err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		pattern.cleanedPattern = p
+		if err := pattern.compile(); err != nil {
+			return nil, err
+		}
+		matcher.patterns = append(matcher.patterns, pattern)
+	}
+	return matcher, nil
+}
+
+// compile determines the matchType of the pattern, and compiles the regular expression, if one is needed.
+func (p *buildKitPattern) compile() error {
+	expression := "^"
+	p.matchType = buildKitExactMatch
+	pattern := []rune(p.cleanedPattern)
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			isLeading := i == 0
+			i++
+			// "**/" is treated like "**"
+			if i+1 < len(pattern) && pattern[i+1] == '/' {
+				i++
+			}
+			if i+1 == len(pattern) {
+				// A trailing "**" matches everything, like in .gitignore
+				if p.matchType == buildKitExactMatch {
+					p.matchType = buildKitPrefixMatch
+				} else {
+					expression += ".*"
+					p.matchType = buildKitRegexpMatch
+				}
+			} else {
+				// "**" matches any number of directories, including none
+				expression += "(.*/)?"
+				p.matchType = buildKitRegexpMatch
+			}
+			if isLeading {
+				p.matchType = buildKitSuffixMatch
+			}
+		case c == '*':
+			expression += "[^/]*"
+			p.matchType = buildKitRegexpMatch
+		case c == '?':
+			expression += "[^/]"
+			p.matchType = buildKitRegexpMatch
+		case strings.ContainsRune(".+()|{}$", c):
+			expression += `\` + string(c)
+		case c == '\\':
+			if i+1 < len(pattern) {
+				i++
+				expression += `\` + string(pattern[i])
+				p.matchType = buildKitRegexpMatch
+			} else {
+				expression += `\`
+			}
+		case c == '[' || c == ']':
+			expression += string(c)
+			p.matchType = buildKitRegexpMatch
+		default:
+			expression += string(c)
+		}
+	}
+	if p.matchType != buildKitRegexpMatch {
+		return nil
+	}
+
+	compiled, err := regexp.Compile(expression + "$")
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	p.regexp = compiled
+	return nil
+}
+
+// match returns true if the slash-separated path matches the pattern, ignoring whether it is an exclusion.
+func (p *buildKitPattern) match(path string) bool {
+	switch p.matchType {
+	case buildKitPrefixMatch:
+		return strings.HasPrefix(path, strings.TrimSuffix(p.cleanedPattern, "**"))
+	case buildKitSuffixMatch:
+		suffix := strings.TrimPrefix(p.cleanedPattern, "**")
+		// "**/name" also matches "name"
+		return strings.HasSuffix(path, suffix) || strings.HasPrefix(suffix, "/") && path == suffix[1:]
+	case buildKitRegexpMatch:
+		return p.regexp.MatchString(path)
+	default:
+		return path == p.cleanedPattern
+	}
+}
+
+// matchesUsingParentResults returns true if the slash-separated path matches the patterns, i.e. the last pattern that
+// matches it (or one of its parent directories) is no exclusion. parentMatched contains the results of the patterns
+// for the parent directory, as returned along with the result for the parent directory, and is nil if they are
+// unknown. In that case, the parent directories are matched against the patterns as well.
+func (m *buildKitPatternMatcher) matchesUsingParentResults(path string, parentMatched []bool) (bool, []bool, error) {
+	if len(parentMatched) != 0 && len(parentMatched) != len(m.patterns) {
+		return false, nil, errors.New("wrong number of parent match results")
+	}
+
+	matched := false
+	patternMatched := make([]bool, len(m.patterns))
+	for i, pattern := range m.patterns {
+		match := len(parentMatched) != 0 && parentMatched[i]
+		if !match {
+			// An inclusion is only evaluated if the path did not match yet, and an exclusion only if it did
+			if pattern.isExclusion != matched {
+				continue
+			}
+			match = pattern.match(path)
+			if parentPath := filepath.ToSlash(filepath.Dir(path)); !match && len(parentMatched) == 0 &&
+				parentPath != "." {
+				parentDirs := strings.Split(parentPath, "/")
+				for j := range parentDirs {
+					if match = pattern.match(strings.Join(parentDirs[:j+1], "/")); match {
+						break
+					}
+				}
+			}
+		}
+		patternMatched[i] = match
+		if match {
+			matched = !pattern.isExclusion
+		}
+	}
+	return matched, patternMatched, nil
+}
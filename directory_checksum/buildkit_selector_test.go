@@ -0,0 +1,118 @@
+package directory_checksum
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildKitChecksum(t *testing.T) {
+	d := newBuildKitTestContext(t)
+
+	// Expected values were computed with BuildKit's contenthash package, for the same build context (see
+	// TestBuildKitScheme)
+	tests := []struct {
+		sourcePath      string
+		includePatterns []string
+		excludePatterns []string
+		want            string
+	}{
+		{sourcePath: ".", want: "sha256:58a64a7c1c804b0714433141def7831c7aa3f101db0cb159aff360eedb3db007"},
+		{sourcePath: "hw", want: "sha256:a93502bc9295a584163082ae7f77dc6fc26744424f076a2ed5eaeb5e053406a6"},
+		{sourcePath: "link", want: "sha256:a93502bc9295a584163082ae7f77dc6fc26744424f076a2ed5eaeb5e053406a6"},
+		{sourcePath: "/src/", want: "sha256:7456d3619fa88c50c1d8decb392bbb530cd9f15b03b85b71c908afd4207c4e44"},
+		{sourcePath: "srclink/pkg", want: "sha256:43300a32b9e7332f248c079f78af7ea60e0b129f1f685542e8759bd0c647cbed"},
+		{sourcePath: "empty", want: "sha256:0e5db88383bce812f795689f5318a2b2f4fde740ef31c2a2365a46368aafddd2"},
+		{
+			sourcePath:      ".",
+			includePatterns: []string{"**/*.go"},
+			want:            "sha256:40908a859d34370ab11b3cabed1277916504040e3f6f3d0fc6c568b712ffb217",
+		},
+		{
+			sourcePath:      ".",
+			excludePatterns: []string{"**/*.go"},
+			want:            "sha256:ee039f9a8426e71f2f69841620725174c8bc36965f6d343f092ba47712a5ab61",
+		},
+		{
+			sourcePath:      "src",
+			includePatterns: []string{"pkg"},
+			want:            "sha256:0b03c1411205464eb665ad484a7d3dcae3a61bf247c1df186ffa23c8db0eb834",
+		},
+		{
+			sourcePath:      "src",
+			excludePatterns: []string{"pkg/*.txt"},
+			want:            "sha256:40908a859d34370ab11b3cabed1277916504040e3f6f3d0fc6c568b712ffb217",
+		},
+		{sourcePath: "src/*.go", want: "sha256:bff04cabc79f5ddb33f23d7cce55803df1b877aace4bcefb5691e88b09cf43c2"},
+		{sourcePath: "*/pkg", want: "sha256:23a2a4f6be8ef325dd9401d8d3d3c98f0b585328914c8f360e6c7d85f853fcfb"},
+		{sourcePath: "nothing/*", want: buildKitEmptyDigest},
+	}
+	for _, tt := range tests {
+		got, err := d.BuildKitChecksum(tt.sourcePath, tt.includePatterns, tt.excludePatterns)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", tt.sourcePath, err)
+		}
+		if got != tt.want {
+			t.Fatalf("Got checksum %s of %s (include %v, exclude %v), want %s", got, tt.sourcePath,
+				tt.includePatterns, tt.excludePatterns, tt.want)
+		}
+	}
+}
+
+func TestBuildKitChecksumErrors(t *testing.T) {
+	d := newBuildKitTestContext(t)
+	if _, err := d.BuildKitChecksum("missing", nil, nil); err == nil {
+		t.Fatal("Expected error for a missing source path but did not get any")
+	}
+	if _, err := d.BuildKitChecksum(".", nil, []string{"!"}); err == nil {
+		t.Fatal("Expected error for an invalid pattern but did not get any")
+	}
+
+	other, _ := NewTree(WithHasher(SHA256)).AddFile("f", strings.NewReader("x")).Build()
+	other.ComputeDirectoryChecksums()
+	if _, err := other.BuildKitChecksum(".", nil, nil); err == nil {
+		t.Fatal("Expected error for a tree with another scheme but did not get any")
+	}
+}
+
+func TestBuildKitPatternMatcher(t *testing.T) {
+	// Expected values were computed with the patternmatcher module that BuildKit uses
+	tests := []struct {
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{[]string{"*.go"}, "main.go", true},
+		{[]string{"*.go"}, "src/main.go", false},
+		{[]string{"**/*.go"}, "src/main.go", true},
+		{[]string{"**/*.go"}, "main.go", true},
+		{[]string{"src"}, "src/main.go", true},
+		{[]string{"src/**"}, "src/pkg/pkg.go", true},
+		{[]string{"**/pkg"}, "pkg", true},
+		{[]string{"**/pkg"}, "src/pkg/pkg.go", true},
+		{[]string{"**"}, "anything", true},
+		{[]string{"src", "!src/main.go"}, "src/main.go", false},
+		{[]string{"src", "!src/main.go"}, "src/pkg/pkg.go", true},
+		{[]string{"*.md", "!README.md", "README.md"}, "README.md", true},
+		{[]string{"a.b"}, "axb", false},
+		{[]string{"?.txt"}, "a.txt", true},
+		{[]string{"[a-c].txt"}, "d.txt", false},
+		{[]string{`\*.txt`}, "*.txt", true},
+		{[]string{`\*.txt`}, "a.txt", false},
+		{[]string{"./src/../docs"}, "docs/README.md", true},
+		{[]string{"  docs  "}, "docs", true},
+		{[]string{"**/nest/**/r.go"}, "deep/nest/more/r.go", true},
+	}
+	for _, tt := range tests {
+		matcher, err := newBuildKitPatternMatcher(tt.patterns)
+		if err != nil {
+			t.Fatalf("Unexpected error for %v: %v", tt.patterns, err)
+		}
+		got, _, err := matcher.matchesUsingParentResults(tt.path, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error for %v: %v", tt.patterns, err)
+		}
+		if got != tt.want {
+			t.Fatalf("Got %t for %s and %v, want %t", got, tt.path, tt.patterns, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package directory_checksum
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+// newBuildKitTestContext returns a build context with files, symbolic links and (empty) directories, whose
+// BuildKitScheme checksums have been computed.
+func newBuildKitTestContext(t *testing.T) *Directory {
+	d, err := NewTree(WithHasher(SHA256), WithScheme(BuildKitScheme)).
+		AddFile("hw", strings.NewReader("hello world")).
+		AddFile("src/main.go", strings.NewReader("package main")).
+		AddFile("src/pkg/pkg.go", strings.NewReader("package pkg")).
+		AddFile("src/pkg/empty.txt", strings.NewReader("")).
+		AddFile("docs/README.md", strings.NewReader("# Docs")).
+		AddDir("empty").
+		AddSymlink("link", "hw").
+		AddSymlink("srclink", "src").
+		Build()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err = d.ComputeDirectoryChecksums(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return d
+}
+
+func TestBuildKitScheme(t *testing.T) {
+	d := newBuildKitTestContext(t)
+
+	// Expected values were computed with BuildKit's contenthash package, for a build context with the same files
+	// (with mode 0644, and 0755 for directories)
+	for relativePath, want := range map[string]string{
+		".":                 "sha256:58a64a7c1c804b0714433141def7831c7aa3f101db0cb159aff360eedb3db007",
+		"hw":                "sha256:a93502bc9295a584163082ae7f77dc6fc26744424f076a2ed5eaeb5e053406a6",
+		"link":              "sha256:37211647b7fb3845234fc77608ce5799ef1683d74f64129d39fe1b5fb3c96f74",
+		"src":               "sha256:7456d3619fa88c50c1d8decb392bbb530cd9f15b03b85b71c908afd4207c4e44",
+		"src/pkg":           "sha256:43300a32b9e7332f248c079f78af7ea60e0b129f1f685542e8759bd0c647cbed",
+		"src/pkg/empty.txt": "sha256:700591407496206b27e3739e92128dd4d3a119e929d3b3677835a1ab6627aa3d",
+		"empty":             "sha256:0e5db88383bce812f795689f5318a2b2f4fde740ef31c2a2365a46368aafddd2",
+	} {
+		entry, ok := d.Lookup(relativePath)
+		if !ok {
+			t.Fatalf("Entry %s not found", relativePath)
+		}
+		if got := FormatBuildKitDigest(entry.Checksum()); got != want {
+			t.Fatalf("Got checksum %s of %s, want %s", got, relativePath, want)
+		}
+	}
+}
+
+func TestBuildKitSchemeRequiresSHA256(t *testing.T) {
+	d, _ := NewTree(WithHasher(SHA1), WithScheme(BuildKitScheme)).AddFile("f", strings.NewReader("x")).Build()
+	if _, err := d.ComputeDirectoryChecksums(); err == nil {
+		t.Fatal("Expected error for the SHA1 algorithm but did not get any")
+	}
+}
+
+func TestBuildKitHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata Metadata
+		want     string
+	}{
+		{
+			name:     "regular file",
+			metadata: Metadata{Mode: 0640, Size: 5, UID: 1000, GID: 1000},
+			want:     "namemode416uid0gid0size5typeflag0linknameunamegnamedevmajor0devminor0",
+		},
+		{
+			name:     "setuid file",
+			metadata: Metadata{Mode: fs.ModeSetuid | 0755, Size: 1},
+			want:     "namemode2541uid0gid0size1typeflag0linknameunamegnamedevmajor0devminor0",
+		},
+		{
+			name:     "directory",
+			metadata: Metadata{Mode: fs.ModeDir | 0755, Size: 4096},
+			want:     "namemode493uid0gid0size0typeflag5linknameunamegnamedevmajor0devminor0",
+		},
+		{
+			name:     "symbolic link",
+			metadata: Metadata{Mode: fs.ModeSymlink, LinkTarget: "../target"},
+			want:     "namemode511uid0gid0size0typeflag2linkname../targetunamegnamedevmajor0devminor0",
+		},
+		{
+			name: "extended attributes",
+			metadata: Metadata{Mode: 0644, Xattrs: map[string]string{
+				"user.b":              "2",
+				"user.a":              "1",
+				"security.selinux":    "label",
+				"security.capability": "cap",
+				"system.posix_acl":    "acl",
+			}},
+			want: "namemode420uid0gid0size0typeflag0linknameunamegnamedevmajor0devminor0" +
+				"security.capabilitycapuser.a1user.b2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(buildKitHeader(tt.metadata)); got != tt.want {
+				t.Fatalf("Got header %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
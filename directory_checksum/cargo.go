@@ -0,0 +1,99 @@
+package directory_checksum
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+)
+
+// CargoChecksumFileName is the name of the file in which "cargo vendor" stores the checksums of a vendored crate.
+const CargoChecksumFileName = ".cargo-checksum.json"
+
+// CargoChecksums is the content of a .cargo-checksum.json file: the SHA-256 digests of the crate's files, keyed by
+// their slash-separated path relative to the crate directory, and the SHA-256 digest of the .crate archive, which is
+// nil for crates that do not come from a registry (e.g. git dependencies).
+type CargoChecksums struct {
+	Files   map[string]string `json:"files"`
+	Package *string           `json:"package"`
+}
+
+// ReadCargoChecksums parses the content of a .cargo-checksum.json file.
+func ReadCargoChecksums(r io.Reader) (*CargoChecksums, error) {
+	checksums := &CargoChecksums{}
+	if err := json.NewDecoder(r).Decode(checksums); err != nil {
+		return nil, errors.Errorf("invalid %s: %v", CargoChecksumFileName, err)
+	}
+	if checksums.Files == nil {
+		return nil, errors.Errorf("invalid %s: the 'files' object is missing", CargoChecksumFileName)
+	}
+	return checksums, nil
+}
+
+// Write writes c to w in the format of cargo, i.e. compact JSON with sorted keys and without trailing line break.
+func (c *CargoChecksums) Write(w io.Writer) error {
+	buffer := bytes.Buffer{}
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(c); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	if _, err := w.Write(bytes.TrimSuffix(buffer.Bytes(), []byte("\n"))); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+// Tree returns the Directory tree (using the SHA256 algorithm) that contains the files listed in c, which can be
+// compared (see Compare) with the crate directory, scanned with CargoCrateFilter and reduced to RegularFilesOnly().
+func (c *CargoChecksums) Tree() (*Directory, error) {
+	builder := NewTree(WithHasher(SHA256))
+	for _, relativePath := range sortedKeys(c.Files) {
+		checksum := c.Files[relativePath]
+		if !isHexadecimal(checksum) || len(checksum) != SHA256.New().Size()*2 {
+			return nil, errors.Errorf("invalid %s: '%s' is not a SHA-256 checksum", CargoChecksumFileName, checksum)
+		}
+		if builder.addFile(path.Clean(relativePath), &File{checksum: checksum, metadata: unknownMetadata}).err != nil {
+			return nil, errors.Errorf("invalid %s: %v", CargoChecksumFileName, builder.err)
+		}
+	}
+	root, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = root.ComputeDirectoryChecksums(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// CargoCrateFilter is a Filter that excludes the .cargo-checksum.json file in the root of a crate directory.
+func CargoCrateFilter(relativePath string, _ fs.FileInfo) bool {
+	return relativePath != CargoChecksumFileName
+}
+
+// CargoChecksums returns the CargoChecksums of the regular files below d, with the provided package checksum (which
+// may be nil). Unless d was scanned with CargoCrateFilter, it must not contain a .cargo-checksum.json file in its root.
+// The plain SHA-256 digests must have been computed during the scan, e.g. by scanning with WithHasher(SHA256).
+func (d *Directory) CargoChecksums(packageChecksum *string) (*CargoChecksums, error) {
+	if _, exists := d.files[CargoChecksumFileName]; exists {
+		return nil, errors.Errorf("unable to compute cargo checksums: the directory contains a %s file",
+			CargoChecksumFileName)
+	}
+	checksums := &CargoChecksums{Files: map[string]string{}, Package: packageChecksum}
+	for relativePath, entry := range d.PreOrder() {
+		if entry.Type() != TypeFile {
+			continue
+		}
+		digest, ok := d.options.digest(entry.(*File), SHA256.Name)
+		if !ok {
+			return nil, errors.New("unable to compute cargo checksums: the tree must be scanned with SHA256 digests " +
+				"(see WithExtraHashers)")
+		}
+		checksums.Files[filepath.ToSlash(relativePath)] = digest
+	}
+	return checksums, nil
+}
@@ -0,0 +1,117 @@
+package directory_checksum
+
+import (
+	"bytes"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCargoChecksums(t *testing.T) {
+	content := `{"files":{"Cargo.toml":"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",` +
+		`"src/lib.rs":"fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9"},"package":"abc"}`
+	checksums, err := ReadCargoChecksums(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(checksums.Files) != 2 || checksums.Package == nil || *checksums.Package != "abc" {
+		t.Fatalf("Got %+v", checksums)
+	}
+
+	// writing the checksums again must reproduce the original content
+	buffer := bytes.Buffer{}
+	if err = checksums.Write(&buffer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buffer.String() != content {
+		t.Fatalf("Got %s, want %s", buffer.String(), content)
+	}
+
+	checksums, _ = ReadCargoChecksums(strings.NewReader(`{"files":{},"package":null}`))
+	if checksums.Package != nil {
+		t.Fatalf("Expected nil package checksum, got %s", *checksums.Package)
+	}
+	for _, invalid := range []string{`{"package":null}`, `[]`, `{"files":`} {
+		if _, err = ReadCargoChecksums(strings.NewReader(invalid)); err == nil {
+			t.Fatalf("Expected error for %s but did not get any", invalid)
+		}
+	}
+}
+
+func TestCargoChecksumsTree(t *testing.T) {
+	checksums := &CargoChecksums{Files: map[string]string{
+		"src/lib.rs": "fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9",
+	}}
+	tree, err := checksums.Tree()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if file, ok := tree.Lookup("src/lib.rs"); !ok || file.Checksum() != checksums.Files["src/lib.rs"] {
+		t.Fatal("Unexpected lookup result")
+	}
+
+	checksums.Files["Cargo.toml"] = "not-a-checksum"
+	if _, err = checksums.Tree(); err == nil {
+		t.Fatal("Expected error for an invalid checksum but did not get any")
+	}
+}
+
+func TestCargoChecksumsVerification(t *testing.T) {
+	tempDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tempDir, "src"), 0755)
+	os.WriteFile(filepath.Join(tempDir, "Cargo.toml"), []byte("foo"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "src", "lib.rs"), []byte("bar"), 0644)
+	os.WriteFile(filepath.Join(tempDir, CargoChecksumFileName), []byte("{}"), 0644)
+	// a nested checksum file is not excluded
+	os.WriteFile(filepath.Join(tempDir, "src", CargoChecksumFileName), []byte("{}"), 0644)
+
+	d, err := ScanDirectory(tempDir, afero.NewOsFs(), WithHasher(SHA256), WithFilter(CargoCrateFilter))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	packageChecksum := "abc"
+	checksums, err := d.CargoChecksums(&packageChecksum)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"Cargo.toml":                   "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+		"src/lib.rs":                   "fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9",
+		"src/" + CargoChecksumFileName: "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a",
+	}
+	if !reflect.DeepEqual(checksums.Files, want) || *checksums.Package != packageChecksum {
+		t.Fatalf("Got %+v", checksums)
+	}
+
+	// modify one file, remove another one from the expected checksums, and add a missing one
+	checksums.Files["Cargo.toml"] = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7af"
+	delete(checksums.Files, "src/lib.rs")
+	checksums.Files["README.md"] = "fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9"
+	expected, err := checksums.Tree()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d.ComputeDirectoryChecksums()
+	var got []string
+	for _, difference := range Compare(expected, d.RegularFilesOnly()) {
+		got = append(got, difference.String())
+	}
+	wantDifferences := []string{"modified: Cargo.toml", "removed: README.md", "added: src/lib.rs"}
+	if !reflect.DeepEqual(got, wantDifferences) {
+		t.Fatalf("Got differences %v, want %v", got, wantDifferences)
+	}
+}
+
+func TestCargoChecksumsErrors(t *testing.T) {
+	d, _ := NewTree(WithHasher(SHA256)).AddFile(CargoChecksumFileName, strings.NewReader("{}")).Build()
+	if _, err := d.CargoChecksums(nil); err == nil {
+		t.Fatal("Expected error for a tree with a checksum file but did not get any")
+	}
+	d, _ = NewTree(WithHasher(SHA1)).AddFile("f", strings.NewReader("x")).Build()
+	if _, err := d.CargoChecksums(nil); err == nil {
+		t.Fatal("Expected error for missing SHA256 digests but did not get any")
+	}
+}
@@ -1,53 +1,53 @@
 package directory_checksum
 
 import (
-	"crypto/sha1"
 	"encoding/hex"
-	"fmt"
 	"github.com/go-errors/errors"
 	"github.com/spf13/afero"
+	"hash"
 	"io"
 )
 
-// computeFileChecksum computes the SHA-1 digest of the file located at absoluteFilePath and returns it as string that
-// represents the digest with hexadecimal notation. If isSymbolicLink is true, the hash is instead computed on the
-// link's target, which is basically the "content" of a symbolic link file.
-func computeFileChecksum(absoluteFilePath string, isSymbolicLink bool, filesystemImpl afero.Fs) (string, error) {
-	if isSymbolicLink {
-		linkReader, ok := filesystemImpl.(afero.LinkReader)
-		if !ok {
-			return "", errors.Errorf("unable to compute checksum for symbolic link file %s: file system is "+
-				"unable to read links", absoluteFilePath)
-		}
+// readLinkTarget returns the target of the symbolic link located at absoluteFilePath.
+func readLinkTarget(absoluteFilePath string, filesystemImpl afero.Fs) (string, error) {
+	linkReader, ok := filesystemImpl.(afero.LinkReader)
+	if !ok {
+		return "", errors.Errorf("unable to compute checksum for symbolic link file %s: file system is "+
+			"unable to read links", absoluteFilePath)
+	}
 
-		linkTarget, err := linkReader.ReadlinkIfPossible(absoluteFilePath)
-		if err != nil {
-			return "", errors.Wrap(err, 0)
-		}
+	linkTarget, err := linkReader.ReadlinkIfPossible(absoluteFilePath)
+	if err != nil {
+		return "", errors.Wrap(err, 0)
+	}
+	return linkTarget, nil
+}
 
-		hasher := sha1.New()
-		_, err = io.WriteString(hasher, linkTarget)
-		if err != nil {
-			return "", errors.Wrap(err, 0)
-		}
-		return hex.EncodeToString(hasher.Sum(nil)), nil
-	} else {
-		f, err := filesystemImpl.Open(absoluteFilePath)
-		if err != nil {
-			return "", errors.Wrap(err, 0)
-		}
-		defer func(f afero.File) {
-			err := f.Close()
-			if err != nil {
-				fmt.Printf("Unable to close file %s in computeFileChecksum(): %v\n", absoluteFilePath, err)
-			}
-		}(f)
+// digestReader reads r until EOF and returns its digests (in hexadecimal notation), one per provided algorithm, as
+// well as the number of bytes read.
+func digestReader(r io.Reader, algorithms []HashAlgorithm) ([]string, int64, error) {
+	hashers := make([]hash.Hash, len(algorithms))
+	for i, algorithm := range algorithms {
+		hashers[i] = algorithm.New()
+	}
+	return hashReader(r, hashers)
+}
 
-		h := sha1.New()
-		if _, err := io.Copy(h, f); err != nil {
-			return "", errors.Wrap(err, 0)
-		}
+// hashReader reads r until EOF, writing it to all hashers, and returns their sums (in hexadecimal notation), as well
+// as the number of bytes read.
+func hashReader(r io.Reader, hashers []hash.Hash) ([]string, int64, error) {
+	writers := make([]io.Writer, len(hashers))
+	for i, hasher := range hashers {
+		writers[i] = hasher
+	}
+	size, err := io.Copy(io.MultiWriter(writers...), r)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, 0)
+	}
 
-		return hex.EncodeToString(h.Sum(nil)), nil
+	digests := make([]string, len(hashers))
+	for i, hasher := range hashers {
+		digests[i] = hex.EncodeToString(hasher.Sum(nil))
 	}
+	return digests, size, nil
 }
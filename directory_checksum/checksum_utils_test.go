@@ -2,6 +2,9 @@ package directory_checksum
 
 import (
 	"github.com/spf13/afero"
+	"hash"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -11,19 +14,23 @@ func TestComputeChecksum(t *testing.T) {
 	f, _ := filesystemImpl.Create(tempFilePath)
 	f.WriteString("Hello World")
 	f.Close()
+	info, _ := filesystemImpl.Stat(tempFilePath)
 
-	got, _ := computeFileChecksum(tempFilePath, false, filesystemImpl)
+	file, _ := newScanOptions().scanFile(tempFilePath, info, filesystemImpl)
 	want := "0a4d55a8d778e5022fab701977c5d840bbc486d0"
 
-	if got != want {
+	if got := file.Checksum(); got != want {
 		t.Fatalf("Got %s, wanted %s", got, want)
 	}
 }
 
 func TestNonExistingFile(t *testing.T) {
 	filesystemImpl := afero.NewMemMapFs()
+	f, _ := filesystemImpl.Create("/tmpfile")
+	f.Close()
+	info, _ := filesystemImpl.Stat("/tmpfile")
 
-	_, err := computeFileChecksum("does-not-exist", false, filesystemImpl)
+	_, err := newScanOptions().scanFile("does-not-exist", info, filesystemImpl)
 
 	if err == nil {
 		t.Fatal("Expected error but did not get any")
@@ -36,13 +43,24 @@ func TestUnreadableFile(t *testing.T) {
 	f, _ := filesystemImpl.Create(tempFilePath)
 	f.WriteString("Hello World")
 	f.Close()
+	info, _ := filesystemImpl.Stat(tempFilePath)
 
 	wrapper := fsWrapper{filesystemImpl}
 	filesystemImpl = &wrapper
 
-	_, err := computeFileChecksum("/tmpfile", false, filesystemImpl)
+	_, err := newScanOptions().scanFile("/tmpfile", info, filesystemImpl)
 
 	if err == nil {
 		t.Fatal("Expected error but did not get any")
 	}
 }
+
+func TestHashReader(t *testing.T) {
+	digests, size, err := hashReader(strings.NewReader("Hello World"), []hash.Hash{SHA1.New(), SHA256.New()})
+	want := []string{"0a4d55a8d778e5022fab701977c5d840bbc486d0",
+		"a591a6d40bf420404a011733cfb7b190d62c65bf0bcda32b57b277d9ad9f146e"}
+
+	if err != nil || size != 11 || !slices.Equal(digests, want) {
+		t.Fatalf("Got digests %v, size %d and error %v, wanted %v", digests, size, err, want)
+	}
+}
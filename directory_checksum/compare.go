@@ -0,0 +1,92 @@
+package directory_checksum
+
+import (
+	"fmt"
+	"path"
+	"sort"
+)
+
+// A DifferenceKind describes how an entry differs between two trees.
+type DifferenceKind string
+
+const (
+	DifferenceAdded       DifferenceKind = "added"
+	DifferenceRemoved     DifferenceKind = "removed"
+	DifferenceModified    DifferenceKind = "modified"
+	DifferenceTypeChanged DifferenceKind = "type changed"
+)
+
+// A Difference is an entry that differs between an expected and an actual tree. Expected is nil for added entries,
+// Actual is nil for removed entries.
+type Difference struct {
+	// Path is the slash-separated path of the entry, relative to the root directory.
+	Path     string
+	Kind     DifferenceKind
+	Expected Entry
+	Actual   Entry
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: %s", d.Kind, d.Path)
+}
+
+// Compare returns the differences between the expected and the actual tree, sorted by path. Added or removed
+// directories are reported as a single Difference, without listing their children. Directories themselves are never
+// reported as modified; instead, the differences of their children are reported. Sub-trees whose directory checksums
+// are equal are skipped, so ComputeDirectoryChecksums() should have been called on both trees.
+func Compare(expected *Directory, actual *Directory) []Difference {
+	var differences []Difference
+	compareDirectories(".", expected, actual, &differences)
+	sort.SliceStable(differences, func(i, j int) bool { return differences[i].Path < differences[j].Path })
+	return differences
+}
+
+// compareDirectories appends the differences between the expected and actual Directory (located at relativePath) to
+// differences.
+func compareDirectories(relativePath string, expected *Directory, actual *Directory, differences *[]Difference) {
+	if expected.checksum != "" && expected.checksum == actual.checksum {
+		return
+	}
+
+	names := map[string]bool{}
+	for _, entries := range []*Directory{expected, actual} {
+		for name := range entries.dirs {
+			names[name] = true
+		}
+		for name := range entries.files {
+			names[name] = true
+		}
+	}
+
+	for _, name := range sortedKeys(names) {
+		childPath := path.Join(relativePath, name)
+		expectedEntry := expected.child(name)
+		actualEntry := actual.child(name)
+		switch {
+		case expectedEntry == nil:
+			*differences = append(*differences, Difference{Path: childPath, Kind: DifferenceAdded, Actual: actualEntry})
+		case actualEntry == nil:
+			*differences = append(*differences, Difference{Path: childPath, Kind: DifferenceRemoved,
+				Expected: expectedEntry})
+		case expectedEntry.Type() != actualEntry.Type():
+			*differences = append(*differences, Difference{Path: childPath, Kind: DifferenceTypeChanged,
+				Expected: expectedEntry, Actual: actualEntry})
+		case expectedEntry.Type() == TypeDir:
+			compareDirectories(childPath, expectedEntry.(*Directory), actualEntry.(*Directory), differences)
+		case expectedEntry.Checksum() != actualEntry.Checksum():
+			*differences = append(*differences, Difference{Path: childPath, Kind: DifferenceModified,
+				Expected: expectedEntry, Actual: actualEntry})
+		}
+	}
+}
+
+// child returns the immediate child Entry with the provided name, or nil if there is no such child.
+func (d *Directory) child(name string) Entry {
+	if subDir, ok := d.dirs[name]; ok {
+		return subDir
+	}
+	if file, ok := d.files[name]; ok {
+		return file
+	}
+	return nil
+}
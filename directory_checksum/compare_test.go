@@ -0,0 +1,48 @@
+package directory_checksum
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	expected, _ := NewTree().
+		AddFile("same/f", strings.NewReader("foo")).
+		AddFile("d/modified", strings.NewReader("foo")).
+		AddFile("d/removed", strings.NewReader("foo")).
+		AddFile("d/type", strings.NewReader("foo")).
+		AddFile("removed-dir/f", strings.NewReader("foo")).
+		Build()
+	actual, _ := NewTree().
+		AddFile("same/f", strings.NewReader("foo")).
+		AddFile("d/modified", strings.NewReader("bar")).
+		AddSymlink("d/type", "foo").
+		AddFile("d/added", strings.NewReader("foo")).
+		AddDir("added-dir").
+		Build()
+	expected.ComputeDirectoryChecksums()
+	actual.ComputeDirectoryChecksums()
+
+	var got []string
+	for _, difference := range Compare(expected, actual) {
+		got = append(got, difference.String())
+	}
+
+	want := []string{"added: added-dir", "added: d/added", "modified: d/modified", "removed: d/removed",
+		"type changed: d/type", "removed: removed-dir"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Got %v, want %v", got, want)
+	}
+}
+
+func TestCompareEqualTrees(t *testing.T) {
+	expected, _ := NewTree().AddFile("d/f", strings.NewReader("foo")).Build()
+	actual, _ := NewTree().AddFile("d/f", strings.NewReader("foo")).Build()
+	expected.ComputeDirectoryChecksums()
+	actual.ComputeDirectoryChecksums()
+
+	if differences := Compare(expected, actual); len(differences) != 0 {
+		t.Fatalf("Got unexpected differences: %v", differences)
+	}
+}
@@ -0,0 +1,224 @@
+package directory_checksum
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/go-errors/errors"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// WriteChecksumList writes the checksum of every regular file below d to w, in the format of the GNU coreutils
+// "sha256sum" (and "sha1sum", "md5sum", ...) tools, i.e. "<checksum>  <path>" with forward-slash paths relative to d.
+// If bsdTag is true, the BSD style "<ALGORITHM> (<path>) = <checksum>" is used instead (see "sha256sum --tag"). Paths
+// that contain backslashes or line breaks are escaped like coreutils does. Symbolic links are not listed, because
+// their checksum is computed on the link target, while "sha256sum" would hash the content of the file it points to.
+// It assumes that ComputeDirectoryChecksums() has already been called. For trees that do not use the DefaultScheme,
+// the plain digests of the tree's hash algorithm must have been computed as well (see WithExtraHashers).
+func (d *Directory) WriteChecksumList(w io.Writer, bsdTag bool) error {
+	if d.checksum == "" {
+		return errors.New("unable to write checksum list: directory checksums have not been computed")
+	}
+
+	bufferedWriter := bufio.NewWriter(w)
+	tag := strings.ToUpper(d.options.hasher.Name)
+	for relativePath, entry := range d.PreOrder() {
+		if entry.Type() != TypeFile {
+			continue
+		}
+		digest, ok := d.options.digest(entry.(*File), d.options.hasher.Name)
+		if !ok {
+			return errors.Errorf("unable to write checksum list: the tree must be scanned with plain %s digests "+
+				"(see WithExtraHashers)", d.options.hasher.Name)
+		}
+		prefix, escapedPath := escapeChecksumListPath(filepath.ToSlash(relativePath))
+		var err error
+		if bsdTag {
+			_, err = fmt.Fprintf(bufferedWriter, "%s%s (%s) = %s\n", prefix, tag, escapedPath, digest)
+		} else {
+			_, err = fmt.Fprintf(bufferedWriter, "%s%s  %s\n", prefix, digest, escapedPath)
+		}
+		if err != nil {
+			return errors.Wrap(err, 0)
+		}
+	}
+
+	if err := bufferedWriter.Flush(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+// ReadChecksumList reads a list of file checksums in the format of the GNU coreutils "*sum" tools (in default or BSD
+// tag style, see WriteChecksumList) and returns the Directory tree that contains the listed files. The hash algorithm
+// is derived from the BSD tags, or from the length of the checksums, and must be the same for all lines. Directories
+// are created implicitly for the parent directories of the listed files.
+func ReadChecksumList(r io.Reader) (*Directory, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var builder *TreeBuilder
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		algorithm, checksum, relativePath, err := parseChecksumListLine(line)
+		if err != nil {
+			return nil, errors.Errorf("invalid checksum list entry in line %d: %v", lineNumber, err)
+		}
+		if builder == nil {
+			builder = NewTree(WithHasher(algorithm))
+		} else if builder.root.options.hasher.Name != algorithm.Name {
+			return nil, errors.Errorf("invalid checksum list entry in line %d: expected a %s checksum, got %s",
+				lineNumber, builder.root.options.hasher.Name, algorithm.Name)
+		}
+
+		if builder.addFile(path.Clean(relativePath), &File{checksum: checksum, metadata: unknownMetadata}).err != nil {
+			return nil, errors.Errorf("invalid checksum list entry in line %d: %v", lineNumber, builder.err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	if builder == nil {
+		return nil, errors.New("invalid checksum list: it does not contain any entries")
+	}
+
+	root, _ := builder.Build()
+	if _, err := root.ComputeDirectoryChecksums(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// RegularFilesOnly returns a copy of d that only contains the regular files and the directories that (transitively)
+// contain at least one regular file. This is the part of a tree that a checksum list (see WriteChecksumList) can
+// describe, so the result can be compared with a tree read by ReadChecksumList. File objects are shared with d.
+func (d *Directory) RegularFilesOnly() *Directory {
+	result := newDirectory(d.options)
+	result.metadata = d.metadata
+	for name, file := range d.files {
+		if !file.isSymbolicLink {
+			result.files[name] = file
+		}
+	}
+	for name, subDir := range d.dirs {
+		if filtered := subDir.RegularFilesOnly(); len(filtered.files) > 0 || len(filtered.dirs) > 0 {
+			result.dirs[name] = filtered
+		}
+	}
+	return result
+}
+
+// parseChecksumListLine parses one line of a checksum list, in default or BSD tag style.
+func parseChecksumListLine(line string) (algorithm HashAlgorithm, checksum string, relativePath string, err error) {
+	escaped := strings.HasPrefix(line, "\\")
+	if escaped {
+		line = line[1:]
+	}
+
+	if tag, rest, found := strings.Cut(line, " ("); found && !strings.ContainsAny(tag, " \t") && isUpperCase(tag) {
+		separatorIndex := strings.LastIndex(rest, ") = ")
+		if separatorIndex < 0 {
+			return HashAlgorithm{}, "", "", errors.New("expected '<ALGORITHM> (<path>) = <checksum>'")
+		}
+		var ok bool
+		algorithm, ok = HashAlgorithmByName(strings.ToLower(tag))
+		if !ok {
+			return HashAlgorithm{}, "", "", errors.Errorf("unsupported algorithm '%s'", tag)
+		}
+		relativePath, checksum = rest[:separatorIndex], rest[separatorIndex+len(") = "):]
+	} else {
+		var found bool
+		checksum, relativePath, found = strings.Cut(line, " ")
+		if !found || relativePath == "" || (relativePath[0] != ' ' && relativePath[0] != '*') {
+			return HashAlgorithm{}, "", "", errors.New("expected '<checksum>  <path>' or '<checksum> *<path>'")
+		}
+		relativePath = relativePath[1:]
+		algorithm, err = hashAlgorithmByChecksumLength(checksum)
+		if err != nil {
+			return HashAlgorithm{}, "", "", err
+		}
+	}
+
+	checksum = strings.ToLower(checksum)
+	if !isHexadecimal(checksum) || len(checksum) != algorithm.New().Size()*2 {
+		return HashAlgorithm{}, "", "", errors.Errorf("invalid %s checksum '%s'", algorithm.Name, checksum)
+	}
+	if escaped {
+		relativePath, err = unescapeChecksumListPath(relativePath)
+		if err != nil {
+			return HashAlgorithm{}, "", "", err
+		}
+	}
+	if relativePath == "" {
+		return HashAlgorithm{}, "", "", errors.New("empty path")
+	}
+	return algorithm, checksum, relativePath, nil
+}
+
+// hashAlgorithmByChecksumLength returns the supported HashAlgorithm whose hexadecimal checksums have the length of
+// checksum.
+func hashAlgorithmByChecksumLength(checksum string) (HashAlgorithm, error) {
+	for _, algorithm := range hashAlgorithms {
+		if algorithm.New().Size()*2 == len(checksum) {
+			return algorithm, nil
+		}
+	}
+	return HashAlgorithm{}, errors.Errorf("unable to determine the hash algorithm of checksum '%s'", checksum)
+}
+
+// escapeChecksumListPath escapes backslashes and line breaks in relativePath like the coreutils "*sum" tools do. If
+// escaping was necessary, the returned prefix is a backslash, which must start the line.
+func escapeChecksumListPath(relativePath string) (prefix string, escapedPath string) {
+	if !strings.ContainsAny(relativePath, "\\\n\r") {
+		return "", relativePath
+	}
+	replacer := strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r")
+	return "\\", replacer.Replace(relativePath)
+}
+
+// unescapeChecksumListPath reverses escapeChecksumListPath.
+func unescapeChecksumListPath(escapedPath string) (string, error) {
+	unescaped := strings.Builder{}
+	for i := 0; i < len(escapedPath); i++ {
+		if escapedPath[i] != '\\' {
+			unescaped.WriteByte(escapedPath[i])
+			continue
+		}
+		i++
+		if i == len(escapedPath) {
+			return "", errors.New("invalid escape sequence at the end of the path")
+		}
+		switch escapedPath[i] {
+		case '\\':
+			unescaped.WriteByte('\\')
+		case 'n':
+			unescaped.WriteByte('\n')
+		case 'r':
+			unescaped.WriteByte('\r')
+		default:
+			return "", errors.Errorf("invalid escape sequence '\\%c'", escapedPath[i])
+		}
+	}
+	return unescaped.String(), nil
+}
+
+func isUpperCase(s string) bool {
+	return s != "" && strings.ToUpper(s) == s
+}
+
+func isHexadecimal(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,93 @@
+package directory_checksum
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteChecksumList(t *testing.T) {
+	d, _ := NewTree().
+		AddFile("d/f", strings.NewReader("foo")).
+		AddSymlink("d/link", "f").
+		AddFile("back\\slash", strings.NewReader("bar")).
+		Build()
+	d.ComputeDirectoryChecksums()
+
+	buffer := bytes.Buffer{}
+	if err := d.WriteChecksumList(&buffer, false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := "0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33  d/f\n" +
+		"\\62cdb7020ff920e5aa642c3d4066950dd1f01f4d  back\\\\slash\n"
+	if buffer.String() != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", buffer.String(), want)
+	}
+
+	buffer.Reset()
+	if err := d.WriteChecksumList(&buffer, true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want = "SHA1 (d/f) = 0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33\n" +
+		"\\SHA1 (back\\\\slash) = 62cdb7020ff920e5aa642c3d4066950dd1f01f4d\n"
+	if buffer.String() != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", buffer.String(), want)
+	}
+}
+
+func TestReadChecksumList(t *testing.T) {
+	for _, list := range []string{
+		"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae  ./d/f\n" +
+			"\\fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9 *line\\nbreak\n",
+		"SHA256 (d/f) = 2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae\r\n\r\n" +
+			"\\SHA256 (line\\nbreak) = fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9\r\n",
+	} {
+		d, err := ReadChecksumList(strings.NewReader(list))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		want, _ := NewTree(WithHasher(SHA256)).
+			AddFile("d/f", strings.NewReader("foo")).
+			AddFile("line\nbreak", strings.NewReader("bar")).
+			Build()
+		want.ComputeDirectoryChecksums()
+		if differences := Compare(want, d); len(differences) > 0 {
+			t.Fatalf("Got differences %v", differences)
+		}
+	}
+}
+
+func TestReadChecksumListInvalid(t *testing.T) {
+	for _, list := range []string{
+		"",
+		"0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33 f\n",
+		"0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a3  f\n",
+		"0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33  ../f\n",
+		"0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33  f\n0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33  f\n",
+		"0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33  f\nacbd18db4cc2f85cedef654fccc4a4d8  g\n",
+		"WHIRLPOOL (f) = 0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33\n",
+	} {
+		if _, err := ReadChecksumList(strings.NewReader(list)); err == nil {
+			t.Fatalf("Expected error for %q but did not get any", list)
+		}
+	}
+}
+
+func TestRegularFilesOnly(t *testing.T) {
+	d, _ := NewTree().
+		AddFile("d/f", strings.NewReader("foo")).
+		AddSymlink("d/link", "f").
+		AddSymlink("links/link", "../d/f").
+		AddDir("empty").
+		Build()
+
+	filtered := d.RegularFilesOnly()
+	filtered.ComputeDirectoryChecksums()
+
+	want, _ := NewTree().AddFile("d/f", strings.NewReader("foo")).Build()
+	want.ComputeDirectoryChecksums()
+	if filtered.Checksum() != want.Checksum() {
+		t.Fatalf("Got %s, want %s", filtered.Checksum(), want.Checksum())
+	}
+}
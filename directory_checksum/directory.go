@@ -1,8 +1,6 @@
 package directory_checksum
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
 	"fmt"
 	"github.com/go-errors/errors"
 	"github.com/spf13/afero"
@@ -20,61 +18,103 @@ const (
 	TypeSymlink FileType = 2
 )
 
+// Letter returns the single-letter type that is used in listings, i.e. "D", "F" or "S".
+func (t FileType) Letter() string {
+	switch t {
+	case TypeDir:
+		return "D"
+	case TypeSymlink:
+		return "S"
+	default:
+		return "F"
+	}
+}
+
 // A Directory represents a physical directory on the file system. files and dirs contain only the immediate child
 // objects. The files and dirs fields map from the file's / dir's name to its corresponding File/Directory object.
+// The options are shared by all Directory objects of the same tree. source is only set for the root Directory of a
+// scanned tree. An empty checksum marks a Directory whose checksum still needs to be (re-)computed.
 type Directory struct {
 	files    map[string]*File
 	dirs     map[string]*Directory
 	checksum string
+	options  *scanOptions
+	source   *scanSource
+	metadata Metadata
+}
+
+// scanSource remembers where a tree was scanned from, so that parts of it can be re-scanned later.
+type scanSource struct {
+	filesystemImpl   afero.Fs
+	absoluteRootPath string
 }
 
+// A File represents a regular file or symbolic link. digests holds the digests of the extra hash algorithms (see
+// WithExtraHashers), keyed by the algorithm's name. content opens the content of a regular file again, which some
+// schemes and output formats need; it is nil if the content is not available, e.g. for trees read from a manifest.
 type File struct {
 	checksum       string
 	isSymbolicLink bool
+	digests        map[string]string
+	metadata       Metadata
+	content        func() (io.ReadCloser, error)
 }
 
 // newDirectory constructs an empty Directory object with pre-initialized empty maps.
-func newDirectory() *Directory {
+func newDirectory(options *scanOptions) *Directory {
 	d := Directory{
 		files:    map[string]*File{},
 		dirs:     map[string]*Directory{},
 		checksum: "",
+		options:  options,
+		metadata: unknownMetadata,
 	}
 	return &d
 }
 
 // ComputeDirectoryChecksums recursively computes the "checksum" field of all Directory objects, and returns the
 // checksum of the object this method is called on.
-// It assumes that the checksum of all files(!) have already been computed.
+// It assumes that the checksum of all files(!) have already been computed. Checksums of directories that have not
+// changed since the last call (see Update, Remove and Rename) are not recomputed.
 func (d *Directory) ComputeDirectoryChecksums() (string, error) {
-	hasher := sha1.New()
-
-	for _, dirName := range sortedKeys(d.dirs) {
-		childDir := d.dirs[dirName]
-		childDirChecksum, err := childDir.ComputeDirectoryChecksums()
-		if err != nil {
-			return "", err
-		}
-
-		_, err = io.WriteString(hasher, fmt.Sprintf("'%s' %s\n", dirName, childDirChecksum))
-		if err != nil {
-			return "", errors.Wrap(err, 0)
-		}
-	}
-	for _, fileName := range sortedKeys(d.files) {
-		childFile := d.files[fileName]
-		_, err := io.WriteString(hasher, fmt.Sprintf("'%s' %t %s\n", fileName, childFile.isSymbolicLink,
-			childFile.checksum))
-		if err != nil {
-			return "", errors.Wrap(err, 0)
-		}
+	if d.checksum != "" {
+		return d.checksum, nil
 	}
 
-	d.checksum = hex.EncodeToString(hasher.Sum(nil))
+	checksum, err := d.options.scheme.directoryChecksum(d)
+	if err != nil {
+		return "", err
+	}
+	d.checksum = checksum
 
 	return d.checksum, nil
 }
 
+// dirListingLine returns the line that represents a child directory in the listing of its parent directory, whose
+// hash is the parent directory's checksum.
+func dirListingLine(dirName string, checksum string) string {
+	return fmt.Sprintf("'%s' %s\n", dirName, checksum)
+}
+
+// fileListingLine returns the line that represents a child file in the listing of its parent directory, whose hash is
+// the parent directory's checksum.
+func fileListingLine(fileName string, isSymbolicLink bool, checksum string) string {
+	return fmt.Sprintf("'%s' %t %s\n", fileName, isSymbolicLink, checksum)
+}
+
+// listing returns the listing of d's immediate children, whose hash is d's checksum. It assumes that
+// ComputeDirectoryChecksums() has already been called.
+func (d *Directory) listing() string {
+	stringBuilder := strings.Builder{}
+	for dirName, childDir := range d.Dirs() {
+		stringBuilder.WriteString(dirListingLine(dirName, childDir.checksum))
+	}
+	for fileName, childFile := range d.Files() {
+		stringBuilder.WriteString(fileListingLine(fileName, childFile.isSymbolicLink, childFile.checksum))
+	}
+	return stringBuilder.String()
+}
+
 // PrintChecksums prints a listing of the files and directories, including their checksums, using pre-order tree
 // traversal, stopping the traversal at the specified depth level. It assumes that ComputeDirectoryChecksums() has
 // already been called on the root Directory object.
@@ -110,32 +150,39 @@ func (d *Directory) printChecksums(relativePath string, depth int) string {
 
 // Add adds the file or directory located at absoluteRootPath/relativePath to the correct Directory object.
 // relativeRemainingPath is a helper argument, used to traverse down the Directory object hierarchy, and must initially
-// be set to the same value as relativePath. If fileType is not(!) TypeDir, the SHA-1 checksum is computed
+// be set to the same value as relativePath. If fileType is not(!) TypeDir, the checksum is computed with the hash
+// algorithm the tree was scanned with.
 func (d *Directory) Add(relativeRemainingPath string, relativePath string, absoluteRootPath string, fileType FileType,
 	filesystemImpl afero.Fs) error {
+	if fileType == TypeDir {
+		d.addEntry(relativeRemainingPath, nil)
+		return nil
+	}
+
+	absoluteFilePath := filepath.Join(absoluteRootPath, relativePath)
+	info, _, err := lstatIfPossible(filesystemImpl, absoluteFilePath)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	file, err := d.options.scanFile(absoluteFilePath, info, filesystemImpl)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	d.addEntry(relativeRemainingPath, file)
+	return nil
+}
+
+// addEntry traverses down the Directory object hierarchy along relativeRemainingPath and adds file to the Directory
+// object that contains it. If file is nil, an empty Directory object is added instead. The checksums of all traversed
+// Directory objects are reset.
+func (d *Directory) addEntry(relativeRemainingPath string, file *File) {
+	d.checksum = ""
 	if strings.Contains(relativeRemainingPath, string(os.PathSeparator)) {
 		components := strings.SplitN(relativeRemainingPath, string(os.PathSeparator), 2)
-		subDir := d.dirs[components[0]]
-		err := subDir.Add(components[1], relativePath, absoluteRootPath, fileType, filesystemImpl)
-		if err != nil {
-			return errors.Wrap(err, 0)
-		}
+		d.dirs[components[0]].addEntry(components[1], file)
+	} else if file == nil {
+		d.dirs[relativeRemainingPath] = newDirectory(d.options)
 	} else {
-		if fileType == TypeDir {
-			d.dirs[relativeRemainingPath] = newDirectory()
-		} else {
-			absoluteFilePath := filepath.Join(absoluteRootPath, relativePath)
-			isSymbolicLink := fileType == TypeSymlink
-			fileChecksum, err := computeFileChecksum(absoluteFilePath, isSymbolicLink, filesystemImpl)
-			if err != nil {
-				return errors.Wrap(err, 0)
-			}
-			d.files[relativeRemainingPath] = &File{
-				checksum:       fileChecksum,
-				isSymbolicLink: isSymbolicLink,
-			}
-		}
+		d.files[relativeRemainingPath] = file
 	}
-
-	return nil
 }
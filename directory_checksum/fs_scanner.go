@@ -1,13 +1,14 @@
 package directory_checksum
 
 import (
-	"fmt"
 	"github.com/go-errors/errors"
 	"github.com/spf13/afero"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 // bendRelativePath converts the provided relativePath (which MIGHT actually be absolute) to an actually relative path,
@@ -58,9 +59,16 @@ func getInvalidFiletypeAsString(mode fs.FileMode) string {
 	return ""
 }
 
+// pendingFile is a file found while walking the directory, whose checksum has not been computed yet.
+type pendingFile struct {
+	relativePath string
+	info         fs.FileInfo
+}
+
 // ScanDirectory returns the pointer to a (hierarchically-nested) Directory that is constructed from recursively walking
-// the directory located at absoluteRootPath.
-func ScanDirectory(absoluteRootPath string, filesystemImpl afero.Fs) (*Directory, error) {
+// the directory located at absoluteRootPath. The scan can be customized with ScanOption values, such as WithHasher or
+// WithFilter.
+func ScanDirectory(absoluteRootPath string, filesystemImpl afero.Fs, options ...ScanOption) (*Directory, error) {
 	// Handle a special case that happens only during unit testing (where root is '\' when executed on Windows
 	if absoluteRootPath != "\\" {
 		absRootPath, err := filepath.Abs(absoluteRootPath)
@@ -70,7 +78,14 @@ func ScanDirectory(absoluteRootPath string, filesystemImpl afero.Fs) (*Directory
 		absoluteRootPath = absRootPath
 	}
 
-	directory := newDirectory()
+	return scanDirectory(absoluteRootPath, filesystemImpl, newScanOptions(options...))
+}
+
+// scanDirectory is the actual implementation of ScanDirectory, which expects absoluteRootPath to already be absolute.
+func scanDirectory(absoluteRootPath string, filesystemImpl afero.Fs, o *scanOptions) (*Directory, error) {
+	directory := newDirectory(o)
+	directory.source = &scanSource{filesystemImpl: filesystemImpl, absoluteRootPath: absoluteRootPath}
+	var pendingFiles []pendingFile
 	err := afero.Walk(filesystemImpl, absoluteRootPath, func(relativePath string, info fs.FileInfo, err error) error {
 		if err != nil {
 			return errors.Wrap(err, 0)
@@ -79,6 +94,11 @@ func ScanDirectory(absoluteRootPath string, filesystemImpl afero.Fs) (*Directory
 		if absoluteRootPath == relativePath && !info.IsDir() {
 			return errors.New("provided root path must point to a directory")
 		}
+		if absoluteRootPath == relativePath {
+			if directory.metadata, err = o.metadata(absoluteRootPath, info, filesystemImpl); err != nil {
+				return err
+			}
+		}
 
 		if relativePath != absoluteRootPath {
 			relativePath = bendRelativePath(relativePath, absoluteRootPath)
@@ -91,14 +111,28 @@ func ScanDirectory(absoluteRootPath string, filesystemImpl afero.Fs) (*Directory
 			}
 
 			if isInvalidFiletype(info.Mode()) {
-				fmt.Printf("WARNING: skipping '%s' because it is of unsupported type: %s\n", relativePath,
+				o.logger.Printf("WARNING: skipping '%s' because it is of unsupported type: %s\n", relativePath,
 					getInvalidFiletypeAsString(info.Mode()))
 				return nil
 			}
 
-			err := directory.Add(relativePath, relativePath, absoluteRootPath, fileType, filesystemImpl)
-			if err != nil {
-				return errors.Wrap(err, 0)
+			if o.filter != nil && !o.filter(relativePath, info) {
+				if fileType == TypeDir {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if fileType == TypeDir {
+				metadata, err := o.metadata(filepath.Join(absoluteRootPath, relativePath), info, filesystemImpl)
+				if err != nil {
+					return err
+				}
+				directory.addEntry(relativePath, nil)
+				subDir, _ := directory.Lookup(relativePath)
+				subDir.(*Directory).metadata = metadata
+			} else {
+				pendingFiles = append(pendingFiles, pendingFile{relativePath: relativePath, info: info})
 			}
 		}
 		return nil
@@ -107,5 +141,95 @@ func ScanDirectory(absoluteRootPath string, filesystemImpl afero.Fs) (*Directory
 		return nil, errors.Wrap(err, 0)
 	}
 
+	err = computePendingFileChecksums(directory, pendingFiles, absoluteRootPath, filesystemImpl)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
 	return directory, nil
 }
+
+// computePendingFileChecksums computes the checksums of all pendingFiles, using as many goroutines as configured via
+// WithConcurrency, and adds the files to directory. If computing any checksum fails, the first error is returned.
+func computePendingFileChecksums(directory *Directory, pendingFiles []pendingFile, absoluteRootPath string,
+	filesystemImpl afero.Fs) error {
+	files := make([]*File, len(pendingFiles))
+	errs := make([]error, len(pendingFiles))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for range min(directory.options.concurrency, len(pendingFiles)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				absoluteFilePath := filepath.Join(absoluteRootPath, pendingFiles[i].relativePath)
+				files[i], errs[i] = directory.options.scanFile(absoluteFilePath, pendingFiles[i].info, filesystemImpl)
+			}
+		}()
+	}
+	for i := range pendingFiles {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	for i, pending := range pendingFiles {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		directory.addEntry(pending.relativePath, files[i])
+	}
+	return nil
+}
+
+// scanFile computes the digests of the regular file or symbolic link at absoluteFilePath, which is described by info,
+// and returns the corresponding File, including its Metadata.
+func (o *scanOptions) scanFile(absoluteFilePath string, info fs.FileInfo, filesystemImpl afero.Fs) (*File, error) {
+	isSymbolicLink := info.Mode()&os.ModeSymlink == os.ModeSymlink
+	metadata, err := o.metadata(absoluteFilePath, info, filesystemImpl)
+	if err != nil {
+		return nil, err
+	}
+	var content io.Reader
+	contentSize := metadata.Size
+	if isSymbolicLink {
+		linkTarget, err := readLinkTarget(absoluteFilePath, filesystemImpl)
+		if err != nil {
+			return nil, err
+		}
+		metadata.LinkTarget = linkTarget
+		content = strings.NewReader(linkTarget)
+		contentSize = int64(len(linkTarget))
+	} else {
+		f, err := filesystemImpl.Open(absoluteFilePath)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		defer func(f afero.File) {
+			err := f.Close()
+			if err != nil {
+				o.logger.Printf("WARNING: unable to close file %s in scanFile(): %v\n", absoluteFilePath, err)
+			}
+		}(f)
+		content = f
+	}
+
+	digests, size, err := hashReader(content, o.newHashers(metadata, contentSize))
+	if err != nil {
+		return nil, err
+	}
+	// some hashers (e.g. of the git scheme) have already hashed contentSize
+	if size != contentSize {
+		return nil, errors.Errorf("the size of %s changed from %d to %d bytes while it was scanned", absoluteFilePath,
+			contentSize, size)
+	}
+
+	file := o.newFile(digests, isSymbolicLink)
+	file.metadata = metadata
+	if !isSymbolicLink {
+		file.content = func() (io.ReadCloser, error) {
+			return filesystemImpl.Open(absoluteFilePath)
+		}
+	}
+	return file, nil
+}
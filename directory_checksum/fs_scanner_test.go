@@ -235,3 +235,16 @@ func TestScanWithDirectorySymlink(t *testing.T) {
 		t.Fatalf("Got\n%s\n\nwant\n%s", got, want)
 	}
 }
+
+func TestScanFileWhoseSizeChanged(t *testing.T) {
+	filesystemImpl := afero.NewMemMapFs()
+	TestingFile{absolutePath: "/f", content: "foo"}.Create(filesystemImpl)
+	info, _ := filesystemImpl.Stat("/f")
+	TestingFile{absolutePath: "/f", content: "foobar"}.Create(filesystemImpl)
+
+	for _, scheme := range []Scheme{DefaultScheme, GitScheme} {
+		if _, err := newScanOptions(WithScheme(scheme)).scanFile("/f", info, filesystemImpl); err == nil {
+			t.Fatalf("Expected error for %s but did not get any", scheme.Name)
+		}
+	}
+}
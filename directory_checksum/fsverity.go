@@ -0,0 +1,176 @@
+package directory_checksum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/go-errors/errors"
+	"hash"
+	"io/fs"
+)
+
+const (
+	// fsVerityBlockSize is the size of the data and Merkle tree blocks. 4 KiB is the default of "fsverity enable" and
+	// "fsverity digest".
+	fsVerityBlockSize    = 4096
+	fsVerityLogBlockSize = 12
+	// FsVerityMaxSaltSize is the maximum size of the salt, in bytes.
+	FsVerityMaxSaltSize = 32
+)
+
+// fsVerityAlgorithmIDs maps the names of the hash algorithms that fs-verity supports to their ID in the descriptor.
+var fsVerityAlgorithmIDs = map[string]uint8{
+	SHA256.Name: 1,
+	SHA512.Name: 2,
+}
+
+// FsVerityScheme is the FsVeritySchemeWithSalt without salt.
+var FsVerityScheme = FsVeritySchemeWithSalt(nil)
+
+// FsVeritySchemeWithSalt returns a Scheme whose file checksums are the fs-verity file digests (as printed by
+// "fsverity digest" and used by "fsverity enable") of regular files, i.e. the hash of the fs-verity descriptor, which
+// contains the root of a Merkle tree over 4 KiB blocks. The salt (at most FsVerityMaxSaltSize bytes, may be nil) is
+// prepended to every hashed block. Symbolic links and directories have the checksums of the DefaultScheme. Use it
+// with the SHA256 or SHA512 algorithm.
+func FsVeritySchemeWithSalt(salt []byte) Scheme {
+	return Scheme{
+		Name: "fsverity",
+		newFileHasher: func(algorithm HashAlgorithm, metadata Metadata, contentSize int64) hash.Hash {
+			if metadata.Mode&fs.ModeSymlink != 0 {
+				return plainFileHasher(algorithm, metadata, contentSize)
+			}
+			return newFsVerityHasher(algorithm, salt)
+		},
+		directoryChecksum: func(d *Directory) (string, error) {
+			if _, ok := fsVerityAlgorithmIDs[d.options.hasher.Name]; !ok {
+				return "", errors.Errorf("the %s scheme requires the %s or %s algorithm", d.options.scheme.Name,
+					SHA256.Name, SHA512.Name)
+			}
+			if len(salt) > FsVerityMaxSaltSize {
+				return "", errors.Errorf("the fs-verity salt must not be longer than %d bytes", FsVerityMaxSaltSize)
+			}
+			return listingChecksum(d)
+		},
+	}
+}
+
+// fsVerityHasher is a hash.Hash that computes the fs-verity file digest of the content written to it. Only one
+// partial block per level of the Merkle tree is kept in memory.
+type fsVerityHasher struct {
+	algorithm HashAlgorithm
+	salt      []byte
+	// paddedSalt is the salt, padded with zeros to a multiple of the hash function's block size.
+	paddedSalt []byte
+	dataSize   uint64
+	dataBlock  []byte
+	// levels contains the partial block of each level of the Merkle tree, starting with the level of the hashes of
+	// the data blocks, and the number of hashes that were added to each level.
+	levels      [][]byte
+	levelCounts []int
+}
+
+// newFsVerityHasher returns a fsVerityHasher that uses the provided hash algorithm and salt.
+func newFsVerityHasher(algorithm HashAlgorithm, salt []byte) *fsVerityHasher {
+	h := &fsVerityHasher{algorithm: algorithm, salt: salt}
+	if len(salt) > 0 {
+		blockSize := algorithm.New().BlockSize()
+		h.paddedSalt = make([]byte, (len(salt)+blockSize-1)/blockSize*blockSize)
+		copy(h.paddedSalt, salt)
+	}
+	return h
+}
+
+// hashBlock returns the hash of the salt, followed by block, which is padded with zeros to fsVerityBlockSize.
+func (h *fsVerityHasher) hashBlock(block []byte) []byte {
+	hasher := h.algorithm.New()
+	hasher.Write(h.paddedSalt)
+	hasher.Write(block)
+	hasher.Write(make([]byte, fsVerityBlockSize-len(block)))
+	return hasher.Sum(nil)
+}
+
+// addHash adds a hash to the provided level of the Merkle tree. The block of the level is only hashed (and added to
+// the next level) once it is full and another hash needs to be added, so that the root block is never hashed twice.
+func (h *fsVerityHasher) addHash(level int, blockHash []byte) {
+	if level == len(h.levels) {
+		h.levels = append(h.levels, nil)
+		h.levelCounts = append(h.levelCounts, 0)
+	}
+	if len(h.levels[level])+len(blockHash) > fsVerityBlockSize {
+		h.addHash(level+1, h.hashBlock(h.levels[level]))
+		h.levels[level] = h.levels[level][:0]
+	}
+	h.levels[level] = append(h.levels[level], blockHash...)
+	h.levelCounts[level]++
+}
+
+func (h *fsVerityHasher) Write(p []byte) (int, error) {
+	written := len(p)
+	h.dataSize += uint64(written)
+	for len(p) > 0 {
+		n := min(fsVerityBlockSize-len(h.dataBlock), len(p))
+		h.dataBlock = append(h.dataBlock, p[:n]...)
+		p = p[n:]
+		if len(h.dataBlock) == fsVerityBlockSize {
+			h.addHash(0, h.hashBlock(h.dataBlock))
+			h.dataBlock = h.dataBlock[:0]
+		}
+	}
+	return written, nil
+}
+
+// rootHash returns the root hash of the Merkle tree, which is all zeros for empty files, and the hash of the only
+// data block for files that are not larger than one block. Like Sum, it does not change the state of h.
+func (h *fsVerityHasher) rootHash() []byte {
+	if h.dataSize == 0 {
+		return make([]byte, h.Size())
+	}
+	finalizer := &fsVerityHasher{algorithm: h.algorithm, paddedSalt: h.paddedSalt,
+		levelCounts: append([]int(nil), h.levelCounts...)}
+	for _, level := range h.levels {
+		finalizer.levels = append(finalizer.levels, bytes.Clone(level))
+	}
+	if len(h.dataBlock) > 0 {
+		finalizer.addHash(0, finalizer.hashBlock(h.dataBlock))
+	}
+	if finalizer.levelCounts[0] == 1 {
+		return finalizer.levels[0]
+	}
+	for level := 0; ; level++ {
+		if level == len(finalizer.levels)-1 {
+			return finalizer.hashBlock(finalizer.levels[level])
+		}
+		finalizer.addHash(level+1, finalizer.hashBlock(finalizer.levels[level]))
+	}
+}
+
+func (h *fsVerityHasher) Sum(b []byte) []byte {
+	descriptor := make([]byte, 0, 256)
+	descriptor = append(descriptor, 1, fsVerityAlgorithmIDs[h.algorithm.Name], fsVerityLogBlockSize, uint8(len(h.salt)))
+	descriptor = binary.LittleEndian.AppendUint32(descriptor, 0)
+	descriptor = binary.LittleEndian.AppendUint64(descriptor, h.dataSize)
+	rootHash := make([]byte, 64)
+	copy(rootHash, h.rootHash())
+	salt := make([]byte, FsVerityMaxSaltSize)
+	copy(salt, h.salt)
+	descriptor = append(append(descriptor, rootHash...), salt...)
+	descriptor = append(descriptor, make([]byte, 144)...)
+
+	hasher := h.algorithm.New()
+	hasher.Write(descriptor)
+	return hasher.Sum(b)
+}
+
+func (h *fsVerityHasher) Reset() {
+	h.dataSize = 0
+	h.dataBlock = h.dataBlock[:0]
+	h.levels = nil
+	h.levelCounts = nil
+}
+
+func (h *fsVerityHasher) Size() int {
+	return h.algorithm.New().Size()
+}
+
+func (h *fsVerityHasher) BlockSize() int {
+	return fsVerityBlockSize
+}
@@ -0,0 +1,140 @@
+package directory_checksum
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fsVerityTestData returns size bytes of deterministic test data.
+func fsVerityTestData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte((i*7 + 3) % 251)
+	}
+	return data
+}
+
+func TestFsVerityHasher(t *testing.T) {
+	// Expected values were computed with an independent implementation of the fs-verity file digest. The digest of the
+	// empty file matches "fsverity digest" of an empty file.
+	tests := []struct {
+		size       int
+		sha256     string
+		saltSHA256 string
+	}{
+		{0, "3d248ca542a24fc62d1c43b916eae5016878e2533c88238480b26128a1f1af95",
+			"4c6bcdafe644dc5ea2924e07eacdada63195a2d45702128ade89cb722e4eac50"},
+		{1, "83334d2a5a79c35ecec7b206551570ffb7c723db2fb0ea790e9f63bfb4992858",
+			"ef8bd1882e0f1e552990610b2536540b543bb35896eeea481f39dc56bbe52fad"},
+		{4096, "1c628b821895d32da6e3899489770f6608770849d3e6d90ebd9869e5d65e2546",
+			"cce90dfdf1198d8ddf4a461493accf0baac8983a0edc6c56ade0dd75a0807c29"},
+		{4097, "1881b167d9647d6bef2fef2ff235b6d81cbc5b2202fea369a2f4f4a957263fc2",
+			"339586984f66e8109c9c742caa2e6677b9bb4a4919596d13b0721d86affeb96e"},
+		{128 * 4096, "44b3928833992f50109130b8c413caedc29b66e03dd565d85e992cc349d02545",
+			"7ddf1b4a05f664fa12b381ba2430d84636887ff9939928bc595e92ded93d8c02"},
+		{128*4096 + 1, "a16badc6577bcf7f8358d0fa8c17a5334aad2a7d367c6f5d4bc877dca54d0932",
+			"14404e167a0518359fad24e92d082f481c896a4694646f5bb99771786ce3dffc"},
+		{129 * 4096, "81185c1321848ec97a0e90a90e3edb1dc5e9e1f6cf7fbd15a7f8a515cc6c6170",
+			"faba95118eed2200b47663b528b912128b9257f8ca1e1dc15afbd12b67dcb2ef"},
+	}
+	for _, test := range tests {
+		data := fsVerityTestData(test.size)
+		for salt, want := range map[string]string{"": test.sha256, "salt": test.saltSHA256} {
+			hasher := newFsVerityHasher(SHA256, []byte(salt))
+			// write in uneven pieces, to cover blocks that are filled by several writes
+			for remaining := data; len(remaining) > 0; {
+				n := min(1000, len(remaining))
+				hasher.Write(remaining[:n])
+				remaining = remaining[n:]
+			}
+			if got := hex.EncodeToString(hasher.Sum(nil)); got != want {
+				t.Fatalf("Got digest %s for size %d and salt '%s', want %s", got, test.size, salt, want)
+			}
+		}
+	}
+}
+
+func TestFsVerityHasherSHA512(t *testing.T) {
+	hasher := newFsVerityHasher(SHA512, nil)
+	hasher.Write(fsVerityTestData(4097))
+	if got := hex.EncodeToString(hasher.Sum(nil)); !strings.HasPrefix(got, "af927db14784df4e") {
+		t.Fatalf("Got digest %s", got)
+	}
+}
+
+func TestFsVerityScheme(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "f"), fsVerityTestData(4097), 0644)
+	os.WriteFile(filepath.Join(tempDir, "e"), nil, 0644)
+
+	d, err := ScanDirectory(tempDir, afero.NewOsFs(), WithHasher(SHA256), WithScheme(FsVerityScheme))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err = d.ComputeDirectoryChecksums(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	file, _ := d.Lookup("f")
+	if file.Checksum() != "1881b167d9647d6bef2fef2ff235b6d81cbc5b2202fea369a2f4f4a957263fc2" {
+		t.Fatalf("Got checksum %s of f", file.Checksum())
+	}
+
+	// the directory checksum is computed from the listing, like in the default scheme
+	want := listingTreeChecksum(t, map[string]string{
+		"e": "3d248ca542a24fc62d1c43b916eae5016878e2533c88238480b26128a1f1af95",
+		"f": "1881b167d9647d6bef2fef2ff235b6d81cbc5b2202fea369a2f4f4a957263fc2",
+	})
+	if d.Checksum() != want {
+		t.Fatalf("Got root checksum %s, want %s", d.Checksum(), want)
+	}
+}
+
+func TestFsVerityWithSaltScheme(t *testing.T) {
+	d, _ := NewTree(WithHasher(SHA256), WithScheme(FsVeritySchemeWithSalt([]byte("salt")))).
+		AddFile("f", bytes.NewReader(fsVerityTestData(1))).
+		AddSymlink("l", "f").
+		Build()
+	if _, err := d.ComputeDirectoryChecksums(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	file, _ := d.Lookup("f")
+	if file.Checksum() != "ef8bd1882e0f1e552990610b2536540b543bb35896eeea481f39dc56bbe52fad" {
+		t.Fatalf("Got checksum %s of f", file.Checksum())
+	}
+	// symbolic links are hashed like in the default scheme
+	link, _ := d.Lookup("l")
+	if link.Checksum() != "252f10c83610ebca1a059c0bae8255eba2f95be4d1d7bcfa89d7248a82d9f111" {
+		t.Fatalf("Got checksum %s of l", link.Checksum())
+	}
+}
+
+func TestFsVerityErrors(t *testing.T) {
+	d, _ := NewTree(WithHasher(SHA1), WithScheme(FsVerityScheme)).AddFile("f", strings.NewReader("foo")).Build()
+	if _, err := d.ComputeDirectoryChecksums(); err == nil {
+		t.Fatal("Expected error for the sha1 algorithm but did not get any")
+	}
+	salt := bytes.Repeat([]byte("x"), FsVerityMaxSaltSize+1)
+	d, _ = NewTree(WithHasher(SHA256), WithScheme(FsVeritySchemeWithSalt(salt))).Build()
+	if _, err := d.ComputeDirectoryChecksums(); err == nil {
+		t.Fatal("Expected error for a salt that is too long but did not get any")
+	}
+}
+
+// listingTreeChecksum returns the checksum of a directory that only contains regular files with the provided names and
+// checksums, computed like in the default scheme.
+func listingTreeChecksum(t *testing.T, files map[string]string) string {
+	d := newDirectory(newScanOptions(WithHasher(SHA256)))
+	for name, checksum := range files {
+		d.files[name] = &File{checksum: checksum}
+	}
+	checksum, err := d.ComputeDirectoryChecksums()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return checksum
+}
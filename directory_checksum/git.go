@@ -0,0 +1,90 @@
+package directory_checksum
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-errors/errors"
+	"hash"
+	"sort"
+)
+
+const (
+	gitModeTree       = "40000"
+	gitModeFile       = "100644"
+	gitModeExecutable = "100755"
+	gitModeSymlink    = "120000"
+	// gitDirName is the name of git's own directory, which git never tracks.
+	gitDirName = ".git"
+)
+
+// gitFileHasher returns a hash.Hash that computes the ID of the git blob object that stores the file's content (or a
+// symbolic link's target), which is the hash of the header "blob <size>\0", followed by the content.
+func gitFileHasher(algorithm HashAlgorithm, _ Metadata, contentSize int64) hash.Hash {
+	hasher := algorithm.New()
+	_, _ = fmt.Fprintf(hasher, "blob %d\x00", contentSize)
+	return hasher
+}
+
+// gitTreeEntry is one entry of a git tree object.
+type gitTreeEntry struct {
+	mode     string
+	name     string
+	checksum string
+}
+
+// sortKey returns the key by which git sorts tree entries, which is the name, with a slash appended for trees.
+func (e gitTreeEntry) sortKey() string {
+	if e.mode == gitModeTree {
+		return e.name + "/"
+	}
+	return e.name
+}
+
+// gitTreeChecksum returns the ID of the git tree object that represents d. Like in git, (transitively) empty
+// directories, as well as ".git" directories, are omitted. The mode of files is 100755 if the owner may execute them,
+// and 100644 otherwise.
+func gitTreeChecksum(d *Directory) (string, error) {
+	if err := d.computeChildDirectoryChecksums(); err != nil {
+		return "", err
+	}
+	emptyTreeChecksum := gitObjectID(d.options.hasher, "tree", nil)
+	var entries []gitTreeEntry
+	for name, subDir := range d.dirs {
+		if name != gitDirName && subDir.checksum != emptyTreeChecksum {
+			entries = append(entries, gitTreeEntry{mode: gitModeTree, name: name, checksum: subDir.checksum})
+		}
+	}
+	for name, file := range d.files {
+		if name == gitDirName {
+			continue
+		}
+		mode := gitModeFile
+		if file.isSymbolicLink {
+			mode = gitModeSymlink
+		} else if file.metadata.Mode&0100 != 0 {
+			mode = gitModeExecutable
+		}
+		entries = append(entries, gitTreeEntry{mode: mode, name: name, checksum: file.checksum})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].sortKey() < entries[j].sortKey() })
+
+	content := bytes.Buffer{}
+	for _, entry := range entries {
+		rawChecksum, err := hex.DecodeString(entry.checksum)
+		if err != nil {
+			return "", errors.Errorf("invalid checksum of '%s': %v", entry.name, err)
+		}
+		content.WriteString(entry.mode + " " + entry.name + "\x00")
+		content.Write(rawChecksum)
+	}
+	return gitObjectID(d.options.hasher, "tree", content.Bytes()), nil
+}
+
+// gitObjectID returns the ID of the git object with the provided type and content.
+func gitObjectID(algorithm HashAlgorithm, objectType string, content []byte) string {
+	hasher := algorithm.New()
+	_, _ = fmt.Fprintf(hasher, "%s %d\x00", objectType, len(content))
+	hasher.Write(content)
+	return hex.EncodeToString(hasher.Sum(nil))
+}
@@ -0,0 +1,77 @@
+package directory_checksum
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitScheme(t *testing.T) {
+	tempDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tempDir, "d"), 0755)
+	os.MkdirAll(filepath.Join(tempDir, "e", "f"), 0755)
+	os.MkdirAll(filepath.Join(tempDir, ".git"), 0755)
+	os.WriteFile(filepath.Join(tempDir, "d", "f"), []byte("foo"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "d.x"), []byte("bar"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "run"), []byte("#!"), 0755)
+	os.WriteFile(filepath.Join(tempDir, ".git", "HEAD"), []byte("ref: refs/heads/main"), 0644)
+	if err := os.Symlink("d/f", filepath.Join(tempDir, "link")); err != nil {
+		t.Skipf("Test skipped because creating the symbolic link failed (most likely cause is Windows, where "+
+			"admin privileges are required). Error: %v", err)
+	}
+
+	d, err := ScanDirectory(tempDir, afero.NewOsFs(), WithScheme(GitScheme))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d.ComputeDirectoryChecksums()
+
+	// Expected values were computed with "git rev-parse HEAD^{tree}" and "git rev-parse HEAD:d"
+	if d.Checksum() != "1281ac1bbfa83de6ef344327d8494b95b2ccc9df" {
+		t.Fatalf("Got root checksum %s", d.Checksum())
+	}
+	subDir, _ := d.Lookup("d")
+	if subDir.Checksum() != "304bb15ca62045cff6504482fd8589113a5931bb" {
+		t.Fatalf("Got checksum %s of d", subDir.Checksum())
+	}
+}
+
+func TestGitSchemeTreeBuilder(t *testing.T) {
+	d, _ := NewTree(WithScheme(GitScheme), WithExtraHashers(SHA1)).
+		AddFile("d/f", strings.NewReader("foo")).
+		AddDir("empty/inner").
+		Build()
+	d.ComputeDirectoryChecksums()
+
+	file, _ := d.Lookup("d/f")
+	if file.Checksum() != "19102815663d23f8b75a47e7a01965dcdc96468c" {
+		t.Fatalf("Got blob ID %s", file.Checksum())
+	}
+	subDir, _ := d.Lookup("d")
+	// empty directories are omitted, so the root tree only contains d
+	wantRoot := gitObjectID(SHA1, "tree", append([]byte("40000 d\x00"), mustDecodeHex(subDir.Checksum())...))
+	if d.Checksum() != wantRoot {
+		t.Fatalf("Got root checksum %s, want %s", d.Checksum(), wantRoot)
+	}
+
+	// the checksum list contains the plain digests, not the blob IDs
+	buffer := bytes.Buffer{}
+	if err := d.WriteChecksumList(&buffer, false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33  d/f\n"; buffer.String() != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", buffer.String(), want)
+	}
+	if err := d.WriteManifest(&buffer); err == nil {
+		t.Fatal("Expected error but did not get any")
+	}
+}
+
+func mustDecodeHex(s string) []byte {
+	decoded, _ := hex.DecodeString(s)
+	return decoded
+}
@@ -0,0 +1,165 @@
+package directory_checksum
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-errors/errors"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// goH1Prefix is the prefix of the hashes created by the Hash1 algorithm of golang.org/x/mod/sumdb/dirhash.
+	goH1Prefix = "h1:"
+	// goModSuffix is appended to the version of go.sum entries that refer to a module's go.mod file.
+	goModSuffix = "/go.mod"
+)
+
+// GoH1Scheme is the GoModuleScheme without module prefix. It is the Scheme that SchemeByName returns for "go-h1".
+var GoH1Scheme = GoModuleScheme("")
+
+// GoModuleScheme returns a Scheme that computes the checksum of a directory like the Hash1 algorithm of
+// golang.org/x/mod/sumdb/dirhash (as used for the "h1:" hashes in go.sum files): the hash of a summary that has one
+// line per regular file below the directory, consisting of the file's SHA-256 digest and its slash-separated path,
+// which is relative to the directory and prefixed with modulePrefix ("<module path>@<version>"). Files are plain
+// content hashes. Use it with the SHA256 algorithm; FormatGoH1 converts a checksum to the "h1:" notation.
+func GoModuleScheme(modulePrefix string) Scheme {
+	return Scheme{
+		Name:          "go-h1",
+		newFileHasher: plainFileHasher,
+		directoryChecksum: func(d *Directory) (string, error) {
+			return goH1DirectoryChecksum(d, modulePrefix)
+		},
+	}
+}
+
+// goH1DirectoryChecksum returns the hash of the dirhash summary of all regular files below d (see GoModuleScheme).
+func goH1DirectoryChecksum(d *Directory, modulePrefix string) (string, error) {
+	if d.options.hasher.Name != SHA256.Name {
+		return "", errors.Errorf("the %s scheme requires the %s algorithm", d.options.scheme.Name, SHA256.Name)
+	}
+	if err := d.computeChildDirectoryChecksums(); err != nil {
+		return "", err
+	}
+	files := map[string]string{}
+	err := d.Walk(func(relativePath string, entry Entry) error {
+		if entry.Type() == TypeSymlink {
+			return errors.Errorf("'%s' is a symbolic link, which Go modules cannot contain", relativePath)
+		}
+		if entry.Type() == TypeFile {
+			files[path.Join(modulePrefix, filepath.ToSlash(relativePath))] = entry.Checksum()
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return goH1Summary(files)
+}
+
+// goH1Summary returns the hash (in hexadecimal notation) of the dirhash summary of files, which maps from the
+// slash-separated file names to the SHA-256 digests of their content.
+func goH1Summary(files map[string]string) (string, error) {
+	summary := sha256.New()
+	for _, name := range sortedKeys(files) {
+		if strings.Contains(name, "\n") {
+			return "", errors.Errorf("file names with newlines are not supported: %q", name)
+		}
+		if _, err := fmt.Fprintf(summary, "%s  %s\n", files[name], name); err != nil {
+			return "", errors.Wrap(err, 0)
+		}
+	}
+	return hex.EncodeToString(summary.Sum(nil)), nil
+}
+
+// FormatGoH1 converts a checksum computed with GoModuleScheme (in hexadecimal notation) to the "h1:<base64>" notation
+// used in go.sum files.
+func FormatGoH1(checksum string) (string, error) {
+	rawChecksum, err := hex.DecodeString(checksum)
+	if err != nil {
+		return "", errors.Errorf("invalid checksum '%s': %v", checksum, err)
+	}
+	return goH1Prefix + base64.StdEncoding.EncodeToString(rawChecksum), nil
+}
+
+// GoModH1 returns the "h1:" hash of a go.mod file with the provided content, as stored in the go.sum entries whose
+// version ends with "/go.mod".
+func GoModH1(content io.Reader) (string, error) {
+	digests, _, err := digestReader(content, []HashAlgorithm{SHA256})
+	if err != nil {
+		return "", err
+	}
+	checksum, err := goH1Summary(map[string]string{"go.mod": digests[0]})
+	if err != nil {
+		return "", err
+	}
+	return FormatGoH1(checksum)
+}
+
+// A GoSumEntry is one line of a go.sum file. For entries that refer to the go.mod file of a module, Version ends with
+// "/go.mod" (see IsGoMod).
+type GoSumEntry struct {
+	Module  string
+	Version string
+	Hash    string
+}
+
+// IsGoMod returns true if the entry refers to the go.mod file of the module, rather than to the whole module.
+func (e GoSumEntry) IsGoMod() bool {
+	return strings.HasSuffix(e.Version, goModSuffix)
+}
+
+// ModuleVersion returns the version of the module, without the "/go.mod" suffix.
+func (e GoSumEntry) ModuleVersion() string {
+	return strings.TrimSuffix(e.Version, goModSuffix)
+}
+
+// String returns the entry in the format of a go.sum line (without line break).
+func (e GoSumEntry) String() string {
+	return fmt.Sprintf("%s %s %s", e.Module, e.Version, e.Hash)
+}
+
+// ReadGoSum parses a go.sum file. Only entries with "h1:" hashes are returned, because no other hash algorithm is
+// defined. Empty lines are ignored.
+func ReadGoSum(r io.Reader) ([]GoSumEntry, error) {
+	var entries []GoSumEntry
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, errors.Errorf("invalid go.sum line %d: expected 3 fields, got %d", lineNumber, len(fields))
+		}
+		if strings.HasPrefix(fields[2], goH1Prefix) {
+			entries = append(entries, GoSumEntry{Module: fields[0], Version: fields[1], Hash: fields[2]})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return entries, nil
+}
+
+// EscapeModulePath escapes a module path or version the way the Go module cache does in its directory names:
+// every upper-case ASCII letter is replaced by an exclamation mark followed by the lower-case letter.
+func EscapeModulePath(modulePath string) string {
+	builder := strings.Builder{}
+	for _, r := range modulePath {
+		if 'A' <= r && r <= 'Z' {
+			builder.WriteRune('!')
+			builder.WriteRune(r - 'A' + 'a')
+		} else {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
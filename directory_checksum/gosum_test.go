@@ -0,0 +1,95 @@
+package directory_checksum
+
+import (
+	"strings"
+	"testing"
+)
+
+func buildGoModule(t *testing.T, modulePrefix string) *Directory {
+	d, err := NewTree(WithHasher(SHA256), WithScheme(GoModuleScheme(modulePrefix))).
+		AddFile("a/b.txt", strings.NewReader("foo")).
+		AddFile("go.mod", strings.NewReader("module example.com/m\n")).
+		AddFile("Z", strings.NewReader("")).
+		AddDir("empty").
+		Build()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err = d.ComputeDirectoryChecksums(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return d
+}
+
+func TestGoModuleScheme(t *testing.T) {
+	d := buildGoModule(t, "example.com/m@v1.0.0")
+	h1, err := FormatGoH1(d.Checksum())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// expected value was computed with an independent implementation of dirhash.Hash1
+	if h1 != "h1:Nx8ORboKhAv+V+nOnzjQgilhlQri+DFg2IEzl+wteHo=" {
+		t.Fatalf("Got %s", h1)
+	}
+
+	// without prefix, the file names are relative to the directory
+	d = buildGoModule(t, "")
+	if d.Checksum() != "60208f6019a83e0dc95245f42c9a055dfff90017fea2fcb0c6c5c51141a6ee0c" {
+		t.Fatalf("Got checksum %s", d.Checksum())
+	}
+	subDir, _ := d.Lookup("a")
+	if subDir.Checksum() != "ee390305156fbd17be64c91d69ed1ece98f08fbe84630fc965a39cbdc3bec98d" {
+		t.Fatalf("Got checksum %s of a", subDir.Checksum())
+	}
+}
+
+func TestGoModuleSchemeErrors(t *testing.T) {
+	d, _ := NewTree(WithHasher(SHA1), WithScheme(GoH1Scheme)).AddFile("f", strings.NewReader("foo")).Build()
+	if _, err := d.ComputeDirectoryChecksums(); err == nil {
+		t.Fatal("Expected error for the sha1 algorithm but did not get any")
+	}
+	d, _ = NewTree(WithHasher(SHA256), WithScheme(GoH1Scheme)).AddSymlink("l", "f").Build()
+	if _, err := d.ComputeDirectoryChecksums(); err == nil {
+		t.Fatal("Expected error for a symbolic link but did not get any")
+	}
+}
+
+func TestGoModH1(t *testing.T) {
+	// go.mod of github.com/go-errors/errors v1.5.1, whose hash is taken from this repository's go.sum
+	goMod := "module github.com/go-errors/errors\n\ngo 1.14\n\n" +
+		"// Was not API-compatible with earlier or later releases.\nretract v1.3.0\n"
+	h1, err := GoModH1(strings.NewReader(goMod))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if h1 != "h1:sIVyrIiJhuEF+Pj9Ebtd6P/rEYROXFi3BopGUQ5a5Og=" {
+		t.Fatalf("Got %s", h1)
+	}
+}
+
+func TestReadGoSum(t *testing.T) {
+	entries, err := ReadGoSum(strings.NewReader("example.com/a v1.0.0 h1:abc=\n\n" +
+		"example.com/a v1.0.0/go.mod h1:def=\nexample.com/b v0.1.0 h2:ghi=\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Got %d entries, want 2", len(entries))
+	}
+	if entries[0].IsGoMod() || !entries[1].IsGoMod() || entries[1].ModuleVersion() != "v1.0.0" {
+		t.Fatalf("Got unexpected entries %v", entries)
+	}
+	if entries[1].String() != "example.com/a v1.0.0/go.mod h1:def=" {
+		t.Fatalf("Got %s", entries[1])
+	}
+
+	if _, err = ReadGoSum(strings.NewReader("example.com/a v1.0.0\n")); err == nil {
+		t.Fatal("Expected error but did not get any")
+	}
+}
+
+func TestEscapeModulePath(t *testing.T) {
+	if got := EscapeModulePath("github.com/BurntSushi/toml"); got != "github.com/!burnt!sushi/toml" {
+		t.Fatalf("Got %s", got)
+	}
+}
@@ -0,0 +1,479 @@
+package directory_checksum
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// The names of whiteout files in image layers, see https://github.com/opencontainers/image-spec/blob/main/layer.md.
+const (
+	imageWhiteoutPrefix     = ".wh."
+	imageWhiteoutMetaPrefix = ".wh..wh."
+	imageOpaqueWhiteout     = ".wh..wh..opq"
+)
+
+// The annotations that OCI image layouts use to name the images of their index.json, and that BuildKit uses to mark
+// attestation manifests in image indexes.
+const (
+	ociRefNameAnnotation       = "org.opencontainers.image.ref.name"
+	containerdNameAnnotation   = "io.containerd.image.name"
+	dockerReferenceTypeKey     = "vnd.docker.reference.type"
+	dockerAttestationReference = "attestation-manifest"
+)
+
+// imageMaxIndexDepth is the maximum nesting depth of image indexes.
+const imageMaxIndexDepth = 8
+
+// defaultPlatformVariants are the variants of architectures that platforms without variant imply.
+var defaultPlatformVariants = map[string]string{"arm64": "v8", "arm": "v7"}
+
+// ImageOptions select the image of an OCI image layout or "docker save" archive that contains several images.
+type ImageOptions struct {
+	// Reference selects the image by its tag in "docker save" archives (e.g. "app:1.0"), or by the
+	// "org.opencontainers.image.ref.name" or "io.containerd.image.name" annotation in OCI image layouts.
+	Reference string
+	// Platform selects the image of a multi-platform image, e.g. "linux/amd64" or "linux/arm64/v8".
+	Platform string
+}
+
+// An Image is a container image, whose root file system is the result of applying its Layers in order.
+type Image struct {
+	Layers []ImageLayer
+	closer io.Closer
+}
+
+// An ImageLayer is a layer of an Image.
+type ImageLayer struct {
+	// Digest is the digest of the (usually compressed) layer, e.g. "sha256:a3ed95ca...". It is empty for layers of
+	// "docker save" archives in the legacy format, which stores layers under their ID.
+	Digest string
+	// DiffID is the digest of the uncompressed layer, as listed in the image configuration.
+	DiffID string
+	// CreatedBy is the command that created the layer (e.g. a RUN instruction), taken from the history of the image
+	// configuration. It is empty if the history is missing, or does not match the layers.
+	CreatedBy string
+	fsys      fs.FS
+	path      string
+}
+
+// imageDescriptor is an OCI content descriptor (see
+// https://github.com/opencontainers/image-spec/blob/main/descriptor.md), limited to the fields used here.
+type imageDescriptor struct {
+	Digest      string            `json:"digest"`
+	Platform    *imagePlatform    `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// imagePlatform is the platform of an imageDescriptor.
+type imagePlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+func (p imagePlatform) String() string {
+	if p.Variant == "" {
+		return p.OS + "/" + p.Architecture
+	}
+	return p.OS + "/" + p.Architecture + "/" + p.Variant
+}
+
+// matches returns true if the platform matches platform (e.g. "linux/arm64" or "linux/arm64/v8"). Like in containerd,
+// a missing variant of arm64 and arm platforms means "v8" and "v7", respectively.
+func (p imagePlatform) matches(platform string) bool {
+	other := imagePlatform{}
+	components := strings.SplitN(platform, "/", 3)
+	other.OS = components[0]
+	if len(components) > 1 {
+		other.Architecture = components[1]
+	}
+	if len(components) > 2 {
+		other.Variant = components[2]
+	}
+	return p.normalized() == other.normalized()
+}
+
+// normalized returns the platform with the default variant of its architecture, if it has no variant.
+func (p imagePlatform) normalized() imagePlatform {
+	if p.Variant == "" {
+		p.Variant = defaultPlatformVariants[p.Architecture]
+	}
+	return p
+}
+
+// imageManifest is an OCI (or Docker) image index or image manifest, limited to the fields used here. Indexes have
+// Manifests, image manifests have a Config and Layers.
+type imageManifest struct {
+	Manifests []imageDescriptor `json:"manifests"`
+	Config    *imageDescriptor  `json:"config"`
+	Layers    []imageDescriptor `json:"layers"`
+}
+
+// imageConfig is an OCI image configuration, limited to the fields used here.
+type imageConfig struct {
+	RootFS struct {
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+	History []imageHistory `json:"history"`
+}
+
+// imageHistory is an entry of the history of an imageConfig. Entries of instructions that did not create a layer
+// (such as ENV) are marked as EmptyLayer.
+type imageHistory struct {
+	CreatedBy  string `json:"created_by"`
+	EmptyLayer bool   `json:"empty_layer"`
+}
+
+// dockerArchiveManifest is an entry of the manifest.json file of a "docker save" archive.
+type dockerArchiveManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// OpenImage opens the image stored at path, which is either an OCI image layout directory, or a tar archive of one (as
+// created by "podman save --format=oci-archive") or of a "docker save" archive (as created by "docker save" and
+// "podman save"). Uncompressed tar archives are not read into memory, but the file is kept open until Close is
+// called.
+func OpenImage(path string, options ImageOptions) (*Image, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	if info.IsDir() {
+		return ReadImage(os.DirFS(path), options)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	var fsys fs.FS
+	magic, _ := bufio.NewReader(f).Peek(len(zstdMagic))
+	if bytes.HasPrefix(magic, gzipMagic) || bytes.Equal(magic, zstdMagic) {
+		// compressed archives cannot be read at random offsets
+		fsys, err = ReadArchive(io.NewSectionReader(f, 0, info.Size()))
+	} else {
+		fsys, err = newTarFileFS(f, info.Size())
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	image, err := ReadImage(fsys, options)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	image.closer = f
+	return image, nil
+}
+
+// ReadImage returns the image stored in fsys, which contains either an OCI image layout (i.e. an index.json file and
+// a blobs directory), or the extracted files of a "docker save" archive (i.e. a manifest.json file).
+func ReadImage(fsys fs.FS, options ImageOptions) (*Image, error) {
+	if _, err := fs.Stat(fsys, "manifest.json"); err == nil {
+		return readDockerArchive(fsys, options)
+	}
+	if _, err := fs.Stat(fsys, "index.json"); err == nil {
+		return readOCILayout(fsys, options)
+	}
+	return nil, errors.New("neither an OCI image layout (index.json) nor a \"docker save\" archive (manifest.json)")
+}
+
+// Close closes the file from which the image is read, if any.
+func (i *Image) Close() error {
+	if i.closer == nil {
+		return nil
+	}
+	return i.closer.Close()
+}
+
+// RootFS returns the root file system of the image, the result of applying all of its layers (see ApplyLayer).
+func (i *Image) RootFS() (*ArchiveFS, error) {
+	rootFS := NewArchiveFS()
+	for _, layer := range i.Layers {
+		if err := layer.ApplyTo(rootFS); err != nil {
+			return nil, err
+		}
+	}
+	return rootFS, nil
+}
+
+// A LayerSnapshot is the state of a directory of an image after applying one of its layers (see Image.ScanLayers).
+type LayerSnapshot struct {
+	Layer ImageLayer
+	// Directory is the scanned directory, with computed directory checksums. It is nil if the directory does not
+	// exist (yet) after applying the layer.
+	Directory *Directory
+}
+
+// ScanLayers applies the layers of the image in order, and scans the directory at root (a path in the notation of
+// io/fs, e.g. "app") of the resulting file system after each layer, with the provided options. Comparing the
+// snapshots of two images reveals the first layer after which the directory differs. ScanLayers also returns the root
+// file system after applying all layers, whose LayerOf method tells which layer last wrote an entry.
+func (i *Image) ScanLayers(root string, options ...ScanOption) ([]LayerSnapshot, *ArchiveFS, error) {
+	rootFS := NewArchiveFS()
+	var snapshots []LayerSnapshot
+	for _, layer := range i.Layers {
+		if err := layer.ApplyTo(rootFS); err != nil {
+			return nil, nil, err
+		}
+		snapshot := LayerSnapshot{Layer: layer}
+		if info, err := fs.Stat(rootFS, root); err == nil && info.IsDir() {
+			if snapshot.Directory, err = ScanFS(rootFS, root, options...); err != nil {
+				return nil, nil, err
+			}
+			if _, err := snapshot.Directory.ComputeDirectoryChecksums(); err != nil {
+				return nil, nil, err
+			}
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rootFS, nil
+}
+
+// ApplyTo applies the layer to archiveFS (see ApplyLayer), decompressing it if it is compressed with gzip or zstd.
+func (l ImageLayer) ApplyTo(archiveFS *ArchiveFS) error {
+	f, err := l.fsys.Open(l.path)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	defer f.Close()
+	tarReader, err := decompressedReader(bufio.NewReader(f))
+	if err != nil {
+		return err
+	}
+	defer tarReader.Close()
+	if err := archiveFS.ApplyLayer(tarReader); err != nil {
+		return errors.Errorf("unable to apply layer %s: %v", l.path, err)
+	}
+	return nil
+}
+
+// readJSON unmarshals the JSON file at name in fsys into v.
+func readJSON(fsys fs.FS, name string, v any) error {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.Errorf("invalid JSON in %s: %v", name, err)
+	}
+	return nil
+}
+
+// newImage returns the image with the layers at the provided paths in fsys, which are described by the image
+// configuration at configPath in fsys.
+func newImage(fsys fs.FS, layerPaths []string, configPath string) (*Image, error) {
+	var config imageConfig
+	if err := readJSON(fsys, configPath, &config); err != nil {
+		return nil, err
+	}
+	diffIDs := config.RootFS.DiffIDs
+	if len(layerPaths) != len(diffIDs) {
+		return nil, errors.Errorf("the image has %d layers, but its configuration lists %d diff IDs", len(layerPaths),
+			len(diffIDs))
+	}
+	var createdBy []string
+	for _, history := range config.History {
+		if !history.EmptyLayer {
+			createdBy = append(createdBy, history.CreatedBy)
+		}
+	}
+	if len(createdBy) != len(layerPaths) {
+		createdBy = make([]string, len(layerPaths))
+	}
+
+	image := &Image{}
+	for i, layerPath := range layerPaths {
+		layer := ImageLayer{DiffID: diffIDs[i], CreatedBy: createdBy[i], fsys: fsys, path: layerPath}
+		// layers of archives in the OCI format are stored as blobs, whose path contains the digest
+		if blob, isBlob := strings.CutPrefix(layerPath, "blobs/"); isBlob {
+			layer.Digest = strings.Replace(blob, "/", ":", 1)
+		}
+		image.Layers = append(image.Layers, layer)
+	}
+	return image, nil
+}
+
+// readDockerArchive returns the image of the extracted "docker save" archive in fsys.
+func readDockerArchive(fsys fs.FS, options ImageOptions) (*Image, error) {
+	var manifests []dockerArchiveManifest
+	if err := readJSON(fsys, "manifest.json", &manifests); err != nil {
+		return nil, err
+	}
+	var candidates []dockerArchiveManifest
+	var tags []string
+	for _, manifest := range manifests {
+		tags = append(tags, manifest.RepoTags...)
+		for _, tag := range manifest.RepoTags {
+			if tag == options.Reference {
+				candidates = append(candidates, manifest)
+			}
+		}
+	}
+	if options.Reference == "" {
+		candidates = manifests
+	}
+	if len(candidates) != 1 {
+		return nil, errors.Errorf("the archive contains %d images with the reference '%s', select one of the tags "+
+			"%s", len(candidates), options.Reference, strings.Join(tags, ", "))
+	}
+
+	var layerPaths []string
+	for _, layerPath := range candidates[0].Layers {
+		layerPaths = append(layerPaths, path.Clean(layerPath))
+	}
+	return newImage(fsys, layerPaths, path.Clean(candidates[0].Config))
+}
+
+// readOCILayout returns the image of the OCI image layout in fsys.
+func readOCILayout(fsys fs.FS, options ImageOptions) (*Image, error) {
+	var manifest imageManifest
+	if err := readJSON(fsys, "index.json", &manifest); err != nil {
+		return nil, err
+	}
+	for depth := 0; manifest.Config == nil; depth++ {
+		if depth == imageMaxIndexDepth {
+			return nil, errors.New("the image indexes are nested too deeply")
+		}
+		descriptor, err := selectImageDescriptor(manifest.Manifests, options, depth == 0)
+		if err != nil {
+			return nil, err
+		}
+		manifest = imageManifest{}
+		if err := readJSON(fsys, blobPath(descriptor.Digest), &manifest); err != nil {
+			return nil, err
+		}
+	}
+
+	var layerPaths []string
+	for _, layer := range manifest.Layers {
+		layerPaths = append(layerPaths, blobPath(layer.Digest))
+	}
+	return newImage(fsys, layerPaths, blobPath(manifest.Config.Digest))
+}
+
+// blobPath returns the path of the blob with the provided digest (e.g. "sha256:a3ed95ca...") in an OCI image layout.
+func blobPath(digest string) string {
+	algorithm, encoded, _ := strings.Cut(digest, ":")
+	return "blobs/" + algorithm + "/" + encoded
+}
+
+// selectImageDescriptor returns the one descriptor of an image index that matches the options. Attestation manifests
+// are ignored. The reference is only matched if isTopLevel is true, i.e. for the index.json file of an OCI image
+// layout.
+func selectImageDescriptor(descriptors []imageDescriptor, options ImageOptions,
+	isTopLevel bool) (imageDescriptor, error) {
+	var candidates []imageDescriptor
+	var names []string
+	for _, descriptor := range descriptors {
+		if descriptor.Annotations[dockerReferenceTypeKey] == dockerAttestationReference ||
+			descriptor.Platform != nil && descriptor.Platform.OS == "unknown" {
+			continue
+		}
+		name := descriptor.Digest
+		if descriptor.Platform != nil {
+			name = descriptor.Platform.String()
+		} else if refName, ok := descriptor.Annotations[ociRefNameAnnotation]; ok && isTopLevel {
+			name = refName
+		}
+		names = append(names, name)
+
+		if isTopLevel && options.Reference != "" && descriptor.Annotations[ociRefNameAnnotation] != options.Reference &&
+			descriptor.Annotations[containerdNameAnnotation] != options.Reference {
+			continue
+		}
+		if options.Platform != "" && descriptor.Platform != nil && !descriptor.Platform.matches(options.Platform) {
+			continue
+		}
+		candidates = append(candidates, descriptor)
+	}
+	if len(candidates) != 1 {
+		return imageDescriptor{}, errors.Errorf("the image index contains %d images that match the reference '%s' "+
+			"and platform '%s', select one of %s", len(candidates), options.Reference, options.Platform,
+			strings.Join(names, ", "))
+	}
+	return candidates[0], nil
+}
+
+// tarFileFS is a read-only fs.FS with the regular files of an uncompressed tar archive, which are read from their
+// offset in the archive when they are opened. Symbolic links and hard links to regular files are followed. It
+// does not support directories.
+type tarFileFS struct {
+	r       io.ReaderAt
+	headers map[string]*tar.Header
+	offsets map[string]int64
+}
+
+// newTarFileFS returns a tarFileFS for the tar archive of the provided size that is read from r.
+func newTarFileFS(r io.ReaderAt, size int64) (*tarFileFS, error) {
+	t := &tarFileFS{r: r, headers: map[string]*tar.Header{}, offsets: map[string]int64{}}
+	sectionReader := io.NewSectionReader(r, 0, size)
+	tarReader := tar.NewReader(sectionReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return t, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		// the tar.Reader does not read ahead, so the content starts at the current offset
+		offset, _ := sectionReader.Seek(0, io.SeekCurrent)
+		name := archivePath(header.Name)
+		t.headers[name], t.offsets[name] = header, offset
+	}
+}
+
+func (t *tarFileFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	resolvedName := name
+	for range archiveMaxSymlinks {
+		header := t.headers[resolvedName]
+		if header == nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		switch header.Typeflag {
+		case tar.TypeReg:
+			content := io.NewSectionReader(t.r, t.offsets[resolvedName], header.Size)
+			return &tarFileFSFile{SectionReader: content, info: header.FileInfo()}, nil
+		case tar.TypeSymlink:
+			if path.IsAbs(header.Linkname) {
+				resolvedName = archivePath(header.Linkname)
+			} else {
+				resolvedName = archivePath(path.Join(path.Dir(resolvedName), header.Linkname))
+			}
+		case tar.TypeLink:
+			resolvedName = archivePath(header.Linkname)
+		default:
+			return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("not a regular file")}
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("too many levels of symbolic links")}
+}
+
+// tarFileFSFile is an opened file of a tarFileFS.
+type tarFileFSFile struct {
+	*io.SectionReader
+	info fs.FileInfo
+}
+
+func (f *tarFileFSFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *tarFileFSFile) Close() error {
+	return nil
+}
@@ -0,0 +1,348 @@
+package directory_checksum
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// testImageLayers are the layers of the test images. The second layer removes a file and replaces the content of a
+// directory, the third one adds files to a directory that the second layer made opaque.
+var testImageLayers = [][]testTarEntry{
+	{
+		{name: "app/", typeFlag: tar.TypeDir},
+		{name: "app/old.txt", typeFlag: tar.TypeReg, content: "old"},
+		{name: "app/keep.txt", typeFlag: tar.TypeReg, content: "keep"},
+		{name: "etc/config/a", typeFlag: tar.TypeReg, content: "a"},
+		{name: "etc/config/b", typeFlag: tar.TypeReg, content: "b"},
+	},
+	{
+		{name: "app/.wh.old.txt", typeFlag: tar.TypeReg},
+		{name: "app/new.txt", typeFlag: tar.TypeReg, content: "new"},
+		{name: "etc/config/c", typeFlag: tar.TypeReg, content: "c"},
+		{name: "etc/config/.wh..wh..opq", typeFlag: tar.TypeReg},
+		{name: ".wh..wh.plnk/", typeFlag: tar.TypeDir},
+	},
+	{
+		{name: "etc/config/d", typeFlag: tar.TypeReg, content: "d"},
+		{name: "app/link", typeFlag: tar.TypeSymlink, linkname: "new.txt"},
+	},
+}
+
+// newTestImageRootFS returns the tree that results from applying testImageLayers.
+func newTestImageRootFS() *Directory {
+	d, _ := NewTree(WithHasher(SHA256)).
+		AddFile("app/keep.txt", strings.NewReader("keep")).
+		AddFile("app/new.txt", strings.NewReader("new")).
+		AddSymlink("app/link", "new.txt").
+		AddFile("etc/config/c", strings.NewReader("c")).
+		AddFile("etc/config/d", strings.NewReader("d")).
+		Build()
+	d.ComputeDirectoryChecksums()
+	return d
+}
+
+// sha256Digest returns the digest of data, e.g. "sha256:a3ed95ca...".
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// addBlob adds data as blob to the OCI image layout fsys, and returns its digest.
+func addBlob(fsys fstest.MapFS, data []byte) string {
+	digest := sha256Digest(data)
+	fsys[blobPath(digest)] = &fstest.MapFile{Data: data}
+	return digest
+}
+
+// addJSONBlob adds the JSON representation of v as blob to the OCI image layout fsys, and returns its descriptor.
+func addJSONBlob(t *testing.T, fsys fstest.MapFS, v any) imageDescriptor {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return imageDescriptor{Digest: addBlob(fsys, data)}
+}
+
+// newTestOCILayout returns an OCI image layout with a multi-platform image, whose linux/amd64 image has the
+// testImageLayers (gzip-compressed, created by "RUN layer <number>"), and an attestation manifest.
+func newTestOCILayout(t *testing.T) fstest.MapFS {
+	fsys := fstest.MapFS{"oci-layout": &fstest.MapFile{Data: []byte(`{"imageLayoutVersion":"1.0.0"}`)}}
+	var layers []imageDescriptor
+	config := imageConfig{History: []imageHistory{{CreatedBy: "ENV A=1", EmptyLayer: true}}}
+	for i, entries := range testImageLayers {
+		layer := newTestTar(t, entries...)
+		config.History = append(config.History, imageHistory{CreatedBy: fmt.Sprintf("RUN layer %d", i+1)})
+		compressed := bytes.Buffer{}
+		gzipWriter := gzip.NewWriter(&compressed)
+		gzipWriter.Write(layer)
+		gzipWriter.Close()
+		layers = append(layers, imageDescriptor{Digest: addBlob(fsys, compressed.Bytes())})
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, sha256Digest(layer))
+	}
+	configDescriptor := addJSONBlob(t, fsys, config)
+	amd64 := addJSONBlob(t, fsys, imageManifest{Config: &configDescriptor, Layers: layers})
+	amd64.Platform = &imagePlatform{OS: "linux", Architecture: "amd64"}
+
+	otherLayer := imageDescriptor{Digest: addBlob(fsys, newTestTar(t, testTarEntry{name: "arm", typeFlag: tar.TypeDir}))}
+	otherConfig := imageConfig{}
+	otherConfig.RootFS.DiffIDs = []string{otherLayer.Digest}
+	otherConfigDescriptor := addJSONBlob(t, fsys, otherConfig)
+	arm64 := addJSONBlob(t, fsys, imageManifest{Config: &otherConfigDescriptor, Layers: []imageDescriptor{otherLayer}})
+	arm64.Platform = &imagePlatform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+	attestation := addJSONBlob(t, fsys, imageManifest{Config: &otherConfigDescriptor})
+	attestation.Platform = &imagePlatform{OS: "unknown", Architecture: "unknown"}
+
+	imageIndex := addJSONBlob(t, fsys, imageManifest{Manifests: []imageDescriptor{amd64, arm64, attestation}})
+	imageIndex.Annotations = map[string]string{ociRefNameAnnotation: "1.0"}
+	index, _ := json.Marshal(imageManifest{Manifests: []imageDescriptor{imageIndex}})
+	fsys["index.json"] = &fstest.MapFile{Data: index}
+	return fsys
+}
+
+// newTestDockerArchive writes a "docker save" archive in the legacy format, whose image "app:1.0" has the
+// testImageLayers, to a file and returns its path. The layer directories contain symbolic links, like archives of
+// "docker save" do for layers that are shared by several images.
+func newTestDockerArchive(t *testing.T) string {
+	var entries []testTarEntry
+	var config imageConfig
+	manifest := dockerArchiveManifest{Config: "config.json", RepoTags: []string{"app:1.0"}}
+	for i, layerEntries := range testImageLayers {
+		layer := newTestTar(t, layerEntries...)
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, sha256Digest(layer))
+		layerDir := string(rune('a'+i)) + "/"
+		entries = append(entries, testTarEntry{name: layerDir, typeFlag: tar.TypeDir},
+			testTarEntry{name: layerDir + "data.tar", typeFlag: tar.TypeReg, content: string(layer)},
+			testTarEntry{name: layerDir + "layer.tar", typeFlag: tar.TypeSymlink, linkname: "data.tar"})
+		manifest.Layers = append(manifest.Layers, "./"+layerDir+"layer.tar")
+	}
+	configData, _ := json.Marshal(config)
+	manifestData, _ := json.Marshal([]dockerArchiveManifest{manifest})
+	entries = append(entries, testTarEntry{name: "config.json", typeFlag: tar.TypeReg, content: string(configData)},
+		testTarEntry{name: "manifest.json", typeFlag: tar.TypeReg, content: string(manifestData)})
+
+	archivePath := filepath.Join(t.TempDir(), "image.tar")
+	if err := os.WriteFile(archivePath, newTestTar(t, entries...), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return archivePath
+}
+
+// checkImageRootFS checks that the root file system of image equals newTestImageRootFS.
+func checkImageRootFS(t *testing.T, image *Image) {
+	rootFS, err := image.RootFS()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, err := ScanFS(rootFS, ".", WithHasher(SHA256))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got.ComputeDirectoryChecksums()
+	if differences := Compare(newTestImageRootFS(), got); len(differences) > 0 {
+		t.Fatalf("Got differences %v", differences)
+	}
+}
+
+func TestReadImageOCILayout(t *testing.T) {
+	fsys := newTestOCILayout(t)
+	image, err := ReadImage(fsys, ImageOptions{Platform: "linux/amd64"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer image.Close()
+	if len(image.Layers) != len(testImageLayers) {
+		t.Fatalf("Got %d layers, want %d", len(image.Layers), len(testImageLayers))
+	}
+	for _, layer := range image.Layers {
+		if !strings.HasPrefix(layer.Digest, "sha256:") || !strings.HasPrefix(layer.DiffID, "sha256:") ||
+			layer.Digest == layer.DiffID {
+			t.Fatalf("Got digest %s and diff ID %s", layer.Digest, layer.DiffID)
+		}
+	}
+	checkImageRootFS(t, image)
+
+	// the OCI image layout directory
+	dir := t.TempDir()
+	for name, file := range fsys {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(filepath.FromSlash(name))), 0755)
+		os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), file.Data, 0644)
+	}
+	image, err = OpenImage(dir, ImageOptions{Reference: "1.0", Platform: "linux/amd64"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkImageRootFS(t, image)
+}
+
+func TestReadImageSelection(t *testing.T) {
+	fsys := newTestOCILayout(t)
+	for _, options := range []ImageOptions{
+		{},
+		{Platform: "linux/arm64/v9"},
+		{Platform: "linux/arm"},
+		{Reference: "2.0", Platform: "linux/amd64"},
+	} {
+		if _, err := ReadImage(fsys, options); err == nil {
+			t.Fatalf("Expected error for %+v but did not get any", options)
+		}
+	}
+	// arm64 platforms without variant are v8
+	for _, platform := range []string{"linux/arm64/v8", "linux/arm64"} {
+		image, err := ReadImage(fsys, ImageOptions{Platform: platform})
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", platform, err)
+		}
+		if len(image.Layers) != 1 {
+			t.Fatalf("Got %d layers of the %s image", len(image.Layers), platform)
+		}
+	}
+
+	if _, err := ReadImage(fstest.MapFS{"a": &fstest.MapFile{}}, ImageOptions{}); err == nil {
+		t.Fatal("Expected error for a directory that contains no image but did not get any")
+	}
+}
+
+func TestOpenImageDockerArchive(t *testing.T) {
+	archivePath := newTestDockerArchive(t)
+	image, err := OpenImage(archivePath, ImageOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer image.Close()
+	if image.Layers[0].Digest != "" || !strings.HasPrefix(image.Layers[0].DiffID, "sha256:") {
+		t.Fatalf("Got digest %s and diff ID %s", image.Layers[0].Digest, image.Layers[0].DiffID)
+	}
+	checkImageRootFS(t, image)
+
+	if _, err := OpenImage(archivePath, ImageOptions{Reference: "app:2.0"}); err == nil {
+		t.Fatal("Expected error for a missing tag but did not get any")
+	}
+
+	// compressed archives are read into memory
+	data, _ := os.ReadFile(archivePath)
+	compressed := bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(&compressed)
+	gzipWriter.Write(data)
+	gzipWriter.Close()
+	os.WriteFile(archivePath, compressed.Bytes(), 0644)
+	image, err = OpenImage(archivePath, ImageOptions{Reference: "app:1.0"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer image.Close()
+	checkImageRootFS(t, image)
+}
+
+func TestTarFileFS(t *testing.T) {
+	long := strings.Repeat("x", 1000)
+	archive := newTestTar(t,
+		testTarEntry{name: "dir/", typeFlag: tar.TypeDir},
+		testTarEntry{name: "dir/f", typeFlag: tar.TypeReg, content: long},
+		testTarEntry{name: "dir/g", typeFlag: tar.TypeReg, content: "g"},
+		testTarEntry{name: "hard", typeFlag: tar.TypeLink, linkname: "dir/g"},
+		testTarEntry{name: "abs", typeFlag: tar.TypeSymlink, linkname: "/dir/f"},
+		testTarEntry{name: "loop", typeFlag: tar.TypeSymlink, linkname: "loop"},
+	)
+	fsys, err := newTarFileFS(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for name, want := range map[string]string{"dir/f": long, "hard": "g", "abs": long} {
+		if content, err := fs.ReadFile(fsys, name); err != nil || string(content) != want {
+			t.Fatalf("Got content %q and error %v of %s", content, err, name)
+		}
+	}
+	for _, name := range []string{"dir", "loop", "missing", "../dir/f"} {
+		if _, err := fsys.Open(name); err == nil {
+			t.Fatalf("Expected error for %s but did not get any", name)
+		}
+	}
+}
+
+func TestImageScanLayers(t *testing.T) {
+	image, _ := ReadImage(newTestOCILayout(t), ImageOptions{Platform: "linux/amd64"})
+	snapshots, rootFS, err := image.ScanLayers("app", WithHasher(SHA256))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	first, _ := NewTree(WithHasher(SHA256)).AddFile("keep.txt", strings.NewReader("keep")).
+		AddFile("old.txt", strings.NewReader("old")).Build()
+	second, _ := NewTree(WithHasher(SHA256)).AddFile("keep.txt", strings.NewReader("keep")).
+		AddFile("new.txt", strings.NewReader("new")).Build()
+	third, _ := NewTree(WithHasher(SHA256)).AddFile("keep.txt", strings.NewReader("keep")).
+		AddFile("new.txt", strings.NewReader("new")).AddSymlink("link", "new.txt").Build()
+	for i, want := range []*Directory{first, second, third} {
+		want.ComputeDirectoryChecksums()
+		snapshot := snapshots[i]
+		if snapshot.Layer.CreatedBy != fmt.Sprintf("RUN layer %d", i+1) {
+			t.Fatalf("Got created by %q for layer %d", snapshot.Layer.CreatedBy, i+1)
+		}
+		if differences := Compare(want, snapshot.Directory); len(differences) > 0 {
+			t.Fatalf("Got differences %v after layer %d", differences, i+1)
+		}
+	}
+
+	for name, want := range map[string]int{
+		".":            0,
+		"app":          2,
+		"app/keep.txt": 1,
+		"app/new.txt":  2,
+		"app/link":     3,
+		"etc/config":   2,
+		"etc/config/c": 2,
+		"etc/config/d": 3,
+	} {
+		if layer, err := rootFS.LayerOf(name); err != nil || layer != want {
+			t.Fatalf("Got layer %d and error %v for %s, want layer %d", layer, err, name, want)
+		}
+	}
+	if _, err := rootFS.LayerOf("app/old.txt"); err == nil {
+		t.Fatal("Expected error for a removed file but did not get any")
+	}
+
+	snapshots, _, err = image.ScanLayers("missing")
+	if err != nil || len(snapshots) != len(testImageLayers) || snapshots[2].Directory != nil {
+		t.Fatalf("Got snapshots %v and error %v for a missing directory", snapshots, err)
+	}
+}
+
+func TestImageScanLayersOpaqueWhiteout(t *testing.T) {
+	fsys := fstest.MapFS{
+		"lower": &fstest.MapFile{Data: newTestTar(t, testTarEntry{name: "a/sub/old", typeFlag: tar.TypeReg,
+			content: "old"})},
+		"upper": &fstest.MapFile{Data: newTestTar(t,
+			testTarEntry{name: "a/", typeFlag: tar.TypeDir},
+			testTarEntry{name: "a/sub/", typeFlag: tar.TypeDir},
+			testTarEntry{name: "a/sub/new", typeFlag: tar.TypeReg, content: "new"},
+			testTarEntry{name: "a/.wh..wh..opq", typeFlag: tar.TypeReg})},
+	}
+	image := &Image{Layers: []ImageLayer{{fsys: fsys, path: "lower"}, {fsys: fsys, path: "upper"}}}
+	snapshots, rootFS, err := image.ScanLayers("a", WithHasher(SHA256))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want, _ := NewTree(WithHasher(SHA256)).AddFile("sub/new", strings.NewReader("new")).Build()
+	want.ComputeDirectoryChecksums()
+	if differences := Compare(want, snapshots[1].Directory); len(differences) > 0 {
+		t.Fatalf("Got differences %v", differences)
+	}
+	for name, want := range map[string]int{"a": 2, "a/sub": 2, "a/sub/new": 2} {
+		if layer, err := rootFS.LayerOf(name); err != nil || layer != want {
+			t.Fatalf("Got layer %d and error %v for %s, want layer %d", layer, err, name, want)
+		}
+	}
+	if _, err := rootFS.LayerOf("a/sub/old"); err == nil {
+		t.Fatal("Expected error for a removed file but did not get any")
+	}
+}
@@ -0,0 +1,172 @@
+package directory_checksum
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Update re-scans the file or directory at relativePath (relative to d, which must be the root of a tree returned by
+// ScanDirectory or ScanFS) and replaces the corresponding entry of the tree. If the entry no longer exists on the file
+// system (or is now excluded by the Filter), it is removed from the tree. Only the Directory objects along
+// relativePath are marked as changed, so that the next call of ComputeDirectoryChecksums() only recomputes their
+// checksums (as well as the checksums of any re-scanned directory).
+func (d *Directory) Update(relativePath string) error {
+	if d.source == nil {
+		return errors.New("Update() is only supported on the root Directory of a scanned tree")
+	}
+	parent, name, err := d.parentOf(relativePath)
+	if err != nil {
+		return err
+	}
+	relativePath = filepath.Clean(filepath.FromSlash(relativePath))
+	absolutePath := filepath.Join(d.source.absoluteRootPath, relativePath)
+
+	info, _, err := lstatIfPossible(d.source.filesystemImpl, absolutePath)
+	if os.IsNotExist(err) {
+		delete(parent.dirs, name)
+		delete(parent.files, name)
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	// the entry is only replaced once it has been re-scanned successfully, so that errors leave the tree unchanged
+	if isInvalidFiletype(info.Mode()) {
+		d.options.logger.Printf("WARNING: skipping '%s' because it is of unsupported type: %s\n", relativePath,
+			getInvalidFiletypeAsString(info.Mode()))
+		delete(parent.dirs, name)
+		delete(parent.files, name)
+		return nil
+	}
+	if d.options.filter != nil && !d.options.filter(relativePath, info) {
+		delete(parent.dirs, name)
+		delete(parent.files, name)
+		return nil
+	}
+
+	if info.IsDir() {
+		subtreeOptions := *d.options
+		if d.options.filter != nil {
+			subtreeOptions.filter = func(subtreeRelativePath string, info os.FileInfo) bool {
+				return d.options.filter(filepath.Join(relativePath, subtreeRelativePath), info)
+			}
+		}
+		subDir, err := scanDirectory(absolutePath, d.source.filesystemImpl, &subtreeOptions)
+		if err != nil {
+			return errors.Wrap(err, 0)
+		}
+		subDir.source = nil
+		for _, entry := range subDir.PostOrder() {
+			if dir, ok := entry.(*Directory); ok {
+				dir.options = d.options
+			}
+		}
+		delete(parent.files, name)
+		parent.dirs[name] = subDir
+		return nil
+	}
+
+	file, err := d.options.scanFile(absolutePath, info, d.source.filesystemImpl)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	delete(parent.dirs, name)
+	parent.files[name] = file
+	return nil
+}
+
+// Remove removes the file or directory at relativePath (relative to d) from the tree, without modifying the file
+// system. Only the Directory objects along relativePath are marked as changed.
+func (d *Directory) Remove(relativePath string) error {
+	parent, name, err := d.parentOf(relativePath)
+	if err != nil {
+		return err
+	}
+	if _, ok := parent.dirs[name]; ok {
+		delete(parent.dirs, name)
+		return nil
+	}
+	if _, ok := parent.files[name]; ok {
+		delete(parent.files, name)
+		return nil
+	}
+	return errors.Errorf("unable to remove '%s': no such file or directory in the tree", relativePath)
+}
+
+// Rename moves the file or directory at oldRelativePath to newRelativePath (both relative to d) within the tree,
+// without modifying the file system. An entry that already exists at newRelativePath is replaced. The parent directory
+// of newRelativePath must already exist in the tree. Only the Directory objects along both paths are marked as changed.
+func (d *Directory) Rename(oldRelativePath string, newRelativePath string) error {
+	oldParent, oldName, err := d.parentOf(oldRelativePath)
+	if err != nil {
+		return err
+	}
+	subDir, isDir := oldParent.dirs[oldName]
+	file, isFile := oldParent.files[oldName]
+	if !isDir && !isFile {
+		return errors.Errorf("unable to rename '%s': no such file or directory in the tree", oldRelativePath)
+	}
+
+	newParent, newName, err := d.parentOf(newRelativePath)
+	if err != nil {
+		return err
+	}
+	if isDir && strings.HasPrefix(filepath.ToSlash(filepath.Clean(newRelativePath))+"/",
+		filepath.ToSlash(filepath.Clean(oldRelativePath))+"/") {
+		return errors.Errorf("unable to rename '%s' to '%s': a directory cannot be moved into itself",
+			oldRelativePath, newRelativePath)
+	}
+
+	delete(oldParent.dirs, oldName)
+	delete(oldParent.files, oldName)
+	delete(newParent.dirs, newName)
+	delete(newParent.files, newName)
+	if isDir {
+		newParent.dirs[newName] = subDir
+	} else {
+		newParent.files[newName] = file
+	}
+	return nil
+}
+
+// parentOf returns the Directory that contains the entry at relativePath (which may use forward slashes or the
+// OS-specific path separator), as well as the entry's name. The checksums of d and of all Directory objects along the
+// path are reset. An error is returned if a parent directory does not exist in the tree.
+func (d *Directory) parentOf(relativePath string) (*Directory, string, error) {
+	cleanPath := filepath.ToSlash(filepath.Clean(relativePath))
+	if cleanPath == "." || cleanPath == ".." || strings.HasPrefix(cleanPath, "../") || filepath.IsAbs(relativePath) {
+		return nil, "", errors.Errorf("invalid path '%s': must be a relative path below the root directory",
+			relativePath)
+	}
+
+	components := strings.Split(cleanPath, "/")
+	current := d
+	var traversed []*Directory
+	for _, component := range components[:len(components)-1] {
+		traversed = append(traversed, current)
+		subDir, ok := current.dirs[component]
+		if !ok {
+			return nil, "", errors.Errorf("the parent directory of '%s' does not exist in the tree",
+				relativePath)
+		}
+		current = subDir
+	}
+
+	for _, dir := range append(traversed, current) {
+		dir.checksum = ""
+	}
+	return current, components[len(components)-1], nil
+}
+
+// lstatIfPossible calls LstatIfPossible() if the file system supports it, and Stat() otherwise.
+func lstatIfPossible(filesystemImpl afero.Fs, absolutePath string) (os.FileInfo, bool, error) {
+	if lstater, ok := filesystemImpl.(afero.Lstater); ok {
+		return lstater.LstatIfPossible(absolutePath)
+	}
+	info, err := filesystemImpl.Stat(absolutePath)
+	return info, false, err
+}
@@ -0,0 +1,164 @@
+package directory_checksum
+
+import (
+	"github.com/spf13/afero"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+func setUpIncrementalTestingFilesystem() afero.Fs {
+	testingFilesystem := []TestingFilesystemObject{
+		TestingDir{absolutePath: filepath.FromSlash("/a")},
+		TestingFile{absolutePath: filepath.FromSlash("/a/f"), content: "foo"},
+		TestingDir{absolutePath: filepath.FromSlash("/b")},
+		TestingDir{absolutePath: filepath.FromSlash("/b/sub")},
+		TestingFile{absolutePath: filepath.FromSlash("/b/sub/f"), content: "bar"},
+		TestingFile{absolutePath: filepath.FromSlash("/f"), content: "baz"},
+	}
+	filesystemImpl := afero.NewMemMapFs()
+	setUpTestingFilesystem(testingFilesystem, filesystemImpl)
+	return filesystemImpl
+}
+
+// assertMatchesFreshScan checks that the (incrementally updated) directory d has the same checksums as a fresh scan.
+func assertMatchesFreshScan(t *testing.T, d *Directory, filesystemImpl afero.Fs) {
+	t.Helper()
+	fresh, _ := ScanDirectory(string(filepath.Separator), filesystemImpl)
+	fresh.ComputeDirectoryChecksums()
+	want := fresh.PrintChecksums(10)
+
+	d.ComputeDirectoryChecksums()
+	got := d.PrintChecksums(10)
+	if got != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", got, want)
+	}
+}
+
+func TestUpdateChangedFile(t *testing.T) {
+	filesystemImpl := setUpIncrementalTestingFilesystem()
+	d, _ := ScanDirectory(string(filepath.Separator), filesystemImpl)
+	d.ComputeDirectoryChecksums()
+
+	// Use a sentinel value to detect whether the unchanged directory "a" is recomputed
+	d.dirs["a"].checksum = "unchanged"
+	TestingFile{absolutePath: filepath.FromSlash("/b/sub/f"), content: "changed"}.Create(filesystemImpl)
+	if err := d.Update("b/sub/f"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d.ComputeDirectoryChecksums()
+
+	if got := d.dirs["a"].checksum; got != "unchanged" {
+		t.Fatalf("Unchanged directory was recomputed, got checksum %s", got)
+	}
+	entry, _ := d.Lookup("b/sub/f")
+	if got, want := entry.Checksum(), "37c6c57bedf4305ef41249c1794760b5cb8fad17"; got != want {
+		t.Fatalf("Got checksum %s, want %s", got, want)
+	}
+
+	d.dirs["a"].checksum = ""
+	d.checksum = ""
+	assertMatchesFreshScan(t, d, filesystemImpl)
+}
+
+func TestUpdateNewAndDeletedEntries(t *testing.T) {
+	filesystemImpl := setUpIncrementalTestingFilesystem()
+	d, _ := ScanDirectory(string(filepath.Separator), filesystemImpl)
+	d.ComputeDirectoryChecksums()
+
+	TestingDir{absolutePath: filepath.FromSlash("/c")}.Create(filesystemImpl)
+	TestingFile{absolutePath: filepath.FromSlash("/c/f"), content: "new"}.Create(filesystemImpl)
+	filesystemImpl.RemoveAll(filepath.FromSlash("/b/sub"))
+	filesystemImpl.Remove(filepath.FromSlash("/a/f"))
+
+	for _, relativePath := range []string{"c", "b/sub", "a/f"} {
+		if err := d.Update(relativePath); err != nil {
+			t.Fatalf("Unexpected error for %s: %v", relativePath, err)
+		}
+	}
+
+	assertMatchesFreshScan(t, d, filesystemImpl)
+}
+
+func TestUpdateHonorsFilter(t *testing.T) {
+	filesystemImpl := setUpIncrementalTestingFilesystem()
+	filter := func(relativePath string, info fs.FileInfo) bool {
+		return filepath.Base(relativePath) != "ignored"
+	}
+	d, _ := ScanDirectory(string(filepath.Separator), filesystemImpl, WithFilter(filter))
+	d.ComputeDirectoryChecksums()
+	want := d.PrintChecksums(10)
+
+	TestingFile{absolutePath: filepath.FromSlash("/b/sub/ignored"), content: "foo"}.Create(filesystemImpl)
+	TestingDir{absolutePath: filepath.FromSlash("/ignored")}.Create(filesystemImpl)
+	for _, relativePath := range []string{"b", "ignored"} {
+		if err := d.Update(relativePath); err != nil {
+			t.Fatalf("Unexpected error for %s: %v", relativePath, err)
+		}
+	}
+	d.ComputeDirectoryChecksums()
+
+	if got := d.PrintChecksums(10); got != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", got, want)
+	}
+}
+
+func TestRemoveAndRename(t *testing.T) {
+	filesystemImpl := setUpIncrementalTestingFilesystem()
+	d, _ := ScanDirectory(string(filepath.Separator), filesystemImpl)
+	d.ComputeDirectoryChecksums()
+
+	filesystemImpl.Rename(filepath.FromSlash("/b/sub"), filepath.FromSlash("/a/moved"))
+	filesystemImpl.Remove(filepath.FromSlash("/f"))
+	if err := d.Rename("b/sub", "a/moved"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := d.Remove("f"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	assertMatchesFreshScan(t, d, filesystemImpl)
+}
+
+func TestIncrementalErrors(t *testing.T) {
+	filesystemImpl := setUpIncrementalTestingFilesystem()
+	d, _ := ScanDirectory(string(filepath.Separator), filesystemImpl)
+
+	if err := d.Remove("missing"); err == nil {
+		t.Fatal("Expected error when removing missing entry")
+	}
+	if err := d.Update("missing/f"); err == nil {
+		t.Fatal("Expected error when updating entry with missing parent")
+	}
+	if err := d.Rename("b", "b/sub/b"); err == nil {
+		t.Fatal("Expected error when moving directory into itself")
+	}
+	if err := d.Update("../outside"); err == nil {
+		t.Fatal("Expected error when updating path outside of the root")
+	}
+
+	built, _ := NewTree().AddDir("d").Build()
+	if err := built.Update("d"); err == nil {
+		t.Fatal("Expected error when updating a tree that was not scanned")
+	}
+}
+
+func TestUpdateErrorKeepsEntry(t *testing.T) {
+	filesystemImpl := setUpIncrementalTestingFilesystem()
+	d, _ := ScanDirectory(string(filepath.Separator), filesystemImpl)
+	d.ComputeDirectoryChecksums()
+	want := d.PrintChecksums(10)
+
+	// re-scanning fails because reading any file fails
+	d.source.filesystemImpl = &fsWrapper{filesystemImpl}
+	for _, relativePath := range []string{"a/f", "b"} {
+		if err := d.Update(relativePath); err == nil {
+			t.Fatalf("Expected error when updating %s but did not get any", relativePath)
+		}
+	}
+
+	d.ComputeDirectoryChecksums()
+	if got := d.PrintChecksums(10); got != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", got, want)
+	}
+}
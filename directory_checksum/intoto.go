@@ -0,0 +1,102 @@
+package directory_checksum
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"path/filepath"
+)
+
+const (
+	InTotoStatementType = "https://in-toto.io/Statement/v1"
+	// InTotoPredicateType identifies the InTotoDirectoryPredicate of statements created by InTotoStatement().
+	InTotoPredicateType = "https://github.com/MShekow/directory-checksum/directory/v1"
+	InTotoPayloadType   = "application/vnd.in-toto+json"
+)
+
+// An InTotoStatement is an in-toto attestation Statement (v1), see
+// https://github.com/in-toto/attestation/blob/main/spec/v1/statement.md
+type InTotoStatement struct {
+	Type          string                     `json:"_type"`
+	Subject       []InTotoResourceDescriptor `json:"subject"`
+	PredicateType string                     `json:"predicateType"`
+	Predicate     InTotoDirectoryPredicate   `json:"predicate"`
+}
+
+// An InTotoResourceDescriptor describes a file (or directory), see
+// https://github.com/in-toto/attestation/blob/main/spec/v1/resource_descriptor.md
+type InTotoResourceDescriptor struct {
+	Name        string            `json:"name"`
+	Digest      map[string]string `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// An InTotoDirectoryPredicate holds the checksum of the directory whose files are the subjects of the statement, and
+// the name of the Scheme that computed it.
+type InTotoDirectoryPredicate struct {
+	Checksum string `json:"checksum"`
+	Scheme   string `json:"scheme"`
+}
+
+// A DSSEEnvelope is a Dead Simple Signing Envelope, see
+// https://github.com/secure-systems-lab/dsse/blob/master/envelope.md
+type DSSEEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"`
+	Signatures  []DSSESignature `json:"signatures"`
+}
+
+// A DSSESignature is one signature of a DSSEEnvelope.
+type DSSESignature struct {
+	KeyID     string `json:"keyid,omitempty"`
+	Signature string `json:"sig"`
+}
+
+// InTotoStatement returns an in-toto Statement with one subject per regular file (named by its slash-separated path
+// relative to d), and an InTotoDirectoryPredicate that holds the checksum of d. Symbolic links and empty directories
+// are only reflected in d's checksum. The tree must have been scanned with the SHA256 algorithm (and with SHA256 as
+// extra hash algorithm, unless it uses the DefaultScheme), and ComputeDirectoryChecksums() must have been called.
+func (d *Directory) InTotoStatement() (*InTotoStatement, error) {
+	if d.options.hasher.Name != SHA256.Name {
+		return nil, errors.Errorf("in-toto statements require the %s algorithm, but the tree uses %s", SHA256.Name,
+			d.options.hasher.Name)
+	}
+	if d.checksum == "" {
+		return nil, errors.New("unable to create in-toto statement: directory checksums have not been computed")
+	}
+
+	statement := InTotoStatement{
+		Type:          InTotoStatementType,
+		Subject:       []InTotoResourceDescriptor{},
+		PredicateType: InTotoPredicateType,
+		Predicate:     InTotoDirectoryPredicate{Checksum: d.checksum, Scheme: d.options.scheme.Name},
+	}
+	for relativePath, entry := range d.PreOrder() {
+		if entry.Type() != TypeFile {
+			continue
+		}
+		digest, ok := d.options.digest(entry.(*File), SHA256.Name)
+		if !ok {
+			return nil, errors.New("unable to create in-toto statement: the tree must be scanned with SHA256 " +
+				"digests (see WithExtraHashers)")
+		}
+		statement.Subject = append(statement.Subject, InTotoResourceDescriptor{
+			Name:   filepath.ToSlash(relativePath),
+			Digest: map[string]string{SHA256.Name: digest},
+		})
+	}
+	return &statement, nil
+}
+
+// NewDSSEEnvelope returns an (unsigned) DSSE envelope whose payload is the JSON-encoded statement, ready for signing.
+func NewDSSEEnvelope(statement *InTotoStatement) (*DSSEEnvelope, error) {
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return &DSSEEnvelope{
+		PayloadType: InTotoPayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []DSSESignature{},
+	}, nil
+}
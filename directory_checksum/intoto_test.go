@@ -0,0 +1,74 @@
+package directory_checksum
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInTotoStatement(t *testing.T) {
+	d, _ := NewTree(WithHasher(SHA256)).
+		AddFile("d/f", strings.NewReader("foo")).
+		AddSymlink("d/link", "f").
+		AddDir("empty").
+		AddFile("g", strings.NewReader("bar")).
+		Build()
+	d.ComputeDirectoryChecksums()
+
+	statement, err := d.InTotoStatement()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	wantSubject := []InTotoResourceDescriptor{
+		{Name: "d/f", Digest: map[string]string{
+			"sha256": "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"}},
+		{Name: "g", Digest: map[string]string{
+			"sha256": "fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9"}},
+	}
+	if !reflect.DeepEqual(statement.Subject, wantSubject) {
+		t.Fatalf("Got subject %v, want %v", statement.Subject, wantSubject)
+	}
+	wantPredicate := InTotoDirectoryPredicate{Checksum: d.Checksum(), Scheme: DefaultScheme.Name}
+	if statement.Predicate != wantPredicate {
+		t.Fatalf("Got predicate %v, want %v", statement.Predicate, wantPredicate)
+	}
+	if statement.Type != "https://in-toto.io/Statement/v1" ||
+		statement.PredicateType != "https://github.com/MShekow/directory-checksum/directory/v1" {
+		t.Fatalf("Unexpected statement type %s or predicate type %s", statement.Type, statement.PredicateType)
+	}
+}
+
+func TestInTotoStatementRequiresSHA256(t *testing.T) {
+	d, _ := NewTree().AddFile("f", strings.NewReader("foo")).Build()
+	d.ComputeDirectoryChecksums()
+
+	if _, err := d.InTotoStatement(); err == nil {
+		t.Fatal("Expected error but did not get any")
+	}
+}
+
+func TestDSSEEnvelope(t *testing.T) {
+	d, _ := NewTree(WithHasher(SHA256)).AddFile("f", strings.NewReader("foo")).Build()
+	d.ComputeDirectoryChecksums()
+	statement, _ := d.InTotoStatement()
+
+	envelope, err := NewDSSEEnvelope(statement)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if envelope.PayloadType != "application/vnd.in-toto+json" || len(envelope.Signatures) != 0 {
+		t.Fatalf("Unexpected envelope: %v", envelope)
+	}
+
+	payload, _ := base64.StdEncoding.DecodeString(envelope.Payload)
+	var decoded InTotoStatement
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		t.Fatalf("Unable to decode payload: %v", err)
+	}
+	if !reflect.DeepEqual(&decoded, statement) {
+		t.Fatalf("Got payload %v, want %v", decoded, statement)
+	}
+}
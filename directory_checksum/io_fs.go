@@ -0,0 +1,76 @@
+package directory_checksum
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/spf13/afero"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readLinkFS has the same method set as fs.ReadLinkFS (added in Go 1.25), which is implemented e.g. by os.DirFS and
+// fstest.MapFS. It is declared here so that symbolic links are supported without raising the module's Go version.
+type readLinkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// ioFsAdapter makes an io/fs.FS usable as (read-only) afero.Fs. It accepts OS-specific absolute paths, such as
+// "/sub/dir", which are converted to the unrooted, slash-separated paths that io/fs.FS expects, such as "sub/dir".
+type ioFsAdapter struct {
+	afero.FromIOFS
+}
+
+// toFSPath converts an OS-specific absolute path to a path that is valid for io/fs.FS.
+func toFSPath(name string) string {
+	name = strings.Trim(filepath.ToSlash(name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (a ioFsAdapter) Open(name string) (afero.File, error) {
+	return a.FromIOFS.Open(toFSPath(name))
+}
+
+func (a ioFsAdapter) OpenFile(name string, _ int, _ os.FileMode) (afero.File, error) {
+	return a.Open(name)
+}
+
+func (a ioFsAdapter) Stat(name string) (os.FileInfo, error) {
+	return a.FromIOFS.Stat(toFSPath(name))
+}
+
+func (a ioFsAdapter) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if linkFS, ok := a.FS.(readLinkFS); ok {
+		info, err := linkFS.Lstat(toFSPath(name))
+		return info, true, err
+	}
+	info, err := a.Stat(name)
+	return info, false, err
+}
+
+func (a ioFsAdapter) ReadlinkIfPossible(name string) (string, error) {
+	if linkFS, ok := a.FS.(readLinkFS); ok {
+		return linkFS.ReadLink(toFSPath(name))
+	}
+	return "", &os.PathError{Op: "readlink", Path: name, Err: afero.ErrNoReadlink}
+}
+
+// ScanFS returns the pointer to a (hierarchically-nested) Directory that is constructed from recursively walking the
+// directory root (a slash-separated path as accepted by fs.ValidPath, e.g. "." or "static/assets") of fsys, which
+// may be an embed.FS, fstest.MapFS, os.DirFS, etc. The checksums are identical to scanning the same tree on disk with
+// ScanDirectory. Symbolic links are only detected if fsys has the methods of fs.ReadLinkFS.
+func ScanFS(fsys fs.FS, root string, options ...ScanOption) (*Directory, error) {
+	if !fs.ValidPath(root) {
+		return nil, errors.Errorf("invalid root path '%s': must be an unrooted, slash-separated path", root)
+	}
+	absoluteRootPath := string(os.PathSeparator)
+	if root != "." {
+		absoluteRootPath = filepath.Join(absoluteRootPath, filepath.FromSlash(root))
+	}
+	return scanDirectory(absoluteRootPath, ioFsAdapter{afero.FromIOFS{FS: fsys}}, newScanOptions(options...))
+}
@@ -0,0 +1,108 @@
+package directory_checksum
+
+import (
+	"github.com/spf13/afero"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestScanFSMatchesScanDirectory(t *testing.T) {
+	tempDir := t.TempDir()
+	testingFilesystem := []TestingFilesystemObject{
+		TestingDir{absolutePath: filepath.Join(tempDir, "d")},
+		TestingDir{absolutePath: filepath.Join(tempDir, "d", "empty")},
+		TestingFile{absolutePath: filepath.Join(tempDir, "d", "f"), content: "foo"},
+		TestingFile{absolutePath: filepath.Join(tempDir, "f"), content: "bar"},
+	}
+	setUpTestingFilesystem(testingFilesystem, afero.NewOsFs())
+	mapFS := fstest.MapFS{
+		"d":       {Mode: fs.ModeDir},
+		"d/empty": {Mode: fs.ModeDir},
+		"d/f":     {Data: []byte("foo")},
+		"f":       {Data: []byte("bar")},
+	}
+
+	d1, _ := ScanDirectory(tempDir, afero.NewOsFs())
+	d1.ComputeDirectoryChecksums()
+	want := d1.PrintChecksums(3)
+
+	d2, err := ScanFS(mapFS, ".")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d2.ComputeDirectoryChecksums()
+	got := d2.PrintChecksums(3)
+
+	if got != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", got, want)
+	}
+
+	d3, _ := ScanFS(os.DirFS(tempDir), ".")
+	d3.ComputeDirectoryChecksums()
+	if got := d3.PrintChecksums(3); got != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", got, want)
+	}
+}
+
+func TestScanFSSubdirectory(t *testing.T) {
+	mapFS := fstest.MapFS{
+		"static/assets/f": {Data: []byte("foo")},
+		"other":           {Data: []byte("bar")},
+	}
+
+	d, err := ScanFS(mapFS, "static/assets")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d.ComputeDirectoryChecksums()
+	got := d.PrintChecksums(1)
+
+	want := "7b06b8230df4bf1aacb85eb46f410bf9403e6038 D .\n" +
+		"0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33 F f\n"
+	if got != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", got, want)
+	}
+}
+
+func TestScanFSWithSymlink(t *testing.T) {
+	mapFS := fstest.MapFS{
+		"dir-target": {Mode: fs.ModeDir},
+		"dir-source": {Mode: fs.ModeSymlink, Data: []byte("dir-target")},
+	}
+	if _, ok := fs.FS(mapFS).(readLinkFS); !ok {
+		t.Skip("Test skipped because fstest.MapFS does not support symbolic links in this Go version")
+	}
+
+	d, err := ScanFS(mapFS, ".")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d.ComputeDirectoryChecksums()
+	got := d.PrintChecksums(1)
+
+	// Same result as in TestScanWithDirectorySymlink
+	want := "14b86a68c6820d52ac6603d3f84317255e88b4ed D .\n" +
+		"da39a3ee5e6b4b0d3255bfef95601890afd80709 D dir-target\n" +
+		"51386830a6c5a495a39f7a8c17b2fc327240f699 S dir-source\n"
+	if got != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", got, want)
+	}
+}
+
+func TestScanFSInvalidRoot(t *testing.T) {
+	for _, root := range []string{"/abs", "../up", "missing"} {
+		_, err := ScanFS(fstest.MapFS{}, root)
+		if err == nil {
+			t.Fatalf("Expected error for root %s but did not get any", root)
+		}
+	}
+
+	_, err := ScanFS(fstest.MapFS{"f": {Data: []byte("foo")}}, "f")
+	if err == nil || !strings.Contains(err.Error(), "root path must point to a directory") {
+		t.Fatalf("Unexpected error was returned: %v", err)
+	}
+}
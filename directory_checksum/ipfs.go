@@ -0,0 +1,270 @@
+package directory_checksum
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/go-errors/errors"
+	"hash"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+const (
+	// IPFSDefaultChunkSize is the size of the chunks into which "ipfs add" splits files by default.
+	IPFSDefaultChunkSize = 256 * 1024
+	// ipfsMaxLinks is the maximum number of children of a node in the DAG of a file.
+	ipfsMaxLinks = 174
+	// ipfsShardingThreshold is the estimated size of a directory node above which "ipfs add" creates a HAMT-sharded
+	// directory instead, which is not supported.
+	ipfsShardingThreshold = 256 * 1024
+
+	cidVersion1     = 0x01
+	cidCodecRaw     = 0x55
+	cidCodecDagPB   = 0x70
+	multihashSHA256 = 0x12
+
+	unixfsTypeDirectory = 1
+	unixfsTypeFile      = 2
+	unixfsTypeSymlink   = 4
+)
+
+// IPFSScheme is the IPFSSchemeWithChunkSize with the default chunk size of "ipfs add".
+var IPFSScheme = IPFSSchemeWithChunkSize(IPFSDefaultChunkSize)
+
+// IPFSSchemeWithChunkSize returns a Scheme whose checksums are the binary CIDv1 of the UnixFS DAG that
+// "ipfs add --cid-version=1" creates (see FormatCID): files are split into chunks of chunkSize bytes, which are stored
+// as raw leaves of a balanced DAG of dag-pb nodes, and directories and symbolic links are dag-pb nodes. The Metadata
+// (e.g. the mode) is not part of the DAG. Use it with the SHA256 algorithm. Directories that "ipfs add" would shard
+// (which happens for very large directories) are not supported.
+func IPFSSchemeWithChunkSize(chunkSize int) Scheme {
+	return Scheme{
+		Name: "ipfs",
+		newFileHasher: func(_ HashAlgorithm, metadata Metadata, _ int64) hash.Hash {
+			return &ipfsFileHasher{chunkSize: chunkSize, isSymbolicLink: metadata.Mode&fs.ModeSymlink != 0}
+		},
+		directoryChecksum: func(d *Directory) (string, error) {
+			if d.options.hasher.Name != SHA256.Name {
+				return "", errors.Errorf("the %s scheme requires the %s algorithm", d.options.scheme.Name, SHA256.Name)
+			}
+			if _, err := ipfsDirectoryLink(d, chunkSize); err != nil {
+				return "", err
+			}
+			return d.checksum, nil
+		},
+	}
+}
+
+// An ipfsLink is a link to a node of a UnixFS DAG. tsize is the cumulative size of all blocks of the linked DAG, and
+// fileSize is the size of the file content it contains.
+type ipfsLink struct {
+	name     string
+	cid      []byte
+	tsize    uint64
+	fileSize uint64
+}
+
+// newCID returns the binary CIDv1 of block, which is encoded with the provided codec.
+func newCID(codec uint64, block []byte) []byte {
+	digest := sha256.Sum256(block)
+	cid := binary.AppendUvarint(nil, cidVersion1)
+	cid = binary.AppendUvarint(cid, codec)
+	cid = append(cid, multihashSHA256, sha256.Size)
+	return append(cid, digest[:]...)
+}
+
+// appendProtobufVarint appends the protobuf encoding of the varint field with the provided number to b.
+func appendProtobufVarint(b []byte, field int, value uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3)
+	return binary.AppendUvarint(b, value)
+}
+
+// appendProtobufBytes appends the protobuf encoding of the length-delimited field with the provided number to b.
+func appendProtobufBytes(b []byte, field int, value []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+// dagPBNodeLink encodes a dag-pb node with the provided links and (UnixFS) data, and returns a link to it. Like in
+// the canonical dag-pb encoding, the links precede the data.
+func dagPBNodeLink(links []ipfsLink, data []byte) ipfsLink {
+	var block []byte
+	tsize := uint64(0)
+	for _, link := range links {
+		encodedLink := appendProtobufBytes(nil, 1, link.cid)
+		encodedLink = appendProtobufBytes(encodedLink, 2, []byte(link.name))
+		encodedLink = appendProtobufVarint(encodedLink, 3, link.tsize)
+		block = appendProtobufBytes(block, 2, encodedLink)
+		tsize += link.tsize
+	}
+	block = appendProtobufBytes(block, 1, data)
+	return ipfsLink{cid: newCID(cidCodecDagPB, block), tsize: tsize + uint64(len(block))}
+}
+
+// rawLeafLink returns a link to the raw leaf that stores chunk.
+func rawLeafLink(chunk []byte) ipfsLink {
+	return ipfsLink{cid: newCID(cidCodecRaw, chunk), tsize: uint64(len(chunk)), fileSize: uint64(len(chunk))}
+}
+
+// symlinkNodeLink returns a link to the dag-pb node that represents a symbolic link to target.
+func symlinkNodeLink(target string) ipfsLink {
+	data := appendProtobufVarint(nil, 1, unixfsTypeSymlink)
+	return dagPBNodeLink(nil, appendProtobufBytes(data, 2, []byte(target)))
+}
+
+// ipfsFileRoot returns the link to the root of the balanced DAG over leaves (which must not be empty), built like the
+// balanced layout of "ipfs add": the first leaf is the initial root, which is replaced by a deeper tree (whose first
+// child is the previous root) whenever the current tree is full.
+func ipfsFileRoot(leaves []ipfsLink) ipfsLink {
+	root, remaining := leaves[0], leaves[1:]
+	for depth := 1; len(remaining) > 0; depth++ {
+		root, remaining = fillIpfsFileNode([]ipfsLink{root}, remaining, depth)
+	}
+	return root
+}
+
+// fillIpfsFileNode adds children of the provided depth to a node that already has the provided children, consuming
+// leaves from remaining until the node is full. It returns the link to the node and the leaves that were not consumed.
+func fillIpfsFileNode(children []ipfsLink, remaining []ipfsLink, depth int) (ipfsLink, []ipfsLink) {
+	for len(children) < ipfsMaxLinks && len(remaining) > 0 {
+		var child ipfsLink
+		if depth == 1 {
+			child, remaining = remaining[0], remaining[1:]
+		} else {
+			child, remaining = fillIpfsFileNode(nil, remaining, depth-1)
+		}
+		children = append(children, child)
+	}
+
+	fileSize := uint64(0)
+	for _, child := range children {
+		fileSize += child.fileSize
+	}
+	data := appendProtobufVarint(nil, 1, unixfsTypeFile)
+	data = appendProtobufVarint(data, 3, fileSize)
+	for _, child := range children {
+		data = appendProtobufVarint(data, 4, child.fileSize)
+	}
+	link := dagPBNodeLink(children, data)
+	link.fileSize = fileSize
+	return link, remaining
+}
+
+// ipfsFileHasher is a hash.Hash that computes the CID of a file (or symbolic link), whose Sum is the binary CID. Only
+// the CIDs of the leaves are kept in memory, not the content.
+type ipfsFileHasher struct {
+	chunkSize      int
+	isSymbolicLink bool
+	buffer         []byte
+	leaves         []ipfsLink
+}
+
+func (h *ipfsFileHasher) Write(p []byte) (int, error) {
+	written := len(p)
+	if h.isSymbolicLink {
+		h.buffer = append(h.buffer, p...)
+		return written, nil
+	}
+	for len(p) > 0 {
+		n := min(h.chunkSize-len(h.buffer), len(p))
+		h.buffer = append(h.buffer, p[:n]...)
+		p = p[n:]
+		if len(h.buffer) == h.chunkSize {
+			h.leaves = append(h.leaves, rawLeafLink(h.buffer))
+			h.buffer = h.buffer[:0]
+		}
+	}
+	return written, nil
+}
+
+func (h *ipfsFileHasher) Sum(b []byte) []byte {
+	if h.isSymbolicLink {
+		return append(b, symlinkNodeLink(string(h.buffer)).cid...)
+	}
+	leaves := h.leaves[:len(h.leaves):len(h.leaves)]
+	if len(h.buffer) > 0 || len(leaves) == 0 {
+		leaves = append(leaves, rawLeafLink(h.buffer))
+	}
+	return append(b, ipfsFileRoot(leaves).cid...)
+}
+
+func (h *ipfsFileHasher) Reset() {
+	h.buffer = h.buffer[:0]
+	h.leaves = nil
+}
+
+func (h *ipfsFileHasher) Size() int {
+	return 4 + sha256.Size
+}
+
+func (h *ipfsFileHasher) BlockSize() int {
+	return h.chunkSize
+}
+
+// ipfsFileCumulativeSize returns the cumulative size of the blocks of file's DAG. It depends only on the size of the
+// file (or the target of a symbolic link), because all CIDs have the same length, so the DAG is rebuilt with dummy
+// leaves of the correct sizes.
+func ipfsFileCumulativeSize(file *File, chunkSize int) uint64 {
+	if file.isSymbolicLink {
+		return symlinkNodeLink(file.metadata.LinkTarget).tsize
+	}
+	size := uint64(max(file.metadata.Size, 0))
+	if size <= uint64(chunkSize) {
+		return size
+	}
+	dummyCID := make([]byte, 4+sha256.Size)
+	var leaves []ipfsLink
+	for remaining := size; remaining > 0; remaining -= min(remaining, uint64(chunkSize)) {
+		chunkLength := min(remaining, uint64(chunkSize))
+		leaves = append(leaves, ipfsLink{cid: dummyCID, tsize: chunkLength, fileSize: chunkLength})
+	}
+	return ipfsFileRoot(leaves).tsize
+}
+
+// ipfsDirectoryLink returns the link to the dag-pb node that represents d, and sets the checksums of d and all
+// directories below it in the same pass. The entries are sorted by name, like "ipfs add" does.
+func ipfsDirectoryLink(d *Directory, chunkSize int) (ipfsLink, error) {
+	var links []ipfsLink
+	for name, subDir := range d.Dirs() {
+		link, err := ipfsDirectoryLink(subDir, chunkSize)
+		if err != nil {
+			return ipfsLink{}, err
+		}
+		link.name = name
+		links = append(links, link)
+	}
+	for name, file := range d.Files() {
+		cid, err := hex.DecodeString(file.checksum)
+		if err != nil {
+			return ipfsLink{}, errors.Errorf("invalid checksum of '%s': %v", name, err)
+		}
+		links = append(links, ipfsLink{name: name, cid: cid, tsize: ipfsFileCumulativeSize(file, chunkSize)})
+	}
+	sort.SliceStable(links, func(i, j int) bool { return links[i].name < links[j].name })
+
+	estimatedSize := 0
+	for _, link := range links {
+		estimatedSize += len(link.name) + len(link.cid)
+	}
+	if estimatedSize >= ipfsShardingThreshold {
+		return ipfsLink{}, errors.Errorf("a directory with %d entries would be sharded by IPFS, which is not "+
+			"supported", len(links))
+	}
+
+	link := dagPBNodeLink(links, appendProtobufVarint(nil, 1, unixfsTypeDirectory))
+	d.checksum = hex.EncodeToString(link.cid)
+	return link, nil
+}
+
+// FormatCID converts a checksum computed with IPFSScheme (the binary CID in hexadecimal notation) to the string
+// representation of the CID (base32, with the multibase prefix "b"), as printed by "ipfs add --cid-version=1".
+func FormatCID(checksum string) (string, error) {
+	cid, err := hex.DecodeString(checksum)
+	if err != nil {
+		return "", errors.Errorf("invalid checksum '%s': %v", checksum, err)
+	}
+	return "b" + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(cid)), nil
+}
@@ -0,0 +1,87 @@
+package directory_checksum
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// assertCIDs checks that the CIDs of the entries of d at the provided paths are as expected.
+func assertCIDs(t *testing.T, d *Directory, expected map[string]string) {
+	for relativePath, want := range expected {
+		entry, ok := d.Lookup(relativePath)
+		if !ok {
+			t.Fatalf("Entry %s not found", relativePath)
+		}
+		got, err := FormatCID(entry.Checksum())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got != want {
+			t.Fatalf("Got CID %s of %s, want %s", got, relativePath, want)
+		}
+	}
+}
+
+func TestIPFSScheme(t *testing.T) {
+	d, err := NewTree(WithHasher(SHA256), WithScheme(IPFSScheme)).
+		AddFile("hw", strings.NewReader("hello world")).
+		AddFile("e", strings.NewReader("")).
+		AddSymlink("link", "hw").
+		AddFile("sub/big", strings.NewReader(strings.Repeat("0123456789", 100000))).
+		AddDir("empty").
+		Build()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err = d.ComputeDirectoryChecksums(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Expected values were computed with the UnixFS importer of github.com/ipfs/boxo, which "ipfs add" uses
+	assertCIDs(t, d, map[string]string{
+		".":       "bafybeibav3bztabbohetlagkolgl3kfwn5a5jsuosxrlqef2tqrjrt2zw4",
+		"e":       "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku",
+		"empty":   "bafybeiczsscdsbs7ffqz55asqdf3smv6klcw3gofszvwlyarci47bgf354",
+		"hw":      "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e",
+		"link":    "bafybeihtwzceoufmifq7xgh2vuqg7efotphexjsexjkskpk2jn4oumm2im",
+		"sub":     "bafybeig6e7cb7tajte5tkd73hdydm4xqgpkj6vsaofxkxtcqghfsfu7vfu",
+		"sub/big": "bafybeie3opkdyuzskihdiqbbdasck7nfdc4ewud2mahsthy2g67nkvnfzq",
+	})
+}
+
+func TestIPFSSchemeWithChunkSize(t *testing.T) {
+	// with 200 chunks, the DAG of the file has two levels of dag-pb nodes
+	d, _ := NewTree(WithHasher(SHA256), WithScheme(IPFSSchemeWithChunkSize(10))).
+		AddFile("f", strings.NewReader(strings.Repeat("0123456789", 200))).
+		Build()
+	if _, err := d.ComputeDirectoryChecksums(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	assertCIDs(t, d, map[string]string{
+		".": "bafybeifkk4oqqqokj732kgtd27mwlhzygai5jl3nyj5siq7qaftd3zxsde",
+		"f": "bafybeiaxr5x3ehaaynkwh5mdf2xsminjdgumlrbmccfn74vbq3cnmbyg44",
+	})
+}
+
+func TestIPFSSchemeErrors(t *testing.T) {
+	d, _ := NewTree(WithHasher(SHA1), WithScheme(IPFSScheme)).AddFile("f", strings.NewReader("foo")).Build()
+	if _, err := d.ComputeDirectoryChecksums(); err == nil {
+		t.Fatal("Expected error for the sha1 algorithm but did not get any")
+	}
+
+	builder := NewTree(WithHasher(SHA256), WithScheme(IPFSScheme))
+	for i := 0; i < 6100; i++ {
+		builder.AddFile(fmt.Sprintf("f%06d", i), strings.NewReader(""))
+	}
+	d, _ = builder.Build()
+	if _, err := d.ComputeDirectoryChecksums(); err == nil {
+		t.Fatal("Expected error for a directory that requires sharding but did not get any")
+	}
+}
+
+func TestFormatCID(t *testing.T) {
+	if _, err := FormatCID("xyz"); err == nil {
+		t.Fatal("Expected error but did not get any")
+	}
+}
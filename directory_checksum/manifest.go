@@ -0,0 +1,221 @@
+package directory_checksum
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/go-errors/errors"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	manifestHeader  = "# directory-checksum manifest"
+	manifestVersion = "1"
+	// ManifestScheme identifies the way in which file and directory checksums are computed. It must be changed
+	// whenever the computation changes in a way that affects the checksums.
+	ManifestScheme = "directory-checksum-v1"
+)
+
+// WriteManifest writes a manifest of d to w, which contains a header (with the hash algorithm and scheme) followed by
+// the complete listing of PrintChecksums(), but with forward slashes as path separator on all platforms. A manifest
+// can be read with ReadManifest. It assumes that ComputeDirectoryChecksums() has already been called. Manifests are
+// only supported for trees that use the DefaultScheme.
+func (d *Directory) WriteManifest(w io.Writer) error {
+	if d.checksum == "" {
+		return errors.New("unable to write manifest: directory checksums have not been computed")
+	}
+	if d.options.scheme.Name != DefaultScheme.Name {
+		return errors.Errorf("unable to write manifest: only the %s scheme is supported, but the tree uses %s",
+			DefaultScheme.Name, d.options.scheme.Name)
+	}
+
+	bufferedWriter := bufio.NewWriter(w)
+	_, err := fmt.Fprintf(bufferedWriter, "%s\n# version: %s\n# algorithm: %s\n# scheme: %s\n", manifestHeader,
+		manifestVersion, d.options.hasher.Name, ManifestScheme)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	for relativePath, entry := range d.PreOrder() {
+		relativePath = filepath.ToSlash(relativePath)
+		if strings.ContainsAny(relativePath, "\r\n") {
+			return errors.Errorf("unable to write manifest: path '%s' contains a line break", relativePath)
+		}
+		_, err = fmt.Fprintf(bufferedWriter, "%s %s %s\n", entry.Checksum(), entry.Type().Letter(),
+			relativePath)
+		if err != nil {
+			return errors.Wrap(err, 0)
+		}
+	}
+
+	if err = bufferedWriter.Flush(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+// IsManifest returns true if data (or its beginning) looks like a manifest written by WriteManifest.
+func IsManifest(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(manifestHeader))
+}
+
+// ReadManifest reads a manifest written by WriteManifest and returns the Directory tree it describes. The directory
+// checksums listed in the manifest are verified to be consistent with the listed file checksums.
+func ReadManifest(r io.Reader) (*Directory, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	header := map[string]string{}
+	var root *Directory
+	listedChecksums := map[*Directory]string{}
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if lineNumber == 1 {
+			if line != manifestHeader {
+				return nil, errors.Errorf("invalid manifest: first line must be '%s'", manifestHeader)
+			}
+			continue
+		}
+		if root == nil && strings.HasPrefix(line, "# ") {
+			key, value, found := strings.Cut(strings.TrimPrefix(line, "# "), ": ")
+			if !found {
+				return nil, errors.Errorf("invalid manifest header in line %d: %s", lineNumber, line)
+			}
+			header[key] = value
+			continue
+		}
+
+		if root == nil {
+			options, err := manifestOptions(header)
+			if err != nil {
+				return nil, err
+			}
+			root = newDirectory(options)
+		}
+
+		checksum, fileType, relativePath, err := parseListingLine(line)
+		if err != nil {
+			return nil, errors.Errorf("invalid manifest entry in line %d: %v", lineNumber, err)
+		}
+		if relativePath == "." {
+			if fileType != "D" || len(listedChecksums) > 0 {
+				return nil, errors.Errorf("invalid manifest entry in line %d: unexpected root entry", lineNumber)
+			}
+			listedChecksums[root] = checksum
+			continue
+		}
+		if len(listedChecksums) == 0 {
+			return nil, errors.Errorf("invalid manifest entry in line %d: the root directory must be listed first",
+				lineNumber)
+		}
+
+		parent, name, err := root.parentOf(relativePath)
+		if err != nil {
+			return nil, errors.Errorf("invalid manifest entry in line %d: %v", lineNumber, err)
+		}
+		if _, exists := parent.dirs[name]; exists {
+			return nil, errors.Errorf("invalid manifest entry in line %d: duplicate path", lineNumber)
+		}
+		if _, exists := parent.files[name]; exists {
+			return nil, errors.Errorf("invalid manifest entry in line %d: duplicate path", lineNumber)
+		}
+		if fileType == "D" {
+			subDir := newDirectory(root.options)
+			parent.dirs[name] = subDir
+			listedChecksums[subDir] = checksum
+		} else {
+			parent.files[name] = &File{checksum: checksum, isSymbolicLink: fileType == "S", metadata: unknownMetadata}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	if root == nil || len(listedChecksums) == 0 {
+		return nil, errors.New("invalid manifest: it does not list the root directory")
+	}
+
+	if _, err := root.ComputeDirectoryChecksums(); err != nil {
+		return nil, err
+	}
+	for relativePath, entry := range root.PreOrder() {
+		if dir, ok := entry.(*Directory); ok && dir.checksum != listedChecksums[dir] {
+			return nil, errors.Errorf("invalid manifest: the listed checksum of directory '%s' does not match "+
+				"the checksums of its children", filepath.ToSlash(relativePath))
+		}
+	}
+
+	return root, nil
+}
+
+// manifestOptions validates the manifest header and returns the scanOptions that correspond to it.
+func manifestOptions(header map[string]string) (*scanOptions, error) {
+	if header["version"] != manifestVersion {
+		return nil, errors.Errorf("unsupported manifest version '%s'", header["version"])
+	}
+	if header["scheme"] != ManifestScheme {
+		return nil, errors.Errorf("unsupported manifest scheme '%s'", header["scheme"])
+	}
+	algorithm, ok := HashAlgorithmByName(header["algorithm"])
+	if !ok {
+		return nil, errors.Errorf("unsupported manifest algorithm '%s'", header["algorithm"])
+	}
+	return newScanOptions(WithHasher(algorithm)), nil
+}
+
+// parseListingLine parses one line of the listing that is printed by PrintChecksums() or WriteManifest().
+func parseListingLine(line string) (checksum string, fileType string, relativePath string, err error) {
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) != 3 || fields[0] == "" || fields[2] == "" {
+		return "", "", "", errors.New("expected '<checksum> <type> <path>'")
+	}
+	if fields[1] != "D" && fields[1] != "F" && fields[1] != "S" {
+		return "", "", "", errors.Errorf("unknown type '%s'", fields[1])
+	}
+	return fields[0], fields[1], fields[2], nil
+}
+
+// Graft inserts subtree (e.g. read from a manifest with ReadManifest) into d at relativePath, replacing any existing
+// entry at that path, and creating missing parent directories. Both trees must use the same hash algorithm and Scheme.
+// Only the Directory objects along relativePath are marked as changed, so that the next call of
+// ComputeDirectoryChecksums() yields the same checksums as if the combined tree had been scanned at once.
+func (d *Directory) Graft(relativePath string, subtree *Directory) error {
+	if d.options.hasher.Name != subtree.options.hasher.Name {
+		return errors.Errorf("unable to graft at '%s': the subtree uses the hash algorithm %s, but %s is required",
+			relativePath, subtree.options.hasher.Name, d.options.hasher.Name)
+	}
+	if d.options.scheme.Name != subtree.options.scheme.Name {
+		return errors.Errorf("unable to graft at '%s': the subtree uses the scheme %s, but %s is required",
+			relativePath, subtree.options.scheme.Name, d.options.scheme.Name)
+	}
+
+	cleanPath := filepath.ToSlash(filepath.Clean(relativePath))
+	components := strings.Split(cleanPath, "/")
+	for i := 1; i < len(components); i++ {
+		parentPath := strings.Join(components[:i], "/")
+		if entry, exists := d.Lookup(parentPath); !exists {
+			if err := d.Graft(parentPath, newDirectory(d.options)); err != nil {
+				return err
+			}
+		} else if entry.Type() != TypeDir {
+			return errors.Errorf("unable to graft at '%s': '%s' is not a directory", relativePath, parentPath)
+		}
+	}
+
+	parent, name, err := d.parentOf(relativePath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range subtree.PostOrder() {
+		if dir, ok := entry.(*Directory); ok {
+			dir.options = d.options
+		}
+	}
+	subtree.source = nil
+	delete(parent.files, name)
+	parent.dirs[name] = subtree
+	return nil
+}
@@ -0,0 +1,132 @@
+package directory_checksum
+
+import (
+	"bytes"
+	"github.com/spf13/afero"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setUpManifestTestingFilesystem() afero.Fs {
+	testingFilesystem := []TestingFilesystemObject{
+		TestingDir{absolutePath: filepath.FromSlash("/a")},
+		TestingDir{absolutePath: filepath.FromSlash("/a/x")},
+		TestingFile{absolutePath: filepath.FromSlash("/a/x/f"), content: "foo"},
+		TestingDir{absolutePath: filepath.FromSlash("/b")},
+		TestingFile{absolutePath: filepath.FromSlash("/b/file with spaces"), content: "bar"},
+		TestingFile{absolutePath: filepath.FromSlash("/f"), content: "baz"},
+	}
+	filesystemImpl := afero.NewMemMapFs()
+	setUpTestingFilesystem(testingFilesystem, filesystemImpl)
+	return filesystemImpl
+}
+
+func writeManifestOfPath(t *testing.T, absolutePath string, filesystemImpl afero.Fs, options ...ScanOption) string {
+	t.Helper()
+	d, err := ScanDirectory(absolutePath, filesystemImpl, options...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d.ComputeDirectoryChecksums()
+	buffer := bytes.Buffer{}
+	if err := d.WriteManifest(&buffer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return buffer.String()
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	filesystemImpl := setUpManifestTestingFilesystem()
+	manifest := writeManifestOfPath(t, string(filepath.Separator), filesystemImpl, WithHasher(SHA256))
+
+	if !strings.HasPrefix(manifest, "# directory-checksum manifest\n# version: 1\n# algorithm: sha256\n"+
+		"# scheme: directory-checksum-v1\n") {
+		t.Fatalf("Unexpected manifest header:\n%s", manifest)
+	}
+	if !strings.Contains(manifest, " F b/file with spaces\n") {
+		t.Fatalf("Manifest does not use forward slashes:\n%s", manifest)
+	}
+
+	d, err := ReadManifest(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	buffer := bytes.Buffer{}
+	d.WriteManifest(&buffer)
+	if got := buffer.String(); got != manifest {
+		t.Fatalf("Got\n%s\n\nwant\n%s", got, manifest)
+	}
+}
+
+func TestGraftMatchesSingleScan(t *testing.T) {
+	filesystemImpl := setUpManifestTestingFilesystem()
+	root := string(filepath.Separator)
+	want := writeManifestOfPath(t, root, filesystemImpl)
+
+	manifestA := writeManifestOfPath(t, filepath.FromSlash("/a"), filesystemImpl)
+	manifestB := writeManifestOfPath(t, filepath.FromSlash("/b"), filesystemImpl)
+	parentFilter := WithFilter(func(relativePath string, _ fs.FileInfo) bool { return relativePath == "f" })
+	parent, _ := ScanDirectory(root, filesystemImpl, parentFilter)
+
+	for relativePath, manifest := range map[string]string{"a": manifestA, "b": manifestB} {
+		subtree, err := ReadManifest(strings.NewReader(manifest))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := parent.Graft(relativePath, subtree); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	parent.ComputeDirectoryChecksums()
+	buffer := bytes.Buffer{}
+	parent.WriteManifest(&buffer)
+
+	if got := buffer.String(); got != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", got, want)
+	}
+}
+
+func TestGraftCreatesParentDirectories(t *testing.T) {
+	subtree, _ := NewTree().AddFile("f", strings.NewReader("foo")).Build()
+	d, _ := NewTree().Build()
+	if err := d.Graft("x/y", subtree); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d.ComputeDirectoryChecksums()
+
+	want, _ := NewTree().AddFile("x/y/f", strings.NewReader("foo")).Build()
+	want.ComputeDirectoryChecksums()
+	if got, want := d.PrintChecksums(5), want.PrintChecksums(5); got != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", got, want)
+	}
+}
+
+func TestGraftAlgorithmMismatch(t *testing.T) {
+	subtree, _ := NewTree(WithHasher(SHA256)).AddDir("d").Build()
+	d, _ := NewTree().Build()
+	if err := d.Graft("d", subtree); err == nil || !strings.Contains(err.Error(), "hash algorithm") {
+		t.Fatalf("Unexpected error was returned: %v", err)
+	}
+}
+
+func TestReadInvalidManifest(t *testing.T) {
+	header := "# directory-checksum manifest\n# version: 1\n# algorithm: sha1\n# scheme: directory-checksum-v1\n"
+	manifests := map[string]string{
+		"empty":                  "",
+		"missing header":         "da39a3ee5e6b4b0d3255bfef95601890afd80709 D .\n",
+		"unknown algorithm":      strings.Replace(header, "sha1", "md4", 1) + emptySha1 + " D .\n",
+		"unknown scheme":         strings.Replace(header, "-v1", "-v0", 1) + emptySha1 + " D .\n",
+		"missing root":           header,
+		"root not first":         header + "0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33 F f\n",
+		"unknown type":           header + emptySha1 + " X .\n",
+		"missing parent":         header + emptySha1 + " D .\n" + emptySha1 + " F d/f\n",
+		"inconsistent checksums": header + emptySha1 + " D .\n" + emptySha1 + " F f\n",
+	}
+	for name, manifest := range manifests {
+		if _, err := ReadManifest(strings.NewReader(manifest)); err == nil {
+			t.Fatalf("Expected error for case '%s' but did not get any", name)
+		}
+	}
+}
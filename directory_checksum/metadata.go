@@ -0,0 +1,90 @@
+package directory_checksum
+
+import (
+	"github.com/spf13/afero"
+	"io/fs"
+)
+
+// Metadata is the file system metadata of a file or directory, as far as it was available when the tree was created.
+// It does not affect the checksums of the default scheme. Known is false if no metadata is available, e.g. for trees
+// read from a manifest. UID and GID are -1 if the owner is unknown, e.g. on Windows.
+type Metadata struct {
+	// Known is true if Mode and Size are known.
+	Known bool
+	// Mode contains the type and permission bits.
+	Mode fs.FileMode
+	// Size is the size of a regular file's content, in bytes.
+	Size int64
+	UID  int
+	GID  int
+	// LinkTarget is the target of a symbolic link.
+	LinkTarget string
+	// Xattrs maps the names of the extended attributes to their values. They are only read if the Scheme depends on
+	// them (e.g. BuildKitScheme) or WithExtendedAttributes is used, and only on Linux and macOS (or from the PAX
+	// records of archives, see ArchiveFS).
+	Xattrs map[string]string
+}
+
+// unknownMetadata is used for entries whose metadata is not known.
+var unknownMetadata = Metadata{UID: -1, GID: -1}
+
+// Metadata returns the file system metadata of the directory.
+func (d *Directory) Metadata() Metadata {
+	return d.metadata
+}
+
+// Metadata returns the file system metadata of the file or symbolic link.
+func (f *File) Metadata() Metadata {
+	return f.metadata
+}
+
+// metadataFromFileInfo returns the Metadata of info. The LinkTarget is not set, because fs.FileInfo does not provide
+// it.
+func metadataFromFileInfo(info fs.FileInfo) Metadata {
+	metadata := Metadata{Known: true, Mode: info.Mode(), UID: -1, GID: -1}
+	if info.Mode().IsRegular() {
+		metadata.Size = info.Size()
+	}
+	if uid, gid, ok := fileOwner(info); ok {
+		metadata.UID, metadata.GID = uid, gid
+	} else if entry, isArchiveEntry := info.Sys().(*archiveEntry); isArchiveEntry {
+		metadata.UID, metadata.GID = entry.uid, entry.gid
+	}
+	return metadata
+}
+
+// metadata returns the Metadata of the file or directory at absolutePath, which is described by info. The extended
+// attributes are only read if the scheme depends on them (or WithExtendedAttributes is used), and the file is located
+// in the OS file system or in an ArchiveFS.
+func (o *scanOptions) metadata(absolutePath string, info fs.FileInfo, filesystemImpl afero.Fs) (Metadata, error) {
+	metadata := metadataFromFileInfo(info)
+	if !o.scheme.readsExtendedAttributes && !o.extendedAttributes {
+		return metadata, nil
+	}
+	if entry, isArchiveEntry := info.Sys().(*archiveEntry); isArchiveEntry {
+		metadata.Xattrs = entry.xattrs
+	} else if _, isOsFs := filesystemImpl.(*afero.OsFs); isOsFs {
+		xattrs, err := readExtendedAttributes(absolutePath)
+		if err != nil {
+			return Metadata{}, err
+		}
+		metadata.Xattrs = xattrs
+	}
+	return metadata, nil
+}
+
+// unixPermissions returns the permission bits of mode, including the setuid, setgid and sticky bits, as used by Unix
+// (e.g. 04755).
+func unixPermissions(mode fs.FileMode) uint32 {
+	permissions := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		permissions |= 04000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		permissions |= 02000
+	}
+	if mode&fs.ModeSticky != 0 {
+		permissions |= 01000
+	}
+	return permissions
+}
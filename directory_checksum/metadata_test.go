@@ -0,0 +1,44 @@
+package directory_checksum
+
+import (
+	"github.com/spf13/afero"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScannedMetadata(t *testing.T) {
+	tempDir := t.TempDir()
+	os.Mkdir(filepath.Join(tempDir, "d"), 0750)
+	os.WriteFile(filepath.Join(tempDir, "d", "f"), []byte("foo"), 0640)
+	os.Chmod(filepath.Join(tempDir, "d", "f"), 0740)
+	symlinkErr := os.Symlink("d/f", filepath.Join(tempDir, "link"))
+
+	d, err := ScanDirectory(tempDir, afero.NewOsFs())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	subDir, _ := d.Lookup("d")
+	if got := subDir.(*Directory).Metadata().Mode; got != fs.ModeDir|0750 {
+		t.Fatalf("Got directory mode %v", got)
+	}
+	file, _ := d.Lookup(filepath.Join("d", "f"))
+	metadata := file.(*File).Metadata()
+	if metadata.Size != 3 || (metadata.Mode.Perm() != 0740 && metadata.Mode.Perm() != 0666) {
+		t.Fatalf("Got file metadata %+v", metadata)
+	}
+	if symlinkErr == nil {
+		link, _ := d.Lookup("link")
+		if got := link.(*File).Metadata().LinkTarget; got != "d/f" {
+			t.Fatalf("Got link target %s, want d/f", got)
+		}
+	}
+}
+
+func TestUnixPermissions(t *testing.T) {
+	if got := unixPermissions(fs.ModeDir | fs.ModeSetuid | fs.ModeSticky | 0755); got != 05755 {
+		t.Fatalf("Got %o, want 5755", got)
+	}
+}
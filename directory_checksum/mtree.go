@@ -0,0 +1,457 @@
+package directory_checksum
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/go-errors/errors"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const mtreeHeader = "#mtree"
+
+// mtreeDigestKeywords maps the mtree keywords that contain file digests to the corresponding hash algorithm.
+var mtreeDigestKeywords = map[string]HashAlgorithm{
+	"md5":          MD5,
+	"md5digest":    MD5,
+	"sha1":         SHA1,
+	"sha1digest":   SHA1,
+	"sha256":       SHA256,
+	"sha256digest": SHA256,
+	"sha384":       SHA384,
+	"sha384digest": SHA384,
+	"sha512":       SHA512,
+	"sha512digest": SHA512,
+}
+
+// An MtreeEntry is one file or directory of an mtree specification, with all of its keywords (including the defaults
+// set by "/set" lines). Keywords without value, such as "optional", map to an empty string.
+type MtreeEntry struct {
+	// Path is the slash-separated path of the entry, relative to the root directory, which itself has the path ".".
+	Path     string
+	Keywords map[string]string
+}
+
+// An MtreeSpec is an mtree specification (see mtree(5)), as read by ReadMtree.
+type MtreeSpec struct {
+	Entries []MtreeEntry
+}
+
+// An MtreeDifference is a difference between an mtree specification and a Directory tree. For DifferenceModified and
+// DifferenceTypeChanged, Keyword names the mtree keyword whose value differs, and Expected and Actual contain the
+// values.
+type MtreeDifference struct {
+	// Path is the slash-separated path of the entry, relative to the root directory.
+	Path     string
+	Kind     DifferenceKind
+	Keyword  string
+	Expected string
+	Actual   string
+}
+
+func (d MtreeDifference) String() string {
+	if d.Keyword == "" {
+		return fmt.Sprintf("%s: %s", d.Kind, d.Path)
+	}
+	return fmt.Sprintf("%s: %s (%s: expected %s, got %s)", d.Kind, d.Path, d.Keyword, d.Expected, d.Actual)
+}
+
+// WriteMtree writes an mtree specification of d to w, which lists every entry with its full path (e.g. "./a/b") and
+// the keywords type, mode, uid, gid, size, sha256digest and link, as far as they are known. The tree must have
+// SHA256 digests, i.e. it must have been scanned with SHA256 as hash algorithm or extra hash algorithm.
+func (d *Directory) WriteMtree(w io.Writer) error {
+	bufferedWriter := bufio.NewWriter(w)
+	if _, err := fmt.Fprintln(bufferedWriter, mtreeHeader); err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	for relativePath, entry := range d.PreOrder() {
+		name := "."
+		if relativePath != "." {
+			name = "./" + filepath.ToSlash(relativePath)
+		}
+		keywords := []string{"type=" + mtreeType(entry.Type())}
+		metadata := entryMetadata(entry)
+		if metadata.Known {
+			keywords = append(keywords, fmt.Sprintf("mode=%04o", unixPermissions(metadata.Mode)))
+		}
+		if metadata.UID >= 0 && metadata.GID >= 0 {
+			keywords = append(keywords, fmt.Sprintf("uid=%d", metadata.UID), fmt.Sprintf("gid=%d", metadata.GID))
+		}
+		if file, ok := entry.(*File); ok {
+			if file.isSymbolicLink {
+				keywords = append(keywords, "link="+escapeMtreeName(metadata.LinkTarget))
+			} else {
+				if metadata.Known {
+					keywords = append(keywords, fmt.Sprintf("size=%d", metadata.Size))
+				}
+				digest, ok := d.options.digest(file, SHA256.Name)
+				if !ok {
+					return errors.New("unable to write mtree specification: the tree must be scanned with SHA256 " +
+						"digests (see WithExtraHashers)")
+				}
+				keywords = append(keywords, "sha256digest="+digest)
+			}
+		}
+		_, err := fmt.Fprintf(bufferedWriter, "%s %s\n", escapeMtreeName(name), strings.Join(keywords, " "))
+		if err != nil {
+			return errors.Wrap(err, 0)
+		}
+	}
+
+	if err := bufferedWriter.Flush(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+// IsMtree returns true if data (or its beginning) looks like an mtree specification, i.e. it starts with "#mtree",
+// or its first line that is not a comment is a "/set" line or has a "type" keyword.
+func IsMtree(data []byte) bool {
+	if bytes.HasPrefix(data, []byte(mtreeHeader)) {
+		return true
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "/set" {
+			return true
+		}
+		for _, field := range fields[1:] {
+			if strings.HasPrefix(field, "type=") {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// ReadMtree reads an mtree specification (see mtree(5)) from r, which may use full paths (as written by WriteMtree or
+// libarchive), or relative paths with ".." lines (as written by "mtree -c").
+func ReadMtree(r io.Reader) (*MtreeSpec, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	spec := MtreeSpec{}
+	defaults := map[string]string{}
+	currentDir := "."
+	var parentDirs []string
+	lineNumber := 0
+	line := ""
+	for scanner.Scan() {
+		lineNumber++
+		line += scanner.Text()
+		if strings.HasSuffix(line, "\\") {
+			// continuation line
+			line = strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		fields := strings.Fields(line)
+		line = ""
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		switch fields[0] {
+		case "/set":
+			for keyword, value := range parseMtreeKeywords(fields[1:]) {
+				defaults[keyword] = value
+			}
+			continue
+		case "/unset":
+			for _, keyword := range fields[1:] {
+				if keyword == "all" {
+					defaults = map[string]string{}
+				}
+				delete(defaults, keyword)
+			}
+			continue
+		case "..":
+			if len(parentDirs) == 0 {
+				return nil, errors.Errorf("invalid mtree specification in line %d: '..' above the root directory",
+					lineNumber)
+			}
+			currentDir, parentDirs = parentDirs[len(parentDirs)-1], parentDirs[:len(parentDirs)-1]
+			continue
+		}
+
+		name, err := unescapeMtreeName(fields[0])
+		if err != nil {
+			return nil, errors.Errorf("invalid mtree specification in line %d: %v", lineNumber, err)
+		}
+		keywords := map[string]string{}
+		for keyword, value := range defaults {
+			keywords[keyword] = value
+		}
+		for keyword, value := range parseMtreeKeywords(fields[1:]) {
+			keywords[keyword] = value
+		}
+		if keywords["type"] == "" {
+			keywords["type"] = "file"
+		}
+
+		var relativePath string
+		if strings.Contains(name, "/") {
+			relativePath = path.Clean(name)
+		} else {
+			relativePath = path.Join(currentDir, name)
+			if keywords["type"] == "dir" {
+				parentDirs = append(parentDirs, currentDir)
+				currentDir = relativePath
+			}
+		}
+		if path.IsAbs(relativePath) || relativePath == ".." || strings.HasPrefix(relativePath, "../") {
+			return nil, errors.Errorf("invalid mtree specification in line %d: '%s' is not a relative path below "+
+				"the root directory", lineNumber, name)
+		}
+		spec.Entries = append(spec.Entries, MtreeEntry{Path: relativePath, Keywords: keywords})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	if len(spec.Entries) == 0 {
+		return nil, errors.New("invalid mtree specification: it does not contain any entries")
+	}
+	return &spec, nil
+}
+
+// HashAlgorithms returns the hash algorithms of all digest keywords (such as "sha256digest") that are used by the
+// specification, sorted by name. Verify() requires a tree that contains the digests of these algorithms.
+func (s *MtreeSpec) HashAlgorithms() []HashAlgorithm {
+	algorithmsByName := map[string]HashAlgorithm{}
+	for _, entry := range s.Entries {
+		for keyword := range entry.Keywords {
+			if algorithm, ok := mtreeDigestKeywords[keyword]; ok {
+				algorithmsByName[algorithm.Name] = algorithm
+			}
+		}
+	}
+	var algorithms []HashAlgorithm
+	for _, name := range sortedKeys(algorithmsByName) {
+		algorithms = append(algorithms, algorithmsByName[name])
+	}
+	return algorithms
+}
+
+// Verify checks d against the specification and returns the differences, sorted by path. The keywords type, mode,
+// uid, gid, size, link and the digest keywords are verified, as far as d's Metadata is known (mode is not verified
+// for symbolic links, because their permissions are platform-specific). Other keywords, such as time, are ignored.
+// Entries with the "optional" keyword may be missing, the children of entries with the "ignore" keyword are not
+// verified, and only the existence of entries with the "nochange" keyword is verified. Entries that exist in d but not
+// in the specification are reported as added (for directories, without listing their children).
+func (s *MtreeSpec) Verify(d *Directory) ([]MtreeDifference, error) {
+	var differences []MtreeDifference
+	specifiedPaths := map[string]bool{}
+	var ignoredDirs []string
+	for _, entry := range s.Entries {
+		specifiedPaths[entry.Path] = true
+		if _, ignore := entry.Keywords["ignore"]; ignore {
+			ignoredDirs = append(ignoredDirs, entry.Path)
+		}
+
+		actual, exists := d.Lookup(entry.Path)
+		if !exists {
+			if _, optional := entry.Keywords["optional"]; !optional {
+				differences = append(differences, MtreeDifference{Path: entry.Path, Kind: DifferenceRemoved})
+			}
+			continue
+		}
+		if actualType := mtreeType(actual.Type()); actualType != entry.Keywords["type"] {
+			differences = append(differences, MtreeDifference{Path: entry.Path, Kind: DifferenceTypeChanged,
+				Keyword: "type", Expected: entry.Keywords["type"], Actual: actualType})
+			continue
+		}
+		if _, nochange := entry.Keywords["nochange"]; nochange {
+			continue
+		}
+
+		for _, keyword := range sortedKeys(entry.Keywords) {
+			actualValue, verifiable, err := d.mtreeKeywordValue(actual, keyword, entry.Keywords[keyword])
+			if err != nil {
+				return nil, errors.Errorf("unable to verify '%s': %v", entry.Path, err)
+			}
+			if verifiable && actualValue != entry.Keywords[keyword] {
+				differences = append(differences, MtreeDifference{Path: entry.Path, Kind: DifferenceModified,
+					Keyword: keyword, Expected: entry.Keywords[keyword], Actual: actualValue})
+			}
+		}
+	}
+
+	var addedDirs []string
+	for relativePath, entry := range d.PreOrder() {
+		relativePath = filepath.ToSlash(relativePath)
+		if specifiedPaths[relativePath] || hasPathPrefix(relativePath, ignoredDirs) ||
+			hasPathPrefix(relativePath, addedDirs) {
+			continue
+		}
+		differences = append(differences, MtreeDifference{Path: relativePath, Kind: DifferenceAdded})
+		if entry.Type() == TypeDir {
+			addedDirs = append(addedDirs, relativePath)
+		}
+	}
+
+	sort.SliceStable(differences, func(i, j int) bool { return differences[i].Path < differences[j].Path })
+	return differences, nil
+}
+
+// mtreeKeywordValue returns the value of keyword for entry (a member of d's tree), normalized to be comparable with
+// expectedValue. The second return value is false if the keyword cannot be verified, e.g. because it is not supported
+// or the entry's Metadata is unknown.
+func (d *Directory) mtreeKeywordValue(entry Entry, keyword string, expectedValue string) (string, bool, error) {
+	metadata := entryMetadata(entry)
+	file, isFile := entry.(*File)
+	switch keyword {
+	case "mode":
+		if !metadata.Known || entry.Type() == TypeSymlink {
+			return "", false, nil
+		}
+		expectedMode, err := strconv.ParseUint(expectedValue, 8, 32)
+		if err != nil {
+			return "", false, errors.Errorf("unsupported mode '%s': only octal modes are supported", expectedValue)
+		}
+		actualMode := unixPermissions(metadata.Mode)
+		if uint32(expectedMode) == actualMode {
+			return expectedValue, true, nil
+		}
+		return fmt.Sprintf("%04o", actualMode), true, nil
+	case "uid":
+		return strconv.Itoa(metadata.UID), metadata.UID >= 0, nil
+	case "gid":
+		return strconv.Itoa(metadata.GID), metadata.GID >= 0, nil
+	case "size":
+		return strconv.FormatInt(metadata.Size, 10), entry.Type() == TypeFile && metadata.Known, nil
+	case "link":
+		if entry.Type() != TypeSymlink {
+			return "", false, nil
+		}
+		expectedTarget, err := unescapeMtreeName(expectedValue)
+		if err != nil {
+			return "", false, err
+		}
+		if expectedTarget == metadata.LinkTarget {
+			return expectedValue, true, nil
+		}
+		return escapeMtreeName(metadata.LinkTarget), true, nil
+	}
+
+	algorithm, isDigest := mtreeDigestKeywords[keyword]
+	if !isDigest || !isFile || file.isSymbolicLink {
+		return "", false, nil
+	}
+	digest, ok := d.options.digest(file, algorithm.Name)
+	if !ok {
+		return "", false, errors.Errorf("the tree does not contain %s digests", algorithm.Name)
+	}
+	if strings.EqualFold(digest, expectedValue) {
+		return expectedValue, true, nil
+	}
+	return digest, true, nil
+}
+
+// entryMetadata returns the Metadata of entry.
+func entryMetadata(entry Entry) Metadata {
+	if file, ok := entry.(*File); ok {
+		return file.metadata
+	}
+	return entry.(*Directory).metadata
+}
+
+// mtreeType returns the value of the mtree "type" keyword for fileType.
+func mtreeType(fileType FileType) string {
+	switch fileType {
+	case TypeDir:
+		return "dir"
+	case TypeSymlink:
+		return "link"
+	default:
+		return "file"
+	}
+}
+
+// hasPathPrefix returns true if relativePath is located below one of the directories in dirs.
+func hasPathPrefix(relativePath string, dirs []string) bool {
+	for _, dir := range dirs {
+		if dir == "." || strings.HasPrefix(relativePath, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseMtreeKeywords parses "keyword=value" (or just "keyword") fields.
+func parseMtreeKeywords(fields []string) map[string]string {
+	keywords := map[string]string{}
+	for _, field := range fields {
+		keyword, value, _ := strings.Cut(field, "=")
+		keywords[keyword] = value
+	}
+	return keywords
+}
+
+// escapeMtreeName encodes all characters of name that are not safe in mtree files (white space, non-printable
+// characters, '#', '=' and '\') as backslash followed by three octal digits, like libarchive does.
+func escapeMtreeName(name string) string {
+	escaped := strings.Builder{}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c <= ' ' || c >= 0x7f || c == '#' || c == '=' || c == '\\' {
+			_, _ = fmt.Fprintf(&escaped, "\\%03o", c)
+		} else {
+			escaped.WriteByte(c)
+		}
+	}
+	return escaped.String()
+}
+
+// unescapeMtreeName reverses escapeMtreeName. It also supports the C-style escape sequences that are written by
+// strsvis(3), such as "\s" for a space.
+func unescapeMtreeName(escapedName string) (string, error) {
+	unescaped := strings.Builder{}
+	for i := 0; i < len(escapedName); i++ {
+		if escapedName[i] != '\\' {
+			unescaped.WriteByte(escapedName[i])
+			continue
+		}
+		if i+3 < len(escapedName) && isOctalDigits(escapedName[i+1:i+4]) {
+			if value, err := strconv.ParseUint(escapedName[i+1:i+4], 8, 8); err == nil {
+				unescaped.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+		i++
+		if i == len(escapedName) {
+			return "", errors.New("invalid escape sequence at the end of a name")
+		}
+		switch escapedName[i] {
+		case 's':
+			unescaped.WriteByte(' ')
+		case 't':
+			unescaped.WriteByte('\t')
+		case 'n':
+			unescaped.WriteByte('\n')
+		case 'r':
+			unescaped.WriteByte('\r')
+		default:
+			unescaped.WriteByte(escapedName[i])
+		}
+	}
+	return unescaped.String(), nil
+}
+
+func isOctalDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '7' {
+			return false
+		}
+	}
+	return true
+}
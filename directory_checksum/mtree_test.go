@@ -0,0 +1,156 @@
+package directory_checksum
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func buildMtreeTestingTree() *Directory {
+	d, _ := NewTree(WithHasher(SHA256)).
+		AddFile("a b/f", strings.NewReader("foo")).
+		AddSymlink("link", "a b/f").
+		AddDir("empty").
+		Build()
+	return d
+}
+
+func TestWriteMtree(t *testing.T) {
+	d := buildMtreeTestingTree()
+
+	buffer := bytes.Buffer{}
+	if err := d.WriteMtree(&buffer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := "#mtree\n" +
+		". type=dir mode=0755\n" +
+		"./a\\040b type=dir mode=0755\n" +
+		"./a\\040b/f type=file mode=0644 size=3 " +
+		"sha256digest=2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae\n" +
+		"./empty type=dir mode=0755\n" +
+		"./link type=link mode=0777 link=a\\040b/f\n"
+	if buffer.String() != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", buffer.String(), want)
+	}
+
+	spec, err := ReadMtree(&buffer)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	differences, err := spec.Verify(d)
+	if err != nil || len(differences) > 0 {
+		t.Fatalf("Got differences %v and error %v", differences, err)
+	}
+}
+
+func TestWriteMtreeModeZero(t *testing.T) {
+	d, _ := NewTree(WithHasher(SHA256)).AddFile("f", strings.NewReader("foo")).Build()
+	d.files["f"].metadata.Mode = 0
+
+	buffer := bytes.Buffer{}
+	if err := d.WriteMtree(&buffer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := "#mtree\n" +
+		". type=dir mode=0755\n" +
+		"./f type=file mode=0000 size=3 " +
+		"sha256digest=2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae\n"
+	if buffer.String() != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", buffer.String(), want)
+	}
+
+	spec, _ := ReadMtree(strings.NewReader(strings.Replace(want, "mode=0000", "mode=0644", 1)))
+	differences, err := spec.Verify(d)
+	if err != nil || len(differences) != 1 || differences[0].Actual != "0000" {
+		t.Fatalf("Got differences %v and error %v", differences, err)
+	}
+}
+
+func TestReadMtreeRelativePaths(t *testing.T) {
+	spec, err := ReadMtree(strings.NewReader("#\t   user: root\n" +
+		"/set type=file mode=0644\n" +
+		".               type=dir mode=0755\n" +
+		"    a\\sb        type=dir mode=0755\n" +
+		"        f       size=3 \\\n" +
+		"                sha256=2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae\n" +
+		"    ..\n" +
+		"    link        type=link link=a\\040b/f\n" +
+		"    empty       type=dir mode=0755 optional\n" +
+		"    ..\n" +
+		"..\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var paths []string
+	for _, entry := range spec.Entries {
+		paths = append(paths, entry.Path)
+	}
+	wantPaths := []string{".", "a b", "a b/f", "link", "empty"}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Fatalf("Got paths %v, want %v", paths, wantPaths)
+	}
+	if spec.Entries[2].Keywords["mode"] != "0644" || spec.Entries[2].Keywords["type"] != "file" {
+		t.Fatalf("Got keywords %v", spec.Entries[2].Keywords)
+	}
+	if algorithms := spec.HashAlgorithms(); len(algorithms) != 1 || algorithms[0].Name != SHA256.Name {
+		t.Fatalf("Got algorithms %v", algorithms)
+	}
+
+	differences, err := spec.Verify(buildMtreeTestingTree())
+	if err != nil || len(differences) > 0 {
+		t.Fatalf("Got differences %v and error %v", differences, err)
+	}
+}
+
+func TestVerifyMtreeDifferences(t *testing.T) {
+	spec, _ := ReadMtree(strings.NewReader("#mtree\n" +
+		". type=dir\n" +
+		"./a\\040b type=dir mode=0700\n" +
+		"./a\\040b/f type=file size=4 sha256digest=0000\n" +
+		"./link type=file\n" +
+		"./missing type=file\n"))
+
+	differences, err := spec.Verify(buildMtreeTestingTree())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got []string
+	for _, difference := range differences {
+		got = append(got, difference.String())
+	}
+	want := []string{
+		"modified: a b (mode: expected 0700, got 0755)",
+		"modified: a b/f (sha256digest: expected 0000, got " +
+			"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae)",
+		"modified: a b/f (size: expected 4, got 3)",
+		"added: empty",
+		"type changed: link (type: expected file, got link)",
+		"removed: missing",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Got\n%s\n\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestVerifyMtreeRequiresDigests(t *testing.T) {
+	spec, _ := ReadMtree(strings.NewReader("./a\\040b/f type=file md5digest=acbd18db4cc2f85cedef654fccc4a4d8\n"))
+
+	if _, err := spec.Verify(buildMtreeTestingTree()); err == nil {
+		t.Fatal("Expected error but did not get any")
+	}
+}
+
+func TestIsMtree(t *testing.T) {
+	for data, want := range map[string]bool{
+		"#mtree\n":                    true,
+		"# comment\n/set type=file\n": true,
+		". type=dir\n":                true,
+		"0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33  f\n": false,
+	} {
+		if got := IsMtree([]byte(data)); got != want {
+			t.Fatalf("Got %v for %q, want %v", got, data, want)
+		}
+	}
+}
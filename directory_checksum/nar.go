@@ -0,0 +1,222 @@
+package directory_checksum
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/go-errors/errors"
+	"hash"
+	"io"
+	"io/fs"
+	"sort"
+)
+
+// narMagic is the string that starts every Nix Archive (NAR).
+const narMagic = "nix-archive-1"
+
+// nixBase32Alphabet is the alphabet of Nix's base-32 encoding, which omits the letters e, o, u and t.
+const nixBase32Alphabet = "0123456789abcdfghijklmnpqrsvwxyz"
+
+// narString returns the NAR encoding of s: its length as 64-bit little-endian integer, followed by s, padded with zero
+// bytes to a multiple of 8 bytes.
+func narString(s string) []byte {
+	encoded := binary.LittleEndian.AppendUint64(nil, uint64(len(s)))
+	encoded = append(encoded, s...)
+	return append(encoded, narPadding(int64(len(s)))...)
+}
+
+// narStrings returns the concatenated NAR encodings of all strings.
+func narStrings(strings ...string) []byte {
+	var encoded []byte
+	for _, s := range strings {
+		encoded = append(encoded, narString(s)...)
+	}
+	return encoded
+}
+
+// narPadding returns the zero bytes that pad a string of the provided length to a multiple of 8 bytes.
+func narPadding(length int64) []byte {
+	return make([]byte, (8-length%8)%8)
+}
+
+// narIsExecutable returns true if Nix considers a file with the provided metadata to be executable.
+func narIsExecutable(metadata Metadata) bool {
+	return metadata.Mode&0100 != 0
+}
+
+// narFileHasher is a hash.Hash that computes the hash of the NAR serialization of a single file (or symbolic link),
+// when fed with the file's content (or the link's target). Sum() may only be called once.
+type narFileHasher struct {
+	hash.Hash
+	contentSize int64
+	finished    bool
+}
+
+// newNarFileHasher returns a narFileHasher for a file with the provided metadata.
+func newNarFileHasher(algorithm HashAlgorithm, metadata Metadata, contentSize int64) hash.Hash {
+	hasher := narFileHasher{Hash: algorithm.New(), contentSize: contentSize}
+	hasher.Hash.Write(narStrings(narMagic, "("))
+	if metadata.Mode&fs.ModeSymlink != 0 {
+		hasher.Hash.Write(narStrings("type", "symlink", "target"))
+	} else {
+		hasher.Hash.Write(narStrings("type", "regular"))
+		if narIsExecutable(metadata) {
+			hasher.Hash.Write(narStrings("executable", ""))
+		}
+		hasher.Hash.Write(narStrings("contents"))
+	}
+	hasher.Hash.Write(binary.LittleEndian.AppendUint64(nil, uint64(contentSize)))
+	return &hasher
+}
+
+func (h *narFileHasher) Sum(b []byte) []byte {
+	if !h.finished {
+		h.Hash.Write(narPadding(h.contentSize))
+		h.Hash.Write(narString(")"))
+		h.finished = true
+	}
+	return h.Hash.Sum(b)
+}
+
+// narWriter writes the NAR serialization of a tree to out. If newHasher is set, it also computes the checksum of every
+// directory it serializes, i.e. the hash of the NAR serialization that has this directory as root.
+type narWriter struct {
+	out       io.Writer
+	newHasher func() hash.Hash
+	// hashers contains one hash.Hash for each directory that is currently being serialized.
+	hashers []hash.Hash
+}
+
+func (w *narWriter) Write(p []byte) (int, error) {
+	for _, hasher := range w.hashers {
+		hasher.Write(p)
+	}
+	return w.out.Write(p)
+}
+
+// writeNode writes the NAR serialization of entry (without the magic string that starts an archive).
+func (w *narWriter) writeNode(entry Entry) error {
+	switch entry := entry.(type) {
+	case *Directory:
+		return w.writeDirectory(entry)
+	case *File:
+		return w.writeFile(entry)
+	}
+	return nil
+}
+
+// writeDirectory writes the NAR serialization of d and, if newHasher is set, updates d's checksum.
+func (w *narWriter) writeDirectory(d *Directory) error {
+	if w.newHasher != nil {
+		hasher := w.newHasher()
+		hasher.Write(narString(narMagic))
+		w.hashers = append(w.hashers, hasher)
+	}
+	if _, err := w.Write(narStrings("(", "type", "directory")); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	// Nix sorts the entries by name, regardless of their type
+	names := append(sortedKeys(d.dirs), sortedKeys(d.files)...)
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := w.Write(narStrings("entry", "(", "name", name, "node")); err != nil {
+			return errors.Wrap(err, 0)
+		}
+		if err := w.writeNode(d.child(name)); err != nil {
+			return err
+		}
+		if _, err := w.Write(narString(")")); err != nil {
+			return errors.Wrap(err, 0)
+		}
+	}
+	if _, err := w.Write(narString(")")); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	if w.newHasher != nil {
+		hasher := w.hashers[len(w.hashers)-1]
+		w.hashers = w.hashers[:len(w.hashers)-1]
+		d.checksum = hex.EncodeToString(hasher.Sum(nil))
+	}
+	return nil
+}
+
+// writeFile writes the NAR serialization of the regular file or symbolic link f.
+func (w *narWriter) writeFile(f *File) error {
+	if f.isSymbolicLink {
+		if _, err := w.Write(narStrings("(", "type", "symlink", "target", f.metadata.LinkTarget, ")")); err != nil {
+			return errors.Wrap(err, 0)
+		}
+		return nil
+	}
+	if f.content == nil {
+		return errors.New("unable to serialize a file whose content is not available")
+	}
+
+	header := narStrings("(", "type", "regular")
+	if narIsExecutable(f.metadata) {
+		header = append(header, narStrings("executable", "")...)
+	}
+	header = append(header, narString("contents")...)
+	header = binary.LittleEndian.AppendUint64(header, uint64(f.metadata.Size))
+	if _, err := w.Write(header); err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	content, err := f.content()
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	defer content.Close()
+	written, err := io.Copy(w, content)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	if written != f.metadata.Size {
+		return errors.Errorf("the file's size changed from %d to %d bytes since it was scanned", f.metadata.Size,
+			written)
+	}
+	if _, err := w.Write(append(narPadding(written), narString(")")...)); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+// narDirectoryChecksum returns the hash of the NAR serialization of d. Since it is not possible to derive this hash
+// from the checksums of d's children, the content of all files is read again, and the checksums of all directories
+// below d are computed in the same pass.
+func narDirectoryChecksum(d *Directory) (string, error) {
+	w := narWriter{out: io.Discard, newHasher: d.options.hasher.New}
+	if err := w.writeDirectory(d); err != nil {
+		return "", err
+	}
+	return d.checksum, nil
+}
+
+// WriteNAR writes the Nix Archive (NAR) serialization of d to w, as created by "nix-store --dump". It requires the
+// content of the files, i.e. d must have been scanned (e.g. with ScanDirectory) or built with a TreeBuilder.
+func (d *Directory) WriteNAR(w io.Writer) error {
+	narWriter := narWriter{out: w}
+	if _, err := narWriter.Write(narString(narMagic)); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return narWriter.writeDirectory(d)
+}
+
+// EncodeNixBase32 encodes data with the base-32 encoding of Nix, as used in store paths and by "nix hash --base32".
+func EncodeNixBase32(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	length := (len(data)*8-1)/5 + 1
+	encoded := make([]byte, 0, length)
+	for n := length - 1; n >= 0; n-- {
+		b := n * 5
+		i := b / 8
+		j := b % 8
+		c := data[i] >> j
+		if i+1 < len(data) {
+			c |= data[i+1] << (8 - j)
+		}
+		encoded = append(encoded, nixBase32Alphabet[c&0x1f])
+	}
+	return string(encoded)
+}
@@ -0,0 +1,99 @@
+package directory_checksum
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNarScheme(t *testing.T) {
+	tempDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tempDir, "d", "x"), 0755)
+	os.MkdirAll(filepath.Join(tempDir, "e"), 0755)
+	os.WriteFile(filepath.Join(tempDir, "d", "f"), []byte("foo"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "d.x"), []byte("bar"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "run"), []byte("#!"), 0755)
+	if err := os.Symlink("d/f", filepath.Join(tempDir, "link")); err != nil {
+		t.Skipf("Test skipped because creating the symbolic link failed (most likely cause is Windows, where "+
+			"admin privileges are required). Error: %v", err)
+	}
+
+	d, err := ScanDirectory(tempDir, afero.NewOsFs(), WithHasher(SHA256), WithScheme(NarScheme))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d.ComputeDirectoryChecksums()
+
+	// Expected values are the SHA-256 hashes of the NAR serializations, as computed by "nix hash path --base16"
+	if d.Checksum() != "ed8f0b9a02c3a7b02a166ce7d4d85737ff49f3220d3bce5a7b6c839342e29444" {
+		t.Fatalf("Got root checksum %s", d.Checksum())
+	}
+	subDir, _ := d.Lookup("d")
+	if subDir.Checksum() != "4a83b0e0f136e4e60c90d48b64f12089ff759feab4954b86d452c8a2bfc65d74" {
+		t.Fatalf("Got checksum %s of d", subDir.Checksum())
+	}
+	file, _ := d.Lookup("d/f")
+	if file.Checksum() != "fe530adc3ab7112fc3463776359c73bb99de2a2b72115983a72d04effa656b21" {
+		t.Fatalf("Got checksum %s of d/f", file.Checksum())
+	}
+
+	// the hash of the NAR stream is the root checksum
+	buffer := bytes.Buffer{}
+	if err := d.WriteNAR(&buffer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sum := sha256.Sum256(buffer.Bytes()); hex.EncodeToString(sum[:]) != d.Checksum() {
+		t.Fatalf("Got NAR hash %x, want %s", sum, d.Checksum())
+	}
+}
+
+func TestNarSchemeTreeBuilder(t *testing.T) {
+	d, _ := NewTree(WithHasher(SHA256), WithScheme(NarScheme), WithExtraHashers(SHA256)).
+		AddFile("a/b.txt", strings.NewReader("foo")).
+		AddSymlink("c", "a").
+		Build()
+	d.ComputeDirectoryChecksums()
+
+	if d.Checksum() != "5511d97699b32d9699c09ce2622bc83a06ad017e3259ee5bdbaefdab17cb26c6" {
+		t.Fatalf("Got root checksum %s", d.Checksum())
+	}
+
+	// the checksum list contains the plain digests, not the NAR hashes
+	buffer := bytes.Buffer{}
+	if err := d.WriteChecksumList(&buffer, false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae  a/b.txt\n"
+	if buffer.String() != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", buffer.String(), want)
+	}
+}
+
+func TestWriteNARWithoutContent(t *testing.T) {
+	built, _ := NewTree().AddFile("f", strings.NewReader("foo")).Build()
+	built.ComputeDirectoryChecksums()
+	manifest := bytes.Buffer{}
+	built.WriteManifest(&manifest)
+	d, err := ReadManifest(&manifest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err = d.WriteNAR(&bytes.Buffer{}); err == nil {
+		t.Fatal("Expected error but did not get any")
+	}
+}
+
+func TestEncodeNixBase32(t *testing.T) {
+	sum := sha256.Sum256(nil)
+	if got := EncodeNixBase32(sum[:]); got != "0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c73" {
+		t.Fatalf("Got %s", got)
+	}
+	if got := EncodeNixBase32(nil); got != "" {
+		t.Fatalf("Got %s", got)
+	}
+}
@@ -0,0 +1,182 @@
+package directory_checksum
+
+import (
+	"github.com/go-errors/errors"
+	"io/fs"
+	"iter"
+	"path/filepath"
+	"strings"
+)
+
+// An Entry is an element of a Directory tree, which is either a *Directory or a *File.
+type Entry interface {
+	// Checksum returns the checksum of the entry, in hexadecimal notation.
+	Checksum() string
+	// Type returns TypeDir for a *Directory, and TypeFile or TypeSymlink for a *File.
+	Type() FileType
+}
+
+// Checksum returns the checksum of the directory. It is empty until ComputeDirectoryChecksums() has been called.
+func (d *Directory) Checksum() string {
+	return d.checksum
+}
+
+// Algorithm returns the hash algorithm that is used for the checksums of the tree d belongs to.
+func (d *Directory) Algorithm() HashAlgorithm {
+	return d.options.hasher
+}
+
+// Type always returns TypeDir.
+func (d *Directory) Type() FileType {
+	return TypeDir
+}
+
+// Checksum returns the checksum of the file's content (or of the link target, for symbolic links).
+func (f *File) Checksum() string {
+	return f.checksum
+}
+
+// Type returns TypeSymlink for symbolic links, and TypeFile otherwise.
+func (f *File) Type() FileType {
+	if f.isSymbolicLink {
+		return TypeSymlink
+	}
+	return TypeFile
+}
+
+// Files returns an iterator over the immediate child files of d, yielding their names and File objects in
+// alphabetical order.
+func (d *Directory) Files() iter.Seq2[string, *File] {
+	return func(yield func(string, *File) bool) {
+		for _, fileName := range sortedKeys(d.files) {
+			if !yield(fileName, d.files[fileName]) {
+				return
+			}
+		}
+	}
+}
+
+// Dirs returns an iterator over the immediate child directories of d, yielding their names and Directory objects in
+// alphabetical order.
+func (d *Directory) Dirs() iter.Seq2[string, *Directory] {
+	return func(yield func(string, *Directory) bool) {
+		for _, dirName := range sortedKeys(d.dirs) {
+			if !yield(dirName, d.dirs[dirName]) {
+				return
+			}
+		}
+	}
+}
+
+// Lookup returns the Entry located at relativePath, which may use forward slashes or the OS-specific path separator.
+// The path "." refers to d itself. The second return value is false if no such entry exists.
+func (d *Directory) Lookup(relativePath string) (Entry, bool) {
+	relativePath = filepath.ToSlash(filepath.Clean(relativePath))
+	if relativePath == "." {
+		return d, true
+	}
+
+	components := strings.Split(relativePath, "/")
+	current := d
+	for _, component := range components[:len(components)-1] {
+		subDir, ok := current.dirs[component]
+		if !ok {
+			return nil, false
+		}
+		current = subDir
+	}
+
+	name := components[len(components)-1]
+	if subDir, ok := current.dirs[name]; ok {
+		return subDir, true
+	}
+	if file, ok := current.files[name]; ok {
+		return file, true
+	}
+	return nil, false
+}
+
+// Walk calls fn for d and every entry below it, using the same pre-order traversal as PrintChecksums(): a directory
+// is visited first, followed by its sub-directories (recursively), followed by its files. relativePath is relative to
+// d, which itself is visited as ".". If fn returns fs.SkipDir for a directory, its children are skipped. If fn returns
+// fs.SkipAll, the traversal stops and Walk returns nil. Any other error stops the traversal and is returned.
+func (d *Directory) Walk(fn func(relativePath string, entry Entry) error) error {
+	err := d.walk(".", fn)
+	if errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+// walk is the actual implementation of Walk.
+func (d *Directory) walk(relativePath string, fn func(relativePath string, entry Entry) error) error {
+	if err := fn(relativePath, d); err != nil {
+		if errors.Is(err, fs.SkipDir) {
+			return nil
+		}
+		return err
+	}
+
+	for dirName, subDir := range d.Dirs() {
+		if err := subDir.walk(filepath.Join(relativePath, dirName), fn); err != nil {
+			return err
+		}
+	}
+	for fileName, file := range d.Files() {
+		if err := fn(filepath.Join(relativePath, fileName), file); err != nil {
+			if errors.Is(err, fs.SkipDir) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// PreOrder returns an iterator over d and every entry below it, in the same order in which Walk visits them.
+func (d *Directory) PreOrder() iter.Seq2[string, Entry] {
+	return func(yield func(string, Entry) bool) {
+		d.preOrder(".", yield)
+	}
+}
+
+// preOrder is the actual implementation of PreOrder. It returns false if the iteration was stopped.
+func (d *Directory) preOrder(relativePath string, yield func(string, Entry) bool) bool {
+	if !yield(relativePath, d) {
+		return false
+	}
+	for dirName, subDir := range d.Dirs() {
+		if !subDir.preOrder(filepath.Join(relativePath, dirName), yield) {
+			return false
+		}
+	}
+	for fileName, file := range d.Files() {
+		if !yield(filepath.Join(relativePath, fileName), file) {
+			return false
+		}
+	}
+	return true
+}
+
+// PostOrder returns an iterator over d and every entry below it, where each directory is yielded after all of its
+// sub-directories (recursively) and files. Within a directory, entries are yielded in the same order as PreOrder.
+func (d *Directory) PostOrder() iter.Seq2[string, Entry] {
+	return func(yield func(string, Entry) bool) {
+		d.postOrder(".", yield)
+	}
+}
+
+// postOrder is the actual implementation of PostOrder. It returns false if the iteration was stopped.
+func (d *Directory) postOrder(relativePath string, yield func(string, Entry) bool) bool {
+	for dirName, subDir := range d.Dirs() {
+		if !subDir.postOrder(filepath.Join(relativePath, dirName), yield) {
+			return false
+		}
+	}
+	for fileName, file := range d.Files() {
+		if !yield(filepath.Join(relativePath, fileName), file) {
+			return false
+		}
+	}
+	return yield(relativePath, d)
+}
@@ -0,0 +1,158 @@
+package directory_checksum
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/spf13/afero"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func scanNavigationTestingFilesystem() *Directory {
+	testingFilesystem := []TestingFilesystemObject{
+		TestingDir{absolutePath: filepath.FromSlash("/b")},
+		TestingDir{absolutePath: filepath.FromSlash("/b/sub")},
+		TestingFile{absolutePath: filepath.FromSlash("/b/sub/f"), content: "foo"},
+		TestingFile{absolutePath: filepath.FromSlash("/b/f"), content: "bar"},
+		TestingDir{absolutePath: filepath.FromSlash("/a")},
+		TestingFile{absolutePath: filepath.FromSlash("/z"), content: "foo"},
+		TestingFile{absolutePath: filepath.FromSlash("/y"), content: "foo"},
+	}
+	filesystemImpl := afero.NewMemMapFs()
+	setUpTestingFilesystem(testingFilesystem, filesystemImpl)
+	d, _ := ScanDirectory(string(filepath.Separator), filesystemImpl)
+	d.ComputeDirectoryChecksums()
+	return d
+}
+
+func fromSlashAll(paths []string) []string {
+	for i, path := range paths {
+		paths[i] = filepath.FromSlash(path)
+	}
+	return paths
+}
+
+func TestLookup(t *testing.T) {
+	d := scanNavigationTestingFilesystem()
+
+	entry, ok := d.Lookup("b/sub/f")
+	if !ok || entry.Type() != TypeFile || entry.Checksum() != "0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33" {
+		t.Fatalf("Unexpected lookup result for file: %v, %v", entry, ok)
+	}
+
+	entry, ok = d.Lookup(filepath.FromSlash("b/sub/"))
+	if !ok || entry.Type() != TypeDir || entry.Checksum() != "7b06b8230df4bf1aacb85eb46f410bf9403e6038" {
+		t.Fatalf("Unexpected lookup result for directory: %v, %v", entry, ok)
+	}
+
+	entry, ok = d.Lookup(".")
+	if !ok || entry != d {
+		t.Fatalf("Lookup of '.' did not return the root directory")
+	}
+
+	for _, missing := range []string{"c", "b/missing", "z/f", "a/b/c"} {
+		if _, ok := d.Lookup(missing); ok {
+			t.Fatalf("Lookup of %s should have failed", missing)
+		}
+	}
+}
+
+func TestFilesAndDirs(t *testing.T) {
+	d := scanNavigationTestingFilesystem()
+
+	var fileNames, dirNames []string
+	for name := range d.Files() {
+		fileNames = append(fileNames, name)
+	}
+	for name := range d.Dirs() {
+		dirNames = append(dirNames, name)
+	}
+
+	if want := []string{"y", "z"}; !reflect.DeepEqual(fileNames, want) {
+		t.Fatalf("Got files %v, want %v", fileNames, want)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(dirNames, want) {
+		t.Fatalf("Got dirs %v, want %v", dirNames, want)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	d := scanNavigationTestingFilesystem()
+
+	var got []string
+	err := d.Walk(func(relativePath string, entry Entry) error {
+		got = append(got, relativePath)
+		if relativePath == filepath.FromSlash("b/sub") {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := fromSlashAll([]string{".", "a", "b", "b/sub", "b/f", "y", "z"})
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Got %v, want %v", got, want)
+	}
+}
+
+func TestWalkWrappedSentinels(t *testing.T) {
+	d := scanNavigationTestingFilesystem()
+
+	var got []string
+	err := d.Walk(func(relativePath string, entry Entry) error {
+		got = append(got, relativePath)
+		switch relativePath {
+		case filepath.FromSlash("b/sub"):
+			return fmt.Errorf("skipping: %w", fs.SkipDir)
+		case "y":
+			return errors.Wrap(fs.SkipAll, 0)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := fromSlashAll([]string{".", "a", "b", "b/sub", "b/f", "y"})
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Got %v, want %v", got, want)
+	}
+}
+
+func TestPreOrderMatchesPrintChecksums(t *testing.T) {
+	d := scanNavigationTestingFilesystem()
+
+	output := ""
+	for relativePath, entry := range d.PreOrder() {
+		fileType := "D"
+		if entry.Type() == TypeFile {
+			fileType = "F"
+		}
+		output += entry.Checksum() + " " + fileType + " " + relativePath + "\n"
+	}
+
+	if want := d.PrintChecksums(10); output != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", output, want)
+	}
+}
+
+func TestPostOrder(t *testing.T) {
+	d := scanNavigationTestingFilesystem()
+
+	var got []string
+	for relativePath := range d.PostOrder() {
+		got = append(got, relativePath)
+		if relativePath == "y" {
+			break
+		}
+	}
+
+	want := fromSlashAll([]string{"a", "b/sub/f", "b/sub", "b/f", "b", "y"})
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package directory_checksum
+
+import (
+	"io/fs"
+)
+
+// fileOwner always returns false, because file owners are not supported on this platform.
+func fileOwner(info fs.FileInfo) (uid int, gid int, ok bool) {
+	return -1, -1, false
+}
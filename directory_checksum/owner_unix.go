@@ -0,0 +1,17 @@
+//go:build unix
+
+package directory_checksum
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileOwner returns the numeric user and group ID of the owner of the file described by info. The last return value
+// is false if they are unknown, e.g. because info does not stem from the OS file system.
+func fileOwner(info fs.FileInfo) (uid int, gid int, ok bool) {
+	if stat, isStat := info.Sys().(*syscall.Stat_t); isStat {
+		return int(stat.Uid), int(stat.Gid), true
+	}
+	return -1, -1, false
+}
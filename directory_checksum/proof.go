@@ -0,0 +1,184 @@
+package directory_checksum
+
+import (
+	"encoding/hex"
+	"github.com/go-errors/errors"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+const proofVersion = 1
+
+// An InclusionProof proves that a file (or directory) with a given checksum is part of a tree with a given root
+// checksum, without revealing the rest of the tree. Since directory checksums are computed on the listing of their
+// immediate children, the proof consists of the listings of all directories from the entry's parent up to the root.
+//
+// The listing format does not escape file names, so Prove refuses (and Verify rejects) listings with names that
+// contain line breaks or single quotes, which could be crafted to make a listing appear to contain another entry.
+type InclusionProof struct {
+	Version   int    `json:"version"`
+	Algorithm string `json:"algorithm"`
+	Scheme    string `json:"scheme"`
+	// Path is the slash-separated path of the entry, relative to the root directory.
+	Path string `json:"path"`
+	// Type is "F", "S" or "D", as used in listings.
+	Type     string `json:"type"`
+	Checksum string `json:"checksum"`
+	// Listings contains the listing of each directory along Path, starting with the entry's parent directory and
+	// ending with the root directory.
+	Listings []string `json:"listings"`
+}
+
+// Prove returns an InclusionProof for the entry at relativePath (relative to d). It computes the directory checksums
+// first, if necessary. Proofs are only supported for trees that use the DefaultScheme.
+func (d *Directory) Prove(relativePath string) (*InclusionProof, error) {
+	if d.options.scheme.Name != DefaultScheme.Name {
+		return nil, errors.Errorf("unable to prove '%s': only the %s scheme is supported, but the tree uses %s",
+			relativePath, DefaultScheme.Name, d.options.scheme.Name)
+	}
+	if _, err := d.ComputeDirectoryChecksums(); err != nil {
+		return nil, err
+	}
+	entry, exists := d.Lookup(relativePath)
+	cleanPath := filepath.ToSlash(filepath.Clean(relativePath))
+	if !exists || cleanPath == "." {
+		return nil, errors.Errorf("unable to prove '%s': no such file or directory in the tree", relativePath)
+	}
+
+	components := strings.Split(cleanPath, "/")
+	directories := []*Directory{d}
+	for _, component := range components[:len(components)-1] {
+		directories = append(directories, directories[len(directories)-1].dirs[component])
+	}
+	listings := make([]string, len(directories))
+	for i, dir := range directories {
+		for _, name := range append(sortedKeys(dir.dirs), sortedKeys(dir.files)...) {
+			if !isListableName(name) {
+				return nil, errors.Errorf("unable to prove '%s': the name %q contains a line break or a single "+
+					"quote, which listings cannot represent unambiguously", relativePath, name)
+			}
+		}
+		listings[len(directories)-1-i] = dir.listing()
+	}
+
+	return &InclusionProof{
+		Version:   proofVersion,
+		Algorithm: d.options.hasher.Name,
+		Scheme:    ManifestScheme,
+		Path:      cleanPath,
+		Type:      entry.Type().Letter(),
+		Checksum:  entry.Checksum(),
+		Listings:  listings,
+	}, nil
+}
+
+// Verify checks that the proof is valid, i.e. that hashing the listings along the entry's path yields rootChecksum,
+// and that each listing contains the entry (or directory) of the level below it. It returns nil if the proof is valid.
+func (p *InclusionProof) Verify(rootChecksum string) error {
+	if p.Version != proofVersion {
+		return errors.Errorf("unsupported proof version %d", p.Version)
+	}
+	if p.Scheme != ManifestScheme {
+		return errors.Errorf("unsupported proof scheme '%s'", p.Scheme)
+	}
+	algorithm, ok := HashAlgorithmByName(p.Algorithm)
+	if !ok {
+		return errors.Errorf("unsupported proof algorithm '%s'", p.Algorithm)
+	}
+	components := strings.Split(p.Path, "/")
+	if p.Path == "" || len(components) != len(p.Listings) {
+		return errors.Errorf("invalid proof: path '%s' has %d components, but there are %d listings", p.Path,
+			len(components), len(p.Listings))
+	}
+
+	if p.Type != "D" && p.Type != "F" && p.Type != "S" {
+		return errors.Errorf("invalid proof: unknown type '%s'", p.Type)
+	}
+	for _, component := range components {
+		if !isListableName(component) {
+			return errors.Errorf("invalid proof: the name %q contains a line break or a single quote", component)
+		}
+	}
+
+	expected := listingEntry{name: components[len(components)-1], entryType: p.Type, checksum: p.Checksum}
+	for i, listing := range p.Listings {
+		entries, err := parseListing(listing, algorithm)
+		if err != nil {
+			return errors.Errorf("invalid proof: listing %d is malformed: %v", i, err)
+		}
+		if entries[expected.name] != expected {
+			return errors.Errorf("invalid proof: listing %d does not contain the entry %q", i, expected.name)
+		}
+		hasher := algorithm.New()
+		if _, err := io.WriteString(hasher, listing); err != nil {
+			return errors.Wrap(err, 0)
+		}
+		checksum := hex.EncodeToString(hasher.Sum(nil))
+		if i < len(p.Listings)-1 {
+			expected = listingEntry{name: components[len(components)-2-i], entryType: "D", checksum: checksum}
+		} else if checksum != rootChecksum {
+			return errors.Errorf("invalid proof: the computed root checksum %s does not match %s", checksum,
+				rootChecksum)
+		}
+	}
+	return nil
+}
+
+// isListableName returns true if name can be represented unambiguously in a listing, i.e. if it contains neither a
+// line break nor a single quote.
+func isListableName(name string) bool {
+	return !strings.ContainsAny(name, "\n'")
+}
+
+// listingEntry is an entry of a listing parsed by parseListing. entryType is "F", "S" or "D".
+type listingEntry struct {
+	name      string
+	entryType string
+	checksum  string
+}
+
+// parseListing parses the listing of a directory (see Directory.listing), whose checksums were computed with
+// algorithm, and returns its entries by name. Each line must exactly match the format of dirListingLine or
+// fileListingLine, the directories must precede the files, and both must be sorted by name without duplicates.
+func parseListing(listing string, algorithm HashAlgorithm) (map[string]listingEntry, error) {
+	if !strings.HasSuffix(listing, "\n") {
+		return nil, errors.New("the listing does not end with a line break")
+	}
+	checksumLength := hex.EncodedLen(algorithm.New().Size())
+	entries := map[string]listingEntry{}
+	previous := listingEntry{}
+	for _, line := range strings.Split(strings.TrimSuffix(listing, "\n"), "\n") {
+		name, rest, found := strings.Cut(strings.TrimPrefix(line, "'"), "' ")
+		if !found || !strings.HasPrefix(line, "'") || !isListableName(name) {
+			return nil, errors.Errorf("invalid line %q", line)
+		}
+		entry := listingEntry{name: name, entryType: "D", checksum: rest}
+		if isSymbolicLink, checksum, isFile := strings.Cut(rest, " "); isFile {
+			entry.checksum = checksum
+			switch isSymbolicLink {
+			case "false":
+				entry.entryType = "F"
+			case "true":
+				entry.entryType = "S"
+			default:
+				return nil, errors.Errorf("invalid line %q", line)
+			}
+		}
+		if _, err := hex.DecodeString(entry.checksum); err != nil || len(entry.checksum) != checksumLength ||
+			entry.checksum != strings.ToLower(entry.checksum) {
+			return nil, errors.Errorf("invalid checksum in line %q", line)
+		}
+		if _, exists := entries[name]; exists {
+			return nil, errors.Errorf("duplicate entry %q", name)
+		}
+		// directories are listed first, and both directories and files are sorted by name
+		if previous.entryType != "" && (previous.entryType != "D" && entry.entryType == "D" ||
+			(previous.entryType == "D") == (entry.entryType == "D") && name < previous.name) {
+			return nil, errors.Errorf("the entry %q is not sorted", name)
+		}
+		entries[name] = entry
+		previous = entry
+	}
+	return entries, nil
+}
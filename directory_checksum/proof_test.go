@@ -0,0 +1,99 @@
+package directory_checksum
+
+import (
+	"strings"
+	"testing"
+)
+
+func buildProofTestingTree() *Directory {
+	d, _ := NewTree().
+		AddFile("a/b/f", strings.NewReader("foo")).
+		AddFile("a/b/g", strings.NewReader("bar")).
+		AddSymlink("a/link", "b").
+		AddFile("c", strings.NewReader("baz")).
+		Build()
+	d.ComputeDirectoryChecksums()
+	return d
+}
+
+func TestProveAndVerify(t *testing.T) {
+	d := buildProofTestingTree()
+
+	for _, relativePath := range []string{"a/b/f", "a/link", "a/b", "c"} {
+		proof, err := d.Prove(relativePath)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", relativePath, err)
+		}
+		if err := proof.Verify(d.Checksum()); err != nil {
+			t.Fatalf("Proof for %s is invalid: %v", relativePath, err)
+		}
+	}
+}
+
+func TestVerifyTamperedProof(t *testing.T) {
+	d := buildProofTestingTree()
+	tamperings := map[string]func(p *InclusionProof){
+		"checksum":      func(p *InclusionProof) { p.Checksum = emptySha1 },
+		"type":          func(p *InclusionProof) { p.Type = "S" },
+		"path":          func(p *InclusionProof) { p.Path = "a/x/f" },
+		"listing":       func(p *InclusionProof) { p.Listings[1] += "'x' " + emptySha1 + "\n" },
+		"missing level": func(p *InclusionProof) { p.Listings = p.Listings[1:] },
+		"algorithm":     func(p *InclusionProof) { p.Algorithm = "sha256" },
+	}
+	for name, tamper := range tamperings {
+		proof, _ := d.Prove("a/b/f")
+		tamper(proof)
+		if err := proof.Verify(d.Checksum()); err == nil {
+			t.Fatalf("Expected error for tampered %s but did not get any", name)
+		}
+	}
+
+	proof, _ := d.Prove("a/b/f")
+	if err := proof.Verify(emptySha1); err == nil {
+		t.Fatal("Expected error for wrong root checksum but did not get any")
+	}
+}
+
+func TestProveMissingEntry(t *testing.T) {
+	d := buildProofTestingTree()
+	for _, relativePath := range []string{"missing", "a/b/missing", "."} {
+		if _, err := d.Prove(relativePath); err == nil {
+			t.Fatalf("Expected error for %s but did not get any", relativePath)
+		}
+	}
+}
+
+func TestVerifyForgedSiblingName(t *testing.T) {
+	// the name of the real file contains a complete listing line for the file "evil", with an arbitrary checksum
+	forgedName := "a\n" + fileListingLine("evil", false, emptySha1) + "b"
+	d, _ := NewTree().AddFile(forgedName, strings.NewReader("foo")).Build()
+	d.ComputeDirectoryChecksums()
+
+	if _, err := d.Prove(forgedName); err == nil {
+		t.Fatal("Expected error when proving a name with a line break but did not get any")
+	}
+	proof := &InclusionProof{Version: proofVersion, Algorithm: SHA1.Name, Scheme: ManifestScheme, Path: "evil",
+		Type: "F", Checksum: emptySha1, Listings: []string{d.listing()}}
+	if !strings.Contains(proof.Listings[0], "\n"+fileListingLine("evil", false, emptySha1)) {
+		t.Fatalf("The listing %q does not contain the forged line", proof.Listings[0])
+	}
+	if err := proof.Verify(d.Checksum()); err == nil {
+		t.Fatal("Expected error for a forged entry but did not get any")
+	}
+}
+
+func TestVerifyUnsortedListing(t *testing.T) {
+	d := buildProofTestingTree()
+	proof, _ := d.Prove("c")
+	lines := strings.SplitAfter(proof.Listings[0], "\n")
+	for name, listing := range map[string]string{
+		"unsorted":  lines[1] + lines[0],
+		"duplicate": lines[0] + lines[0] + lines[1],
+		"truncated": strings.TrimSuffix(proof.Listings[0], "\n"),
+	} {
+		proof.Listings[0] = listing
+		if err := proof.Verify(d.Checksum()); err == nil || !strings.Contains(err.Error(), "malformed") {
+			t.Fatalf("Expected malformed listing error for %s listing, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package directory_checksum
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-errors/errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const sbomToolName = "directory-checksum"
+
+// An SPDXDocument is an SPDX 2.3 document in JSON format, see https://spdx.github.io/spdx-spec/v2.3/
+type SPDXDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      SPDXCreationInfo   `json:"creationInfo"`
+	Packages          []SPDXPackage      `json:"packages"`
+	Files             []SPDXFile         `json:"files"`
+	Relationships     []SPDXRelationship `json:"relationships"`
+}
+
+type SPDXCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type SPDXPackage struct {
+	Name                    string                      `json:"name"`
+	SPDXID                  string                      `json:"SPDXID"`
+	DownloadLocation        string                      `json:"downloadLocation"`
+	FilesAnalyzed           bool                        `json:"filesAnalyzed"`
+	PackageVerificationCode SPDXPackageVerificationCode `json:"packageVerificationCode"`
+	LicenseConcluded        string                      `json:"licenseConcluded"`
+	LicenseDeclared         string                      `json:"licenseDeclared"`
+	CopyrightText           string                      `json:"copyrightText"`
+}
+
+type SPDXPackageVerificationCode struct {
+	Value string `json:"packageVerificationCodeValue"`
+}
+
+type SPDXFile struct {
+	FileName         string         `json:"fileName"`
+	SPDXID           string         `json:"SPDXID"`
+	Checksums        []SPDXChecksum `json:"checksums"`
+	LicenseConcluded string         `json:"licenseConcluded"`
+	CopyrightText    string         `json:"copyrightText"`
+}
+
+type SPDXChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type SPDXRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// A CycloneDXBOM is a CycloneDX 1.6 bill of materials in JSON format, see https://cyclonedx.org/specification/overview/
+type CycloneDXBOM struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     CycloneDXMetadata    `json:"metadata"`
+	Components   []CycloneDXComponent `json:"components"`
+}
+
+type CycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     CycloneDXTools     `json:"tools"`
+	Component CycloneDXComponent `json:"component"`
+}
+
+type CycloneDXTools struct {
+	Components []CycloneDXComponent `json:"components"`
+}
+
+type CycloneDXComponent struct {
+	Type   string          `json:"type"`
+	BOMRef string          `json:"bom-ref,omitempty"`
+	Name   string          `json:"name"`
+	Hashes []CycloneDXHash `json:"hashes,omitempty"`
+}
+
+type CycloneDXHash struct {
+	Algorithm string `json:"alg"`
+	Content   string `json:"content"`
+}
+
+// sbomFile is a regular file listed in an SBOM.
+type sbomFile struct {
+	relativePath string
+	sha1         string
+	sha256       string
+}
+
+// sbomFiles returns all regular files below d (sorted like PreOrder), with their SHA-1 and SHA-256 digests. Symbolic
+// links are not included, because their checksum is computed on the link target, not on any file content.
+func (d *Directory) sbomFiles() ([]sbomFile, error) {
+	if d.checksum == "" {
+		return nil, errors.New("unable to create SBOM: directory checksums have not been computed")
+	}
+	var files []sbomFile
+	for relativePath, entry := range d.PreOrder() {
+		if entry.Type() != TypeFile {
+			continue
+		}
+		sha1Digest, hasSHA1 := d.options.digest(entry.(*File), SHA1.Name)
+		sha256Digest, hasSHA256 := d.options.digest(entry.(*File), SHA256.Name)
+		if !hasSHA1 || !hasSHA256 {
+			return nil, errors.New("unable to create SBOM: the tree must be scanned with SHA1 and SHA256 digests " +
+				"(see WithExtraHashers)")
+		}
+		files = append(files, sbomFile{relativePath: filepath.ToSlash(relativePath), sha1: sha1Digest,
+			sha256: sha256Digest})
+	}
+	return files, nil
+}
+
+// spdxPackageVerificationCode computes the package verification code as specified in
+// https://spdx.github.io/spdx-spec/v2.3/package-information/#79-package-verification-code-field
+func spdxPackageVerificationCode(files []sbomFile) string {
+	sha1Digests := make([]string, len(files))
+	for i, file := range files {
+		sha1Digests[i] = file.sha1
+	}
+	sort.Strings(sha1Digests)
+	sum := sha1.Sum([]byte(strings.Join(sha1Digests, "")))
+	return hex.EncodeToString(sum[:])
+}
+
+// SPDXDocument returns an SPDX document that describes d as a package named name, which contains one SPDX file per
+// regular file. created is the document's creation time. The tree must have SHA1 and SHA256 digests, i.e. it must
+// have been scanned with one of them as hash algorithm and the other one as extra hash algorithm.
+func (d *Directory) SPDXDocument(name string, created time.Time) (*SPDXDocument, error) {
+	files, err := d.sbomFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	document := SPDXDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: fmt.Sprintf("https://spdx.org/spdxdocs/%s-%s", sbomToolName, d.checksum),
+		CreationInfo: SPDXCreationInfo{
+			Created:  created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + sbomToolName},
+		},
+		Packages: []SPDXPackage{{
+			Name:                    name,
+			SPDXID:                  "SPDXRef-Package",
+			DownloadLocation:        "NOASSERTION",
+			FilesAnalyzed:           true,
+			PackageVerificationCode: SPDXPackageVerificationCode{Value: spdxPackageVerificationCode(files)},
+			LicenseConcluded:        "NOASSERTION",
+			LicenseDeclared:         "NOASSERTION",
+			CopyrightText:           "NOASSERTION",
+		}},
+		Files: []SPDXFile{},
+		Relationships: []SPDXRelationship{{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: "SPDXRef-Package",
+		}},
+	}
+	for i, file := range files {
+		spdxID := fmt.Sprintf("SPDXRef-File-%d", i+1)
+		document.Files = append(document.Files, SPDXFile{
+			FileName: "./" + file.relativePath,
+			SPDXID:   spdxID,
+			Checksums: []SPDXChecksum{
+				{Algorithm: "SHA1", ChecksumValue: file.sha1},
+				{Algorithm: "SHA256", ChecksumValue: file.sha256},
+			},
+			LicenseConcluded: "NOASSERTION",
+			CopyrightText:    "NOASSERTION",
+		})
+		document.Relationships = append(document.Relationships, SPDXRelationship{
+			SPDXElementID:      "SPDXRef-Package",
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: spdxID,
+		})
+	}
+	return &document, nil
+}
+
+// CycloneDXBOM returns a CycloneDX BOM that describes d (as metadata component named name), with one file component
+// per regular file. created is the BOM's timestamp. The same digests as for SPDXDocument() are required.
+func (d *Directory) CycloneDXBOM(name string, created time.Time) (*CycloneDXBOM, error) {
+	files, err := d.sbomFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	bom := CycloneDXBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.6",
+		SerialNumber: "urn:uuid:" + uuidFromChecksum(d.checksum),
+		Version:      1,
+		Metadata: CycloneDXMetadata{
+			Timestamp: created.UTC().Format(time.RFC3339),
+			Tools: CycloneDXTools{Components: []CycloneDXComponent{
+				{Type: "application", Name: sbomToolName},
+			}},
+			Component: CycloneDXComponent{Type: "data", BOMRef: ".", Name: name},
+		},
+		Components: []CycloneDXComponent{},
+	}
+	for _, file := range files {
+		bom.Components = append(bom.Components, CycloneDXComponent{
+			Type:   "file",
+			BOMRef: file.relativePath,
+			Name:   file.relativePath,
+			Hashes: []CycloneDXHash{
+				{Algorithm: "SHA-1", Content: file.sha1},
+				{Algorithm: "SHA-256", Content: file.sha256},
+			},
+		})
+	}
+	return &bom, nil
+}
+
+// uuidFromChecksum derives a (version 5 style) UUID from a checksum, so that the same tree always yields the same UUID.
+func uuidFromChecksum(checksum string) string {
+	sum := sha1.Sum([]byte(checksum))
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
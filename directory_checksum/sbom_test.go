@@ -0,0 +1,85 @@
+package directory_checksum
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func buildSBOMTestingTree(options ...ScanOption) *Directory {
+	d, _ := NewTree(options...).
+		AddFile("d/f", strings.NewReader("foo")).
+		AddSymlink("d/link", "f").
+		AddFile("g", strings.NewReader("bar")).
+		Build()
+	d.ComputeDirectoryChecksums()
+	return d
+}
+
+func TestSPDXDocument(t *testing.T) {
+	d := buildSBOMTestingTree(WithExtraHashers(SHA256))
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	document, err := d.SPDXDocument("my-dir", created)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got := document.Packages[0].PackageVerificationCode.Value; got != "3eb4e0e693987b4bcb871a44e943b7223b5dd2e5" {
+		t.Fatalf("Got package verification code %s", got)
+	}
+	if document.CreationInfo.Created != "2024-01-02T03:04:05Z" {
+		t.Fatalf("Got creation time %s", document.CreationInfo.Created)
+	}
+	if len(document.Files) != 2 || document.Files[0].FileName != "./d/f" || document.Files[1].FileName != "./g" {
+		t.Fatalf("Got files %v", document.Files)
+	}
+	wantChecksums := []SPDXChecksum{
+		{Algorithm: "SHA1", ChecksumValue: "0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33"},
+		{Algorithm: "SHA256", ChecksumValue: "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"},
+	}
+	for i, checksum := range wantChecksums {
+		if document.Files[0].Checksums[i] != checksum {
+			t.Fatalf("Got checksum %v, want %v", document.Files[0].Checksums[i], checksum)
+		}
+	}
+	// DESCRIBES + one CONTAINS per file
+	if len(document.Relationships) != 3 {
+		t.Fatalf("Got relationships %v", document.Relationships)
+	}
+}
+
+func TestCycloneDXBOM(t *testing.T) {
+	d := buildSBOMTestingTree(WithHasher(SHA256), WithExtraHashers(SHA1))
+
+	bom, err := d.CycloneDXBOM("my-dir", time.Unix(0, 0))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(bom.Components) != 2 || bom.Components[1].Name != "g" {
+		t.Fatalf("Got components %v", bom.Components)
+	}
+	wantHashes := []CycloneDXHash{
+		{Algorithm: "SHA-1", Content: "62cdb7020ff920e5aa642c3d4066950dd1f01f4d"},
+		{Algorithm: "SHA-256", Content: "fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9"},
+	}
+	for i, hash := range wantHashes {
+		if bom.Components[1].Hashes[i] != hash {
+			t.Fatalf("Got hash %v, want %v", bom.Components[1].Hashes[i], hash)
+		}
+	}
+
+	other, _ := buildSBOMTestingTree(WithHasher(SHA256), WithExtraHashers(SHA1)).CycloneDXBOM("x", time.Now())
+	if bom.SerialNumber != other.SerialNumber || !strings.HasPrefix(bom.SerialNumber, "urn:uuid:") {
+		t.Fatalf("Expected equal, deterministic serial numbers, got %s and %s", bom.SerialNumber, other.SerialNumber)
+	}
+}
+
+func TestSBOMRequiresBothDigests(t *testing.T) {
+	d := buildSBOMTestingTree()
+
+	if _, err := d.SPDXDocument("my-dir", time.Now()); err == nil {
+		t.Fatal("Expected error but did not get any")
+	}
+}
@@ -0,0 +1,182 @@
+package directory_checksum
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"slices"
+)
+
+// A HashAlgorithm names a hash function and constructs new instances of it. The same algorithm is used for the
+// checksums of files and of directory listings.
+type HashAlgorithm struct {
+	Name string
+	New  func() hash.Hash
+}
+
+var (
+	MD5    = HashAlgorithm{Name: "md5", New: md5.New}
+	SHA1   = HashAlgorithm{Name: "sha1", New: sha1.New}
+	SHA256 = HashAlgorithm{Name: "sha256", New: sha256.New}
+	SHA384 = HashAlgorithm{Name: "sha384", New: sha512.New384}
+	SHA512 = HashAlgorithm{Name: "sha512", New: sha512.New}
+)
+
+// hashAlgorithms maps the names of all supported hash algorithms to the algorithm.
+var hashAlgorithms = map[string]HashAlgorithm{
+	MD5.Name:    MD5,
+	SHA1.Name:   SHA1,
+	SHA256.Name: SHA256,
+	SHA384.Name: SHA384,
+	SHA512.Name: SHA512,
+}
+
+// HashAlgorithmByName returns the supported HashAlgorithm with the provided name (e.g. "sha256"). The second return
+// value is false if no such algorithm is supported.
+func HashAlgorithmByName(name string) (HashAlgorithm, bool) {
+	algorithm, ok := hashAlgorithms[name]
+	return algorithm, ok
+}
+
+// A Filter decides whether the file or directory at relativePath (which uses the OS-specific path separator) is
+// included in the scan. Returning false for a directory excludes the directory and all of its children.
+type Filter func(relativePath string, info fs.FileInfo) bool
+
+// scanOptions holds the settings that control how a directory is scanned and how its checksums are computed. It is
+// shared by all Directory objects of one tree.
+type scanOptions struct {
+	hasher       HashAlgorithm
+	scheme       Scheme
+	extraHashers []HashAlgorithm
+	filter       Filter
+	logger       *log.Logger
+	concurrency  int
+	// extendedAttributes is true if the extended attributes are read, even if the scheme does not depend on them
+	extendedAttributes bool
+}
+
+// A ScanOption configures ScanDirectory. Options that are not provided keep their default value, which corresponds to
+// the behavior of the CLI tool.
+type ScanOption func(*scanOptions)
+
+// WithHasher sets the hash algorithm used for all checksums. The default is SHA1.
+func WithHasher(algorithm HashAlgorithm) ScanOption {
+	return func(o *scanOptions) {
+		o.hasher = algorithm
+	}
+}
+
+// WithScheme sets the Scheme that defines how checksums are computed. The default is DefaultScheme.
+func WithScheme(scheme Scheme) ScanOption {
+	return func(o *scanOptions) {
+		o.scheme = scheme
+	}
+}
+
+// WithExtraHashers adds hash algorithms whose digests are computed for every file (in the same pass that computes the
+// checksum), which are needed by some output formats. They do not affect any checksum. Unlike checksums, these digests
+// are always computed on the plain file content, regardless of the Scheme. The algorithms of several WithExtraHashers
+// options are combined.
+func WithExtraHashers(algorithms ...HashAlgorithm) ScanOption {
+	return func(o *scanOptions) {
+		for _, algorithm := range algorithms {
+			if !slices.ContainsFunc(o.extraHashers, func(extraHasher HashAlgorithm) bool {
+				return extraHasher.Name == algorithm.Name
+			}) {
+				o.extraHashers = append(o.extraHashers, algorithm)
+			}
+		}
+	}
+}
+
+// WithFilter sets a Filter that decides which files and directories are scanned. By default, everything is scanned.
+func WithFilter(filter Filter) ScanOption {
+	return func(o *scanOptions) {
+		o.filter = filter
+	}
+}
+
+// WithLogger sets the logger that receives warnings, e.g. about skipped files of unsupported type. By default,
+// warnings are printed to stdout. A nil logger discards all warnings.
+func WithLogger(logger *log.Logger) ScanOption {
+	return func(o *scanOptions) {
+		if logger == nil {
+			logger = log.New(io.Discard, "", 0)
+		}
+		o.logger = logger
+	}
+}
+
+// WithConcurrency sets the number of files whose checksums are computed in parallel. The default is 1. Values smaller
+// than 1 are treated as 1.
+func WithConcurrency(concurrency int) ScanOption {
+	return func(o *scanOptions) {
+		o.concurrency = concurrency
+	}
+}
+
+// WithExtendedAttributes reads the extended attributes of all files and directories into their Metadata (which is only
+// supported on Linux and macOS), e.g. so that WriteTar includes them. Schemes that depend on them (like BuildKitScheme)
+// read them anyway.
+func WithExtendedAttributes() ScanOption {
+	return func(o *scanOptions) {
+		o.extendedAttributes = true
+	}
+}
+
+// newScanOptions returns the default scanOptions, modified by the provided options.
+func newScanOptions(options ...ScanOption) *scanOptions {
+	o := &scanOptions{
+		hasher:      SHA1,
+		scheme:      DefaultScheme,
+		filter:      nil,
+		logger:      log.New(os.Stdout, "", 0),
+		concurrency: 1,
+	}
+	for _, option := range options {
+		option(o)
+	}
+	if o.concurrency < 1 {
+		o.concurrency = 1
+	}
+	return o
+}
+
+// newHashers returns the hash.Hash that computes the checksum of a file with the provided metadata (according to the
+// Scheme), followed by one hash.Hash per extra algorithm. contentSize is the size of the file's content (or of a
+// symbolic link's target).
+func (o *scanOptions) newHashers(metadata Metadata, contentSize int64) []hash.Hash {
+	hashers := []hash.Hash{o.scheme.newFileHasher(o.hasher, metadata, contentSize)}
+	for _, algorithm := range o.extraHashers {
+		hashers = append(hashers, algorithm.New())
+	}
+	return hashers
+}
+
+// newFile returns a File whose digests were computed by the hashers returned by newHashers().
+func (o *scanOptions) newFile(digests []string, isSymbolicLink bool) *File {
+	file := &File{checksum: digests[0], isSymbolicLink: isSymbolicLink, metadata: unknownMetadata}
+	if len(o.extraHashers) > 0 {
+		file.digests = map[string]string{}
+		for i, algorithm := range o.extraHashers {
+			file.digests[algorithm.Name] = digests[i+1]
+		}
+	}
+	return file
+}
+
+// digest returns the digest of file (in hexadecimal notation) for the hash algorithm with the provided name. The
+// second return value is false if this digest was not computed.
+func (o *scanOptions) digest(file *File, algorithmName string) (string, bool) {
+	if algorithmName == o.hasher.Name && o.scheme.Name == DefaultScheme.Name {
+		return file.checksum, true
+	}
+	digest, ok := file.digests[algorithmName]
+	return digest, ok
+}
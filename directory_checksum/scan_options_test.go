@@ -0,0 +1,132 @@
+package directory_checksum
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/spf13/afero"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithHasher(t *testing.T) {
+	testingFilesystem := []TestingFilesystemObject{
+		TestingFile{absolutePath: filepath.FromSlash("/f"), content: "foo"},
+	}
+	filesystemImpl := afero.NewMemMapFs()
+	setUpTestingFilesystem(testingFilesystem, filesystemImpl)
+
+	d, _ := ScanDirectory(string(filepath.Separator), filesystemImpl, WithHasher(SHA256))
+	d.ComputeDirectoryChecksums()
+	got := d.PrintChecksums(1)
+
+	want := "f8b4e411fdb6156f1da51e620954782869491a272b91a8b43df20949da1ab30a D .\n" +
+		"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae F f\n"
+	if got != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", got, want)
+	}
+}
+
+func TestWithFilter(t *testing.T) {
+	testingFilesystem := []TestingFilesystemObject{
+		TestingDir{absolutePath: filepath.FromSlash("/d")},
+		TestingFile{absolutePath: filepath.FromSlash("/d/f"), content: "foo"},
+		TestingDir{absolutePath: filepath.FromSlash("/skipped")},
+		TestingFile{absolutePath: filepath.FromSlash("/skipped/f"), content: "foo"},
+		TestingFile{absolutePath: filepath.FromSlash("/skipped.txt"), content: "foo"},
+	}
+	filesystemImpl := afero.NewMemMapFs()
+	setUpTestingFilesystem(testingFilesystem, filesystemImpl)
+	filter := func(relativePath string, info fs.FileInfo) bool {
+		return relativePath != "skipped" && filepath.Ext(relativePath) != ".txt"
+	}
+
+	d, _ := ScanDirectory(string(filepath.Separator), filesystemImpl, WithFilter(filter))
+	d.ComputeDirectoryChecksums()
+	got := d.PrintChecksums(3)
+
+	want := fmt.Sprintf("%s D .\n%s D d\n%s F %s\n", "6ee1e855dc53c88ba50c9e2026e9c75ad76139dc",
+		"7b06b8230df4bf1aacb85eb46f410bf9403e6038", "0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33",
+		filepath.FromSlash("d/f"))
+	if got != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", got, want)
+	}
+}
+
+func TestWithExtraHashersCombines(t *testing.T) {
+	o := newScanOptions(WithExtraHashers(SHA1), WithExtraHashers(SHA256, SHA1))
+	if len(o.extraHashers) != 2 || o.extraHashers[0].Name != SHA1.Name || o.extraHashers[1].Name != SHA256.Name {
+		t.Fatalf("Got extra hashers %v", o.extraHashers)
+	}
+}
+
+func TestWithLoggerNil(t *testing.T) {
+	o := newScanOptions(WithLogger(nil))
+	// must not panic
+	o.logger.Printf("WARNING: discarded")
+}
+
+func TestWithLoggerReceivesCloseErrors(t *testing.T) {
+	testingFilesystem := []TestingFilesystemObject{
+		TestingFile{absolutePath: filepath.FromSlash("/f"), content: "foo"},
+	}
+	filesystemImpl := afero.NewMemMapFs()
+	setUpTestingFilesystem(testingFilesystem, filesystemImpl)
+
+	buffer := bytes.Buffer{}
+	_, err := ScanDirectory(string(filepath.Separator), closeFailingFs{filesystemImpl},
+		WithLogger(log.New(&buffer, "", 0)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(buffer.String(), "closing failed") {
+		t.Fatalf("Got log output %q", buffer.String())
+	}
+}
+
+func TestWithConcurrency(t *testing.T) {
+	// Tests whether scanning with many goroutines produces the same output as a sequential scan
+	var testingFilesystem []TestingFilesystemObject
+	for i := range 5 {
+		testingFilesystem = append(testingFilesystem, TestingDir{absolutePath: filepath.FromSlash(fmt.Sprintf("/d%d", i))})
+		for j := range 20 {
+			testingFilesystem = append(testingFilesystem, TestingFile{
+				absolutePath: filepath.FromSlash(fmt.Sprintf("/d%d/f%d", i, j)),
+				content:      fmt.Sprintf("content %d %d", i, j),
+			})
+		}
+	}
+	filesystemImpl := afero.NewMemMapFs()
+	setUpTestingFilesystem(testingFilesystem, filesystemImpl)
+	root := string(filepath.Separator)
+
+	d1, _ := ScanDirectory(root, filesystemImpl)
+	d1.ComputeDirectoryChecksums()
+	output1 := d1.PrintChecksums(3)
+
+	d2, _ := ScanDirectory(root, filesystemImpl, WithConcurrency(8))
+	d2.ComputeDirectoryChecksums()
+	output2 := d2.PrintChecksums(3)
+
+	if output1 != output2 {
+		t.Fatalf("Outputs differ:\noutput1:\n%s\n\noutput2:\n%s", output1, output2)
+	}
+}
+
+func TestWithConcurrencyUnreadableFile(t *testing.T) {
+	testingFilesystem := []TestingFilesystemObject{
+		TestingFile{absolutePath: filepath.FromSlash("/f1")},
+		TestingFile{absolutePath: filepath.FromSlash("/f2")},
+	}
+	filesystemImpl := afero.NewMemMapFs()
+	setUpTestingFilesystem(testingFilesystem, filesystemImpl)
+
+	wrapper := fsWrapper{filesystemImpl}
+	_, err := ScanDirectory(string(filepath.Separator), &wrapper, WithConcurrency(4))
+
+	if err == nil {
+		t.Fatal("Expected error but did not get any")
+	}
+}
@@ -0,0 +1,94 @@
+package directory_checksum
+
+import (
+	"encoding/hex"
+	"github.com/go-errors/errors"
+	"hash"
+	"io"
+)
+
+// A Scheme defines how the checksums of files and directories are computed from the content (or link target) of
+// files, their Metadata, and the checksums of a directory's children. The hash algorithm is configured independently
+// (see WithHasher).
+type Scheme struct {
+	Name string
+	// newFileHasher returns the hash.Hash that computes a file's checksum when fed with the file's content (or a
+	// symbolic link's target), which has the size contentSize.
+	newFileHasher func(algorithm HashAlgorithm, metadata Metadata, contentSize int64) hash.Hash
+	// directoryChecksum returns the checksum of d. It is responsible for computing the checksums of d's child
+	// directories first, if it needs them (see computeChildDirectoryChecksums).
+	directoryChecksum func(d *Directory) (string, error)
+	// readsExtendedAttributes is true if the checksums depend on the extended attributes (see Metadata.Xattrs), which
+	// the scanner only reads if necessary.
+	readsExtendedAttributes bool
+}
+
+var (
+	// DefaultScheme hashes the plain content of files (and the target of symbolic links), and computes the checksum of
+	// a directory from a listing of the names, types and checksums of its children.
+	DefaultScheme = Scheme{
+		Name:              ManifestScheme,
+		newFileHasher:     plainFileHasher,
+		directoryChecksum: listingChecksum,
+	}
+	// GitScheme computes git object IDs (see gitFileHasher and gitTreeChecksum), so that the checksum of a directory
+	// equals the ID of the tree object that git would create for it. Use it with the SHA1 or SHA256 algorithm, which
+	// correspond to git's object formats.
+	GitScheme = Scheme{
+		Name:              "git",
+		newFileHasher:     gitFileHasher,
+		directoryChecksum: gitTreeChecksum,
+	}
+	// NarScheme computes the hash of the Nix Archive (NAR) serialization of each file and directory (see WriteNAR), as
+	// printed by "nix hash path". Computing directory checksums reads the content of all files again.
+	NarScheme = Scheme{
+		Name:              "nar",
+		newFileHasher:     newNarFileHasher,
+		directoryChecksum: narDirectoryChecksum,
+	}
+)
+
+// schemes maps the names of all supported schemes to the scheme.
+var schemes = map[string]Scheme{
+	DefaultScheme.Name:  DefaultScheme,
+	GitScheme.Name:      GitScheme,
+	NarScheme.Name:      NarScheme,
+	GoH1Scheme.Name:     GoH1Scheme,
+	IPFSScheme.Name:     IPFSScheme,
+	FsVerityScheme.Name: FsVerityScheme,
+	BuildKitScheme.Name: BuildKitScheme,
+}
+
+// SchemeByName returns the supported Scheme with the provided name (e.g. "git"). The second return value is false if
+// no such scheme is supported.
+func SchemeByName(name string) (Scheme, bool) {
+	scheme, ok := schemes[name]
+	return scheme, ok
+}
+
+// plainFileHasher returns a hash.Hash that hashes the file content as-is.
+func plainFileHasher(algorithm HashAlgorithm, _ Metadata, _ int64) hash.Hash {
+	return algorithm.New()
+}
+
+// listingChecksum returns the hash of d's listing (see Directory.listing).
+func listingChecksum(d *Directory) (string, error) {
+	if err := d.computeChildDirectoryChecksums(); err != nil {
+		return "", err
+	}
+	hasher := d.options.hasher.New()
+	if _, err := io.WriteString(hasher, d.listing()); err != nil {
+		return "", errors.Wrap(err, 0)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// computeChildDirectoryChecksums calls ComputeDirectoryChecksums() on all immediate child directories of d.
+func (d *Directory) computeChildDirectoryChecksums() error {
+	for _, childDir := range d.dirs {
+		if _, err := childDir.ComputeDirectoryChecksums(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
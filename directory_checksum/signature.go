@@ -0,0 +1,253 @@
+package directory_checksum
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"github.com/go-errors/errors"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"strings"
+)
+
+// DefaultSignatureNamespace is the namespace used for SSH signatures (see "ssh-keygen -Y sign -n"), which prevents
+// that a signature created for one purpose is accepted for another one.
+const DefaultSignatureNamespace = "directory-checksum"
+
+const (
+	sshSignatureMagic   = "SSHSIG"
+	sshSignatureVersion = 1
+	sshSignatureHash    = "sha512"
+	sshSignatureBegin   = "-----BEGIN SSH SIGNATURE-----"
+	sshSignatureEnd     = "-----END SSH SIGNATURE-----"
+)
+
+// sshSignedData is the data that is actually signed by an SSH signature, following the magic preamble, as specified in
+// https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.sshsig
+type sshSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// sshSignatureBlob is the encoded SSH signature, following the magic preamble.
+type sshSignatureBlob struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// CanonicalManifest reads a manifest (see WriteManifest) from r and returns its canonical form, which is what
+// signatures are created for and verified against.
+func CanonicalManifest(r io.Reader) ([]byte, error) {
+	directory, err := ReadManifest(r)
+	if err != nil {
+		return nil, err
+	}
+	buffer := bytes.Buffer{}
+	if err := directory.WriteManifest(&buffer); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// SignManifest returns a detached signature of canonicalManifest. privateKey is either an (unencrypted) OpenSSH private
+// key, which yields an armored SSH signature that is compatible with "ssh-keygen -Y sign -n <namespace>", or a raw
+// Ed25519 key (PKCS#8 PEM, or the base64-encoded 32-byte seed or 64-byte private key), which yields the base64-encoded
+// Ed25519 signature. namespace is only used for SSH signatures.
+func SignManifest(canonicalManifest []byte, privateKey []byte, namespace string) ([]byte, error) {
+	if bytes.Contains(privateKey, []byte("OPENSSH PRIVATE KEY")) {
+		signer, err := ssh.ParsePrivateKey(privateKey)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		return signSSH(canonicalManifest, signer, namespace)
+	}
+
+	ed25519Key, err := parseEd25519PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	signature := ed25519.Sign(ed25519Key, canonicalManifest)
+	return []byte(base64.StdEncoding.EncodeToString(signature) + "\n"), nil
+}
+
+// VerifyManifestSignature returns nil if signature (as created by SignManifest or "ssh-keygen -Y sign") is a valid
+// signature of canonicalManifest, made with the private key that belongs to publicKey. For SSH signatures, publicKey
+// must be in authorized_keys format, otherwise it is a raw Ed25519 key (PKIX PEM, or the base64-encoded 32 bytes).
+func VerifyManifestSignature(canonicalManifest []byte, signature []byte, publicKey []byte, namespace string) error {
+	if bytes.HasPrefix(bytes.TrimSpace(signature), []byte(sshSignatureBegin)) {
+		sshPublicKey, _, _, _, err := ssh.ParseAuthorizedKey(publicKey)
+		if err != nil {
+			return errors.Wrap(err, 0)
+		}
+		return verifySSH(canonicalManifest, signature, sshPublicKey, namespace)
+	}
+
+	ed25519Key, err := parseEd25519PublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	rawSignature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return errors.Errorf("invalid Ed25519 signature: %v", err)
+	}
+	if !ed25519.Verify(ed25519Key, canonicalManifest, rawSignature) {
+		return errors.New("the Ed25519 signature does not match the manifest and public key")
+	}
+	return nil
+}
+
+// sshSignedMessage returns the data that is signed by an SSH signature of message.
+func sshSignedMessage(message []byte, namespace string) []byte {
+	hash := sha512.Sum512(message)
+	signedData := sshSignedData{Namespace: namespace, HashAlgorithm: sshSignatureHash, Hash: hash[:]}
+	return append([]byte(sshSignatureMagic), ssh.Marshal(&signedData)...)
+}
+
+// signSSH returns the armored SSH signature of message.
+func signSSH(message []byte, signer ssh.Signer, namespace string) ([]byte, error) {
+	signedMessage := sshSignedMessage(message, namespace)
+	var signature *ssh.Signature
+	var err error
+	if algorithmSigner, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		// ssh-keygen does not accept RSA signatures that use SHA-1
+		signature, err = algorithmSigner.SignWithAlgorithm(rand.Reader, signedMessage, ssh.KeyAlgoRSASHA512)
+	} else {
+		signature, err = signer.Sign(rand.Reader, signedMessage)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+
+	blob := sshSignatureBlob{
+		Version:       sshSignatureVersion,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     namespace,
+		HashAlgorithm: sshSignatureHash,
+		Signature:     ssh.Marshal(signature),
+	}
+	encoded := base64.StdEncoding.EncodeToString(append([]byte(sshSignatureMagic), ssh.Marshal(&blob)...))
+
+	armored := strings.Builder{}
+	armored.WriteString(sshSignatureBegin + "\n")
+	for len(encoded) > 70 {
+		armored.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+	armored.WriteString(encoded + "\n" + sshSignatureEnd + "\n")
+	return []byte(armored.String()), nil
+}
+
+// verifySSH returns nil if armoredSignature is a valid SSH signature of message, made by publicKey.
+func verifySSH(message []byte, armoredSignature []byte, publicKey ssh.PublicKey, namespace string) error {
+	encoded := strings.TrimSpace(string(armoredSignature))
+	encoded = strings.TrimSuffix(strings.TrimPrefix(encoded, sshSignatureBegin), sshSignatureEnd)
+	decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return errors.Errorf("invalid SSH signature: %v", err)
+	}
+	if !bytes.HasPrefix(decoded, []byte(sshSignatureMagic)) {
+		return errors.New("invalid SSH signature: missing magic preamble")
+	}
+	var blob sshSignatureBlob
+	if err := ssh.Unmarshal(decoded[len(sshSignatureMagic):], &blob); err != nil {
+		return errors.Errorf("invalid SSH signature: %v", err)
+	}
+	if blob.Version != sshSignatureVersion {
+		return errors.Errorf("unsupported SSH signature version %d", blob.Version)
+	}
+	if blob.Namespace != namespace {
+		return errors.Errorf("the SSH signature was made for namespace '%s', but '%s' is required", blob.Namespace,
+			namespace)
+	}
+	if !bytes.Equal(blob.PublicKey, publicKey.Marshal()) {
+		return errors.New("the SSH signature was made with a different key")
+	}
+
+	var hash []byte
+	switch blob.HashAlgorithm {
+	case "sha512":
+		sum := sha512.Sum512(message)
+		hash = sum[:]
+	case "sha256":
+		sum := sha256.Sum256(message)
+		hash = sum[:]
+	default:
+		return errors.Errorf("unsupported SSH signature hash algorithm '%s'", blob.HashAlgorithm)
+	}
+	signedData := sshSignedData{Namespace: namespace, Reserved: blob.Reserved, HashAlgorithm: blob.HashAlgorithm,
+		Hash: hash}
+	var signature ssh.Signature
+	if err := ssh.Unmarshal(blob.Signature, &signature); err != nil {
+		return errors.Errorf("invalid SSH signature: %v", err)
+	}
+	signedMessage := append([]byte(sshSignatureMagic), ssh.Marshal(&signedData)...)
+	if err := publicKey.Verify(signedMessage, &signature); err != nil {
+		return errors.Errorf("the SSH signature does not match the manifest: %v", err)
+	}
+	return nil
+}
+
+// parseEd25519PrivateKey parses a PKCS#8 PEM, or a base64-encoded 32-byte seed or 64-byte Ed25519 private key.
+func parseEd25519PrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		ed25519Key, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("the PEM private key is not an Ed25519 key")
+		}
+		return ed25519Key, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, errors.Errorf("unable to parse private key: %v", err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return raw, nil
+	default:
+		return nil, errors.Errorf("invalid Ed25519 private key: expected %d or %d bytes, got %d",
+			ed25519.SeedSize, ed25519.PrivateKeySize, len(raw))
+	}
+}
+
+// parseEd25519PublicKey parses a PKIX PEM or a base64-encoded 32-byte Ed25519 public key.
+func parseEd25519PublicKey(data []byte) (ed25519.PublicKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		ed25519Key, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("the PEM public key is not an Ed25519 key")
+		}
+		return ed25519Key, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, errors.Errorf("unable to parse public key: %v", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, errors.Errorf("invalid Ed25519 public key: expected %d bytes, got %d", ed25519.PublicKeySize,
+			len(raw))
+	}
+	return raw, nil
+}
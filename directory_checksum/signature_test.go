@@ -0,0 +1,100 @@
+package directory_checksum
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"golang.org/x/crypto/ssh"
+	"strings"
+	"testing"
+)
+
+func canonicalTestingManifest(t *testing.T) []byte {
+	t.Helper()
+	d, _ := NewTree().AddFile("d/f", strings.NewReader("foo")).Build()
+	d.ComputeDirectoryChecksums()
+	buffer := bytes.Buffer{}
+	d.WriteManifest(&buffer)
+	canonicalManifest, err := CanonicalManifest(&buffer)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return canonicalManifest
+}
+
+// assertSignatureRoundTrip signs the manifest with privateKey, verifies the signature with publicKey, and checks
+// that verification fails for a modified manifest.
+func assertSignatureRoundTrip(t *testing.T, privateKey []byte, publicKey []byte) []byte {
+	t.Helper()
+	manifest := canonicalTestingManifest(t)
+	signature, err := SignManifest(manifest, privateKey, DefaultSignatureNamespace)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := VerifyManifestSignature(manifest, signature, publicKey, DefaultSignatureNamespace); err != nil {
+		t.Fatalf("Valid signature was rejected: %v", err)
+	}
+
+	tampered := bytes.Replace(manifest, []byte("d/f"), []byte("d/g"), 1)
+	if err := VerifyManifestSignature(tampered, signature, publicKey, DefaultSignatureNamespace); err == nil {
+		t.Fatal("Signature of tampered manifest was accepted")
+	}
+	return signature
+}
+
+func TestSignRawEd25519(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	encodedPublicKey := []byte(base64.StdEncoding.EncodeToString(publicKey))
+
+	assertSignatureRoundTrip(t, []byte(base64.StdEncoding.EncodeToString(privateKey.Seed())), encodedPublicKey)
+	assertSignatureRoundTrip(t, []byte(base64.StdEncoding.EncodeToString(privateKey)+"\n"), encodedPublicKey)
+}
+
+func TestSignPEMEd25519(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	privateKeyDER, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+	publicKeyDER, _ := x509.MarshalPKIXPublicKey(publicKey)
+
+	assertSignatureRoundTrip(t, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER}))
+}
+
+func TestSignSSH(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	privateKeyBlock, _ := ssh.MarshalPrivateKey(privateKey, "")
+	sshPublicKey, _ := ssh.NewPublicKey(publicKey)
+	authorizedKey := ssh.MarshalAuthorizedKey(sshPublicKey)
+
+	signature := assertSignatureRoundTrip(t, pem.EncodeToMemory(privateKeyBlock), authorizedKey)
+	if !strings.HasPrefix(string(signature), "-----BEGIN SSH SIGNATURE-----\n") {
+		t.Fatalf("Unexpected signature format:\n%s", signature)
+	}
+
+	manifest := canonicalTestingManifest(t)
+	if err := VerifyManifestSignature(manifest, signature, authorizedKey, "other-namespace"); err == nil {
+		t.Fatal("Signature with wrong namespace was accepted")
+	}
+	otherPublicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	otherSSHPublicKey, _ := ssh.NewPublicKey(otherPublicKey)
+	err := VerifyManifestSignature(manifest, signature, ssh.MarshalAuthorizedKey(otherSSHPublicKey),
+		DefaultSignatureNamespace)
+	if err == nil {
+		t.Fatal("Signature was accepted for a different public key")
+	}
+}
+
+func TestInvalidKeys(t *testing.T) {
+	manifest := canonicalTestingManifest(t)
+	if _, err := SignManifest(manifest, []byte("not a key"), DefaultSignatureNamespace); err == nil {
+		t.Fatal("Expected error for invalid private key but did not get any")
+	}
+	if _, err := SignManifest(manifest, []byte("AAAA"), DefaultSignatureNamespace); err == nil {
+		t.Fatal("Expected error for private key of wrong length but did not get any")
+	}
+	if err := VerifyManifestSignature(manifest, []byte("AAAA"), []byte("AAAA"), DefaultSignatureNamespace); err == nil {
+		t.Fatal("Expected error for invalid public key but did not get any")
+	}
+}
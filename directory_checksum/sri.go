@@ -0,0 +1,61 @@
+package directory_checksum
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/go-errors/errors"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// sriAlgorithms contains the names of the hash algorithms that Subresource Integrity supports.
+var sriAlgorithms = map[string]bool{
+	SHA256.Name: true,
+	SHA384.Name: true,
+	SHA512.Name: true,
+}
+
+// IsSRIAlgorithm returns true if Subresource Integrity supports the provided hash algorithm.
+func IsSRIAlgorithm(algorithm HashAlgorithm) bool {
+	return sriAlgorithms[algorithm.Name]
+}
+
+// SRIMap returns a map from the relative URL path of every regular file below d (slash-separated and percent-encoded)
+// to its Subresource Integrity metadata, as used in the "integrity" attribute of <script> and <link> tags: one
+// "<algorithm>-<base64 digest>" token per provided algorithm, separated by spaces. The digests of all algorithms must
+// have been computed during the scan (see WithExtraHashers). Symbolic links are omitted, like in WriteChecksumList.
+func (d *Directory) SRIMap(algorithms ...HashAlgorithm) (map[string]string, error) {
+	if len(algorithms) == 0 {
+		return nil, errors.New("unable to create SRI map: no hash algorithm was provided")
+	}
+	for _, algorithm := range algorithms {
+		if !IsSRIAlgorithm(algorithm) {
+			return nil, errors.Errorf("unable to create SRI map: %s is not supported by Subresource Integrity",
+				algorithm.Name)
+		}
+	}
+
+	sriMap := map[string]string{}
+	for relativePath, entry := range d.PreOrder() {
+		if entry.Type() != TypeFile {
+			continue
+		}
+		tokens := make([]string, len(algorithms))
+		for i, algorithm := range algorithms {
+			digest, ok := d.options.digest(entry.(*File), algorithm.Name)
+			if !ok {
+				return nil, errors.Errorf("unable to create SRI map: the tree must be scanned with %s digests "+
+					"(see WithExtraHashers)", algorithm.Name)
+			}
+			rawDigest, err := hex.DecodeString(digest)
+			if err != nil {
+				return nil, errors.Errorf("invalid %s digest of '%s': %v", algorithm.Name, relativePath, err)
+			}
+			tokens[i] = algorithm.Name + "-" + base64.StdEncoding.EncodeToString(rawDigest)
+		}
+		urlPath := (&url.URL{Path: filepath.ToSlash(relativePath)}).EscapedPath()
+		sriMap[urlPath] = strings.Join(tokens, " ")
+	}
+	return sriMap, nil
+}
@@ -0,0 +1,51 @@
+package directory_checksum
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSRIMap(t *testing.T) {
+	d, _ := NewTree(WithHasher(SHA384), WithExtraHashers(SHA256)).
+		AddFile("js/app.js", strings.NewReader("alert(1)")).
+		AddFile("a b/c.css", strings.NewReader("x")).
+		AddSymlink("link.js", "js/app.js").
+		Build()
+	d.ComputeDirectoryChecksums()
+
+	sriMap, err := d.SRIMap(SHA384)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Expected values were computed with "openssl dgst -sha384 -binary | base64"
+	want := map[string]string{
+		"js/app.js":   "sha384-HT2E9NfWiuQ/w1PRai+hTyqW16NIoCGA/m8VQDUopfAtcz6YQjtsMmQd5uRbVDpW",
+		"a%20b/c.css": "sha384-11LCxR+6DimqGQVwqdQlPkQHegWNMpf6OlYw1b0BJiL5fCisrtMTtcg7uZDKp9qF",
+	}
+	if !reflect.DeepEqual(sriMap, want) {
+		t.Fatalf("Got %v, want %v", sriMap, want)
+	}
+
+	sriMap, err = d.SRIMap(SHA256, SHA384)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := sriMap["js/app.js"]; got != "sha256-bhHHL3z2vDgxUt0W3dWQOrprscmda2Y5pLsLg4GF+pI= "+want["js/app.js"] {
+		t.Fatalf("Got %s", got)
+	}
+}
+
+func TestSRIMapErrors(t *testing.T) {
+	d, _ := NewTree(WithHasher(SHA256)).AddFile("f", strings.NewReader("x")).Build()
+	d.ComputeDirectoryChecksums()
+	if _, err := d.SRIMap(SHA512); err == nil {
+		t.Fatal("Expected error for missing digests but did not get any")
+	}
+	if _, err := d.SRIMap(SHA1); err == nil {
+		t.Fatal("Expected error for an unsupported algorithm but did not get any")
+	}
+	if _, err := d.SRIMap(); err == nil {
+		t.Fatal("Expected error for missing algorithms but did not get any")
+	}
+}
@@ -0,0 +1,240 @@
+package directory_checksum
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/go-errors/errors"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The compression algorithms supported by WriteTar.
+const (
+	TarCompressionNone = "none"
+	TarCompressionGzip = "gzip"
+	TarCompressionZstd = "zstd"
+)
+
+// TarOptions control the reproducible tar serialization written by WriteTar. The zero value writes an uncompressed tar
+// whose entries are owned by 0:0 and have the modification time 1970-01-01T00:00:00Z.
+type TarOptions struct {
+	// ModTime is the modification time of all entries. It is truncated to seconds.
+	ModTime time.Time
+	// UID and GID are the owner of all entries. If they are -1, the owner from the Metadata is kept (0 if it is
+	// unknown).
+	UID int
+	GID int
+	// NormalizeModes replaces the permission bits: 0755 for directories and for files that are executable by anyone,
+	// 0644 for other files, and 0777 for symbolic links.
+	NormalizeModes bool
+	// Prefix is the slash-separated path of the directory in which the entries are placed, e.g. "app" for a layer that
+	// copies the tree to /app. The prefix directory has the metadata of the tree's root, its parent directories have
+	// the mode 0755. If Prefix is empty, the entries are placed at the root of the archive, and no entry is written
+	// for the tree's root.
+	Prefix string
+	// Compression is TarCompressionNone (the default if it is empty), TarCompressionGzip or TarCompressionZstd.
+	Compression string
+}
+
+// TarDigests are the digests of a tar serialization, in the "sha256:<hex>" notation of OCI descriptors.
+type TarDigests struct {
+	// DiffID is the digest of the uncompressed tar, i.e. the diff_id of an OCI image layer.
+	DiffID string
+	// Digest is the digest of the (compressed) tar, as written to the io.Writer, i.e. the digest of an OCI image
+	// layer. It equals DiffID if the tar is not compressed.
+	Digest string
+}
+
+// WriteTar writes a reproducible tar serialization of d to w, and returns its digests. The entries are sorted by name
+// (like "tar --sort=name"), all of them have the same modification time and owner, and no user or group names.
+// Directories are written before their children. Extended attributes (if the tree has them, see
+// WithExtendedAttributes) are written as PAX records. Hard links are written as regular files. Compressed tars use
+// fixed settings (gzip and zstd with the default level and without file name or timestamp), so that the same tree
+// always yields the same digests. WriteTar requires the content of the files, i.e. d must have been scanned (e.g.
+// with ScanDirectory) or built with a TreeBuilder.
+func (d *Directory) WriteTar(w io.Writer, options TarOptions) (TarDigests, error) {
+	compressedHasher := sha256.New()
+	compressor, err := newTarCompressor(io.MultiWriter(w, compressedHasher), options.Compression)
+	if err != nil {
+		return TarDigests{}, err
+	}
+	uncompressedHasher := sha256.New()
+	tarWriter := tarWriter{Writer: tar.NewWriter(io.MultiWriter(compressor, uncompressedHasher)), options: options}
+
+	prefix := strings.Trim(path.Clean("/"+options.Prefix), "/")
+	if prefix != "" {
+		parents := strings.Split(prefix, "/")
+		for i := 1; i < len(parents); i++ {
+			parent := strings.Join(parents[:i], "/")
+			if err := tarWriter.writeHeader(parent+"/", Metadata{Mode: fs.ModeDir | 0755}); err != nil {
+				return TarDigests{}, err
+			}
+		}
+		if err := tarWriter.writeHeader(prefix+"/", d.metadata); err != nil {
+			return TarDigests{}, err
+		}
+	}
+	if err := tarWriter.writeChildren(d, prefix); err != nil {
+		return TarDigests{}, err
+	}
+	if err := tarWriter.Close(); err != nil {
+		return TarDigests{}, errors.Wrap(err, 0)
+	}
+	if err := compressor.Close(); err != nil {
+		return TarDigests{}, errors.Wrap(err, 0)
+	}
+	return TarDigests{
+		DiffID: "sha256:" + hex.EncodeToString(uncompressedHasher.Sum(nil)),
+		Digest: "sha256:" + hex.EncodeToString(compressedHasher.Sum(nil)),
+	}, nil
+}
+
+// nopWriteCloser is an io.WriteCloser whose Close method does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// newTarCompressor returns an io.WriteCloser that writes the data compressed with the provided algorithm (see
+// TarOptions.Compression) to out. Closing it flushes the compressor, but does not close out.
+func newTarCompressor(out io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case "", TarCompressionNone:
+		return nopWriteCloser{out}, nil
+	case TarCompressionGzip:
+		// the zero gzip.Header has no name and no modification time
+		return gzip.NewWriterLevel(out, gzip.DefaultCompression)
+	case TarCompressionZstd:
+		encoder, err := zstd.NewWriter(out, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, errors.Wrap(err, 0)
+		}
+		return encoder, nil
+	}
+	return nil, errors.Errorf("unsupported compression '%s'", compression)
+}
+
+// tarWriter writes the entries of a tree to a tar.Writer, as configured by options.
+type tarWriter struct {
+	*tar.Writer
+	options TarOptions
+}
+
+// writeChildren writes the entries of all children of d (recursively), sorted by name, whose names are prefixed with
+// prefix.
+func (w *tarWriter) writeChildren(d *Directory, prefix string) error {
+	// like "tar --sort=name", sort the entries by name, regardless of their type
+	names := append(sortedKeys(d.dirs), sortedKeys(d.files)...)
+	sort.Strings(names)
+	for _, name := range names {
+		entryPath := path.Join(prefix, name)
+		switch child := d.child(name).(type) {
+		case *Directory:
+			if err := w.writeHeader(entryPath+"/", child.metadata); err != nil {
+				return err
+			}
+			if err := w.writeChildren(child, entryPath); err != nil {
+				return err
+			}
+		case *File:
+			if err := w.writeFile(entryPath, child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeFile writes the entry of the regular file or symbolic link f, including the content of regular files.
+func (w *tarWriter) writeFile(name string, f *File) error {
+	if f.isSymbolicLink {
+		return w.writeHeader(name, f.metadata)
+	}
+	if f.content == nil {
+		return errors.New("unable to serialize a file whose content is not available")
+	}
+	if err := w.writeHeader(name, f.metadata); err != nil {
+		return err
+	}
+
+	content, err := f.content()
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	defer content.Close()
+	written, err := io.Copy(w, content)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	if written != f.metadata.Size {
+		return errors.Errorf("the file's size changed from %d to %d bytes since it was scanned", f.metadata.Size,
+			written)
+	}
+	return nil
+}
+
+// writeHeader writes the tar header of an entry with the provided name and Metadata.
+func (w *tarWriter) writeHeader(name string, metadata Metadata) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    int64(unixPermissions(metadata.Mode)),
+		Uid:     max(metadata.UID, 0),
+		Gid:     max(metadata.GID, 0),
+		ModTime: w.options.ModTime.Truncate(time.Second),
+		Format:  tar.FormatPAX,
+	}
+	if w.options.ModTime.IsZero() {
+		header.ModTime = time.Unix(0, 0)
+	}
+	if w.options.UID != -1 {
+		header.Uid = w.options.UID
+	}
+	if w.options.GID != -1 {
+		header.Gid = w.options.GID
+	}
+	switch {
+	case metadata.Mode.IsDir():
+		header.Typeflag = tar.TypeDir
+	case metadata.Mode&fs.ModeSymlink != 0:
+		header.Typeflag, header.Linkname = tar.TypeSymlink, metadata.LinkTarget
+	default:
+		header.Typeflag, header.Size = tar.TypeReg, metadata.Size
+	}
+	if w.options.NormalizeModes {
+		header.Mode = tarNormalizedMode(header.Typeflag, header.Mode)
+	}
+	for _, xattrName := range sortedKeys(metadata.Xattrs) {
+		if header.PAXRecords == nil {
+			header.PAXRecords = map[string]string{}
+		}
+		header.PAXRecords["SCHILY.xattr."+xattrName] = metadata.Xattrs[xattrName]
+	}
+	if err := w.WriteHeader(header); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+// tarNormalizedMode returns the normalized mode (see TarOptions.NormalizeModes) of an entry of the provided type whose
+// mode is currently mode.
+func tarNormalizedMode(typeFlag byte, mode int64) int64 {
+	switch {
+	case typeFlag == tar.TypeDir:
+		return 0755
+	case typeFlag == tar.TypeSymlink:
+		return 0777
+	case mode&0111 != 0:
+		return 0755
+	}
+	return 0644
+}
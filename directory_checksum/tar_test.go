@@ -0,0 +1,187 @@
+package directory_checksum
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/afero"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readTarEntries returns one line per entry of the uncompressed tar, with its name, type, mode, owner, modification
+// time, link target and content.
+func readTarEntries(t *testing.T, r io.Reader) []string {
+	var entries []string
+	tarReader := tar.NewReader(r)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		content, _ := io.ReadAll(tarReader)
+		entries = append(entries, fmt.Sprintf("%s %c %o %d:%d %d %s %s", header.Name, header.Typeflag, header.Mode,
+			header.Uid, header.Gid, header.ModTime.Unix(), header.Linkname, content))
+	}
+}
+
+func TestWriteTar(t *testing.T) {
+	d, _ := NewTree(WithHasher(SHA256)).
+		AddFile("b.txt", strings.NewReader("foo")).
+		AddFile("a/z.txt", strings.NewReader("bar")).
+		AddDir("a.d").
+		AddSymlink("a/link", "z.txt").
+		Build()
+
+	buffer := bytes.Buffer{}
+	digests, err := d.WriteTar(&buffer, TarOptions{ModTime: time.Unix(1700000000, 5)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []string{
+		"a/ 5 755 0:0 1700000000  ",
+		"a/link 2 777 0:0 1700000000 z.txt ",
+		"a/z.txt 0 644 0:0 1700000000  bar",
+		"a.d/ 5 755 0:0 1700000000  ",
+		"b.txt 0 644 0:0 1700000000  foo",
+	}
+	if got := readTarEntries(t, bytes.NewReader(buffer.Bytes())); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("Got entries %q, want %q", got, want)
+	}
+	sum := sha256.Sum256(buffer.Bytes())
+	if want := "sha256:" + hex.EncodeToString(sum[:]); digests.DiffID != want || digests.Digest != want {
+		t.Fatalf("Got digests %+v, want %s", digests, want)
+	}
+
+	// the serialization is reproducible
+	again, _ := d.WriteTar(io.Discard, TarOptions{ModTime: time.Unix(1700000000, 0)})
+	if again != digests {
+		t.Fatalf("Got digests %+v, want %+v", again, digests)
+	}
+}
+
+func TestWriteTarPrefix(t *testing.T) {
+	d, _ := NewTree(WithHasher(SHA256)).AddFile("f", strings.NewReader("x")).Build()
+
+	buffer := bytes.Buffer{}
+	if _, err := d.WriteTar(&buffer, TarOptions{Prefix: "/usr/local/app/", UID: 1000, GID: 1000}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []string{
+		"usr/ 5 755 1000:1000 0  ",
+		"usr/local/ 5 755 1000:1000 0  ",
+		"usr/local/app/ 5 755 1000:1000 0  ",
+		"usr/local/app/f 0 644 1000:1000 0  x",
+	}
+	if got := readTarEntries(t, &buffer); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("Got entries %q, want %q", got, want)
+	}
+}
+
+func TestWriteTarModesAndOwner(t *testing.T) {
+	tempDir := t.TempDir()
+	os.Mkdir(filepath.Join(tempDir, "d"), 0700)
+	os.WriteFile(filepath.Join(tempDir, "d", "run"), []byte("#!"), 0700)
+	os.WriteFile(filepath.Join(tempDir, "secret"), []byte("s"), 0600)
+	d, err := ScanDirectory(tempDir, afero.NewOsFs())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	buffer := bytes.Buffer{}
+	if _, err := d.WriteTar(&buffer, TarOptions{NormalizeModes: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []string{
+		"d/ 5 755 0:0 0  ",
+		"d/run 0 755 0:0 0  #!",
+		"secret 0 644 0:0 0  s",
+	}
+	if got := readTarEntries(t, &buffer); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("Got entries %q, want %q", got, want)
+	}
+
+	// with UID and GID -1, the scanned owner is kept (which is unknown on Windows)
+	if d.metadata.UID == -1 {
+		return
+	}
+	buffer.Reset()
+	if _, err := d.WriteTar(&buffer, TarOptions{UID: -1, GID: -1}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	owner := fmt.Sprintf("%d:%d", d.metadata.UID, d.metadata.GID)
+	want = []string{
+		"d/ 5 700 " + owner + " 0  ",
+		"d/run 0 700 " + owner + " 0  #!",
+		"secret 0 600 " + owner + " 0  s",
+	}
+	if got := readTarEntries(t, &buffer); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("Got entries %q, want %q", got, want)
+	}
+}
+
+func TestWriteTarCompression(t *testing.T) {
+	d, _ := NewTree(WithHasher(SHA256)).
+		AddFile("a/b.txt", strings.NewReader(strings.Repeat("compressible ", 1000))).
+		Build()
+	uncompressed, _ := d.WriteTar(io.Discard, TarOptions{})
+
+	for _, compression := range []string{TarCompressionGzip, TarCompressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			buffer := bytes.Buffer{}
+			digests, err := d.WriteTar(&buffer, TarOptions{Compression: compression})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			sum := sha256.Sum256(buffer.Bytes())
+			if digests.DiffID != uncompressed.DiffID || digests.Digest != "sha256:"+hex.EncodeToString(sum[:]) {
+				t.Fatalf("Got digests %+v, want diff ID %s and digest %x", digests, uncompressed.DiffID, sum)
+			}
+
+			var decompressed io.Reader
+			if compression == TarCompressionGzip {
+				decompressed, err = gzip.NewReader(&buffer)
+			} else {
+				decompressed, err = zstd.NewReader(&buffer)
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			content, _ := io.ReadAll(decompressed)
+			if sum := sha256.Sum256(content); "sha256:"+hex.EncodeToString(sum[:]) != digests.DiffID {
+				t.Fatalf("Got decompressed digest %x, want %s", sum, digests.DiffID)
+			}
+
+			again, _ := d.WriteTar(io.Discard, TarOptions{Compression: compression})
+			if again != digests {
+				t.Fatalf("Got digests %+v, want %+v", again, digests)
+			}
+		})
+	}
+}
+
+func TestWriteTarErrors(t *testing.T) {
+	d, _ := NewTree(WithHasher(SHA256)).AddFile("f", strings.NewReader("x")).Build()
+	if _, err := d.WriteTar(io.Discard, TarOptions{Compression: "bzip2"}); err == nil {
+		t.Fatal("Expected error for an unsupported compression but did not get any")
+	}
+
+	manifest := bytes.Buffer{}
+	d.ComputeDirectoryChecksums()
+	d.WriteManifest(&manifest)
+	fromManifest, _ := ReadManifest(&manifest)
+	if _, err := fromManifest.WriteTar(io.Discard, TarOptions{}); err == nil {
+		t.Fatal("Expected error for a tree without file content but did not get any")
+	}
+}
@@ -0,0 +1,139 @@
+package directory_checksum
+
+import (
+	"bytes"
+	"github.com/go-errors/errors"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// A TreeBuilder constructs a Directory tree in memory, e.g. to compute the expected checksums of a directory layout
+// that does not exist on disk. Paths are slash-separated and relative to the root, as accepted by fs.ValidPath. Parent
+// directories are created implicitly. The first error that occurs is remembered and returned by Build(), so that calls
+// can be chained:
+//
+//	directory, err := NewTree().AddFile("a/b.txt", strings.NewReader("foo")).AddSymlink("c", "a").Build()
+type TreeBuilder struct {
+	root *Directory
+	err  error
+}
+
+// treeBuilderDirectoryMetadata is the Metadata of directories created by a TreeBuilder. Files have the mode 0644, and
+// symbolic links 0777.
+var treeBuilderDirectoryMetadata = Metadata{Known: true, Mode: fs.ModeDir | 0755, UID: -1, GID: -1}
+
+// NewTree returns an empty TreeBuilder. Of the provided options, only WithHasher, WithScheme and WithExtraHashers have
+// an effect.
+func NewTree(options ...ScanOption) *TreeBuilder {
+	root := newDirectory(newScanOptions(options...))
+	root.metadata = treeBuilderDirectoryMetadata
+	return &TreeBuilder{root: root}
+}
+
+// AddDir adds an (empty) directory at path. Adding a directory that already exists has no effect.
+func (b *TreeBuilder) AddDir(path string) *TreeBuilder {
+	if b.err != nil {
+		return b
+	}
+	_, _, b.err = b.parentDirectory(path, true)
+	return b
+}
+
+// AddFile adds a regular file at path, whose content is read from content.
+func (b *TreeBuilder) AddFile(path string, content io.Reader) *TreeBuilder {
+	if b.err != nil {
+		return b
+	}
+	data, err := io.ReadAll(content)
+	if err != nil {
+		b.err = errors.Wrap(err, 0)
+		return b
+	}
+	metadata := Metadata{Known: true, Mode: 0644, Size: int64(len(data)), UID: -1, GID: -1}
+	digests, _, err := hashReader(bytes.NewReader(data), b.root.options.newHashers(metadata, metadata.Size))
+	if err != nil {
+		b.err = err
+		return b
+	}
+	file := b.root.options.newFile(digests, false)
+	file.metadata = metadata
+	file.content = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return b.addFile(path, file)
+}
+
+// AddSymlink adds a symbolic link at path, which points to target.
+func (b *TreeBuilder) AddSymlink(path string, target string) *TreeBuilder {
+	if b.err != nil {
+		return b
+	}
+	metadata := Metadata{Known: true, Mode: fs.ModeSymlink | 0777, UID: -1, GID: -1, LinkTarget: target}
+	digests, _, err := hashReader(strings.NewReader(target), b.root.options.newHashers(metadata, int64(len(target))))
+	if err != nil {
+		b.err = err
+		return b
+	}
+	file := b.root.options.newFile(digests, true)
+	file.metadata = metadata
+	return b.addFile(path, file)
+}
+
+// Build returns the constructed Directory tree, or the first error that occurred while adding entries. The returned
+// tree can be used like the result of ScanDirectory(), e.g. by calling ComputeDirectoryChecksums() on it.
+func (b *TreeBuilder) Build() (*Directory, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.root, nil
+}
+
+// addFile adds file to the parent directory of path, failing if path is already taken.
+func (b *TreeBuilder) addFile(path string, file *File) *TreeBuilder {
+	parent, name, err := b.parentDirectory(path, false)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	if _, exists := parent.files[name]; exists {
+		b.err = errors.Errorf("unable to add '%s': a file with this path was already added", path)
+		return b
+	}
+	if _, exists := parent.dirs[name]; exists {
+		b.err = errors.Errorf("unable to add '%s': a directory with this path was already added", path)
+		return b
+	}
+	parent.files[name] = file
+	return b
+}
+
+// parentDirectory returns the Directory that (should) contain the entry at path, as well as the entry's name, creating
+// any missing parent directories. If createLeaf is true, the entry itself is also created as directory.
+func (b *TreeBuilder) parentDirectory(path string, createLeaf bool) (*Directory, string, error) {
+	if !fs.ValidPath(path) || path == "." {
+		return nil, "", errors.Errorf("invalid path '%s': must be an unrooted, slash-separated path", path)
+	}
+
+	components := strings.Split(path, "/")
+	if !createLeaf {
+		components = components[:len(components)-1]
+	}
+	current := b.root
+	current.checksum = ""
+	for i, component := range components {
+		if _, isFile := current.files[component]; isFile {
+			return nil, "", errors.Errorf("unable to add '%s': '%s' was already added as file", path,
+				strings.Join(components[:i+1], "/"))
+		}
+		subDir, ok := current.dirs[component]
+		if !ok {
+			subDir = newDirectory(current.options)
+			subDir.metadata = treeBuilderDirectoryMetadata
+			current.dirs[component] = subDir
+		}
+		current = subDir
+		current.checksum = ""
+	}
+	return current, path[strings.LastIndex(path, "/")+1:], nil
+}
@@ -0,0 +1,72 @@
+package directory_checksum
+
+import (
+	"github.com/spf13/afero"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTreeBuilderMatchesScanDirectory(t *testing.T) {
+	testingFilesystem := []TestingFilesystemObject{
+		TestingDir{absolutePath: filepath.FromSlash("/d")},
+		TestingDir{absolutePath: filepath.FromSlash("/d/empty")},
+		TestingDir{absolutePath: filepath.FromSlash("/d/sub")},
+		TestingFile{absolutePath: filepath.FromSlash("/d/sub/f"), content: "foo"},
+		TestingFile{absolutePath: filepath.FromSlash("/f"), content: "bar"},
+	}
+	filesystemImpl := afero.NewMemMapFs()
+	setUpTestingFilesystem(testingFilesystem, filesystemImpl)
+	scanned, _ := ScanDirectory(string(filepath.Separator), filesystemImpl)
+	scanned.ComputeDirectoryChecksums()
+	want := scanned.PrintChecksums(5)
+
+	built, err := NewTree().
+		AddFile("d/sub/f", strings.NewReader("foo")).
+		AddDir("d/empty").
+		AddFile("f", strings.NewReader("bar")).
+		Build()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	built.ComputeDirectoryChecksums()
+	got := built.PrintChecksums(5)
+
+	if got != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", got, want)
+	}
+}
+
+func TestTreeBuilderSymlink(t *testing.T) {
+	d, err := NewTree().AddDir("dir-target").AddSymlink("dir-source", "dir-target").Build()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d.ComputeDirectoryChecksums()
+	got := d.PrintChecksums(1)
+
+	// Same result as in TestScanWithDirectorySymlink
+	want := "14b86a68c6820d52ac6603d3f84317255e88b4ed D .\n" +
+		"da39a3ee5e6b4b0d3255bfef95601890afd80709 D dir-target\n" +
+		"51386830a6c5a495a39f7a8c17b2fc327240f699 S dir-source\n"
+	if got != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", got, want)
+	}
+}
+
+func TestTreeBuilderErrors(t *testing.T) {
+	builders := map[string]*TreeBuilder{
+		"absolute path":           NewTree().AddDir("/abs"),
+		"file below file":         NewTree().AddFile("f", strings.NewReader("")).AddFile("f/g", strings.NewReader("")),
+		"duplicate file":          NewTree().AddFile("f", strings.NewReader("")).AddSymlink("f", "target"),
+		"file replacing dir":      NewTree().AddDir("d").AddFile("d", strings.NewReader("")),
+		"dir replacing file":      NewTree().AddFile("f", strings.NewReader("")).AddDir("f"),
+		"root as file":            NewTree().AddFile(".", strings.NewReader("")),
+		"error is kept (chained)": NewTree().AddDir("../up").AddDir("ok"),
+	}
+	for name, builder := range builders {
+		if _, err := builder.Build(); err == nil {
+			t.Fatalf("Expected error for case '%s' but did not get any", name)
+		}
+	}
+}
@@ -82,3 +82,25 @@ func (w *fsWrapper) Chown(name string, uid, gid int) error {
 func (w *fsWrapper) Chtimes(name string, atime time.Time, mtime time.Time) error {
 	return w.Fs.Chtimes(name, atime, mtime)
 }
+
+// closeFailingFs is an afero.Fs whose files fail to close.
+type closeFailingFs struct {
+	afero.Fs
+}
+
+func (c closeFailingFs) Open(name string) (afero.File, error) {
+	file, err := c.Fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return closeFailingFile{file}, nil
+}
+
+type closeFailingFile struct {
+	afero.File
+}
+
+func (f closeFailingFile) Close() error {
+	f.File.Close()
+	return errors.New("closing failed")
+}
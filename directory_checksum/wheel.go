@@ -0,0 +1,351 @@
+package directory_checksum
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-errors/errors"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// wheelRecordAlgorithms contains the names of the hash algorithms that may be used in the RECORD file of a wheel.
+// Weaker algorithms, such as MD5 and SHA-1, are not allowed.
+var wheelRecordAlgorithms = map[string]bool{
+	SHA256.Name: true,
+	SHA384.Name: true,
+	SHA512.Name: true,
+}
+
+// A WheelRecordEntry is one row of the RECORD file of a Python wheel or installed distribution.
+type WheelRecordEntry struct {
+	// Path is the slash-separated path of the file, relative to the root of the wheel (or the site-packages
+	// directory). Files that are installed elsewhere, e.g. scripts, have paths that start with "../".
+	Path string
+	// Hash has the format "<algorithm>=<urlsafe base64 digest without padding>", or is empty for files that are not
+	// hashed, such as the RECORD file itself.
+	Hash string
+	// Size is the size of the file in bytes, or -1 if it is not recorded.
+	Size int64
+}
+
+// A WheelRecord is the content of the RECORD file of a Python wheel or installed distribution (see the "Recording
+// installed packages" specification of the Python Packaging Authority), as read by ReadWheelRecord.
+type WheelRecord struct {
+	Entries []WheelRecordEntry
+	// UseCRLF is true if the lines end with "\r\n" (like in the RECORD files written by pip during installation)
+	// instead of "\n" (like in the RECORD files of wheels).
+	UseCRLF bool
+}
+
+// A WheelRecordDifference is a difference between a WheelRecord and a Directory tree. For DifferenceModified and
+// DifferenceTypeChanged, Field names the part of the entry that differs ("hash", "size" or "type"), and Expected and
+// Actual contain the values.
+type WheelRecordDifference struct {
+	// Path is the slash-separated path of the entry, relative to the root directory.
+	Path     string
+	Kind     DifferenceKind
+	Field    string
+	Expected string
+	Actual   string
+}
+
+func (d WheelRecordDifference) String() string {
+	if d.Field == "" {
+		return fmt.Sprintf("%s: %s", d.Kind, d.Path)
+	}
+	return fmt.Sprintf("%s: %s (%s: expected %s, got %s)", d.Kind, d.Path, d.Field, d.Expected, d.Actual)
+}
+
+// ReadWheelRecord parses a RECORD file, which is a CSV file with the columns path, hash and size.
+func ReadWheelRecord(r io.Reader) (*WheelRecord, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	record := WheelRecord{UseCRLF: bytes.Contains(data, []byte("\r\n"))}
+	for lineNumber := 1; ; lineNumber++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Errorf("invalid RECORD: %v", err)
+		}
+		if len(row) != 3 {
+			return nil, errors.Errorf("invalid RECORD entry in line %d: expected 3 columns, got %d", lineNumber,
+				len(row))
+		}
+		entry := WheelRecordEntry{Path: row[0], Hash: row[1], Size: -1}
+		if entry.Path == "" {
+			return nil, errors.Errorf("invalid RECORD entry in line %d: the path is empty", lineNumber)
+		}
+		if entry.Hash != "" {
+			if _, _, err = parseWheelRecordHash(entry.Hash); err != nil {
+				return nil, errors.Errorf("invalid RECORD entry in line %d: %v", lineNumber, err)
+			}
+		}
+		if row[2] != "" {
+			entry.Size, err = strconv.ParseInt(row[2], 10, 64)
+			if err != nil || entry.Size < 0 {
+				return nil, errors.Errorf("invalid RECORD entry in line %d: invalid size '%s'", lineNumber, row[2])
+			}
+		}
+		record.Entries = append(record.Entries, entry)
+	}
+	return &record, nil
+}
+
+// Write writes r to w in the CSV format of RECORD files.
+func (r *WheelRecord) Write(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.UseCRLF = r.UseCRLF
+	for _, entry := range r.Entries {
+		size := ""
+		if entry.Size >= 0 {
+			size = strconv.FormatInt(entry.Size, 10)
+		}
+		if err := writer.Write([]string{entry.Path, entry.Hash, size}); err != nil {
+			return errors.Wrap(err, 0)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
+
+// HashAlgorithms returns the hash algorithms that are used by the entries of r, sorted by name. Verify() and Update()
+// require a tree that contains the digests of these algorithms.
+func (r *WheelRecord) HashAlgorithms() []HashAlgorithm {
+	algorithmsByName := map[string]HashAlgorithm{}
+	for _, entry := range r.Entries {
+		if algorithm, _, err := parseWheelRecordHash(entry.Hash); err == nil {
+			algorithmsByName[algorithm.Name] = algorithm
+		}
+	}
+	var algorithms []HashAlgorithm
+	for _, name := range sortedKeys(algorithmsByName) {
+		algorithms = append(algorithms, algorithmsByName[name])
+	}
+	return algorithms
+}
+
+// Verify checks d, the root of an unpacked wheel or a site-packages directory, against r and returns the differences,
+// sorted by path. The hash and size of every listed file is verified (as far as they are recorded), files that are
+// not hashed (such as RECORD itself) only need to exist. Entries whose path is outside of d are skipped. Files and
+// symbolic links that exist in d but are not listed in r are reported as added. To verify a site-packages directory,
+// merge the entries of the RECORD files of all of its distributions into one WheelRecord.
+func (r *WheelRecord) Verify(d *Directory) ([]WheelRecordDifference, error) {
+	var differences []WheelRecordDifference
+	listedPaths := map[string]bool{}
+	for _, entry := range r.Entries {
+		relativePath, isInTree := wheelRecordTreePath(entry.Path)
+		if !isInTree {
+			continue
+		}
+		listedPaths[relativePath] = true
+
+		actual, exists := d.Lookup(relativePath)
+		if !exists {
+			differences = append(differences, WheelRecordDifference{Path: relativePath, Kind: DifferenceRemoved})
+			continue
+		}
+		if actual.Type() != TypeFile {
+			differences = append(differences, WheelRecordDifference{Path: relativePath, Kind: DifferenceTypeChanged,
+				Field: "type", Expected: mtreeType(TypeFile), Actual: mtreeType(actual.Type())})
+			continue
+		}
+		file := actual.(*File)
+		if entry.Hash != "" {
+			algorithm, expectedDigest, err := parseWheelRecordHash(entry.Hash)
+			if err != nil {
+				return nil, errors.Errorf("unable to verify '%s': %v", relativePath, err)
+			}
+			actualDigest, err := d.options.wheelRecordDigest(file, algorithm)
+			if err != nil {
+				return nil, errors.Errorf("unable to verify '%s': %v", relativePath, err)
+			}
+			if actualDigest != expectedDigest {
+				actualHash, _ := formatWheelRecordHash(algorithm, actualDigest)
+				differences = append(differences, WheelRecordDifference{Path: relativePath, Kind: DifferenceModified,
+					Field: "hash", Expected: entry.Hash, Actual: actualHash})
+			}
+		}
+		if entry.Size >= 0 && file.metadata.Known && file.metadata.Size != entry.Size {
+			differences = append(differences, WheelRecordDifference{Path: relativePath, Kind: DifferenceModified,
+				Field: "size", Expected: strconv.FormatInt(entry.Size, 10),
+				Actual: strconv.FormatInt(file.metadata.Size, 10)})
+		}
+	}
+
+	for relativePath, entry := range d.PreOrder() {
+		relativePath = filepath.ToSlash(relativePath)
+		if entry.Type() != TypeDir && !listedPaths[relativePath] {
+			differences = append(differences, WheelRecordDifference{Path: relativePath, Kind: DifferenceAdded})
+		}
+	}
+
+	sort.SliceStable(differences, func(i, j int) bool { return differences[i].Path < differences[j].Path })
+	return differences, nil
+}
+
+// Update returns a copy of r in which the hash and size of every listed file are recomputed from d, e.g. after the
+// files were patched. Hashes keep their algorithm. Entries of files that no longer exist in d are dropped, entries
+// whose path is outside of d are kept unchanged, and files that are not listed in r are not added (see WheelRecord).
+func (r *WheelRecord) Update(d *Directory) (*WheelRecord, error) {
+	updated := WheelRecord{UseCRLF: r.UseCRLF}
+	for _, entry := range r.Entries {
+		relativePath, isInTree := wheelRecordTreePath(entry.Path)
+		if !isInTree {
+			updated.Entries = append(updated.Entries, entry)
+			continue
+		}
+		actual, exists := d.Lookup(relativePath)
+		if !exists {
+			continue
+		}
+		if actual.Type() != TypeFile {
+			return nil, errors.Errorf("unable to update the RECORD entry of '%s': it is not a regular file",
+				relativePath)
+		}
+		if entry.Hash != "" {
+			algorithm, _, err := parseWheelRecordHash(entry.Hash)
+			if err == nil {
+				entry, err = d.options.wheelRecordEntry(entry.Path, actual.(*File), algorithm)
+			}
+			if err != nil {
+				return nil, errors.Errorf("unable to update the RECORD entry of '%s': %v", relativePath, err)
+			}
+		}
+		updated.Entries = append(updated.Entries, entry)
+	}
+	return &updated, nil
+}
+
+// WheelRecord returns the RECORD of the wheel whose root is d, which lists every regular file below d with its
+// SHA-256 hash and size, sorted by path (like pip does). recordPath is the slash-separated path of the RECORD file
+// (e.g. "foo-1.0.dist-info/RECORD"), which is listed without hash and size, just like the signature files
+// "RECORD.jws" and "RECORD.p7s" next to it. previous is the old RECORD (which may be nil): files that it lists
+// without hash (such as the ".pyc" files compiled during installation) stay unhashed, its entries whose path is
+// outside of d (such as installed scripts) are kept, and so are its line endings. The tree must have SHA256 digests
+// and must not contain symbolic links.
+func (d *Directory) WheelRecord(recordPath string, previous *WheelRecord) (*WheelRecord, error) {
+	recordPath = path.Clean(recordPath)
+	unhashedPaths := map[string]bool{recordPath: true, recordPath + ".jws": true, recordPath + ".p7s": true}
+	if previous != nil {
+		for _, entry := range previous.Entries {
+			if relativePath, isInTree := wheelRecordTreePath(entry.Path); isInTree && entry.Hash == "" {
+				unhashedPaths[relativePath] = true
+			}
+		}
+	}
+	record := WheelRecord{}
+	if previous != nil {
+		record.UseCRLF = previous.UseCRLF
+	}
+	recordIsListed := false
+	for relativePath, entry := range d.PreOrder() {
+		relativePath = filepath.ToSlash(relativePath)
+		switch {
+		case entry.Type() == TypeSymlink:
+			return nil, errors.Errorf("unable to create RECORD: '%s' is a symbolic link, which wheels do not support",
+				relativePath)
+		case entry.Type() == TypeDir:
+			continue
+		case unhashedPaths[relativePath]:
+			record.Entries = append(record.Entries, WheelRecordEntry{Path: relativePath, Size: -1})
+			recordIsListed = recordIsListed || relativePath == recordPath
+			continue
+		}
+		recordEntry, err := d.options.wheelRecordEntry(relativePath, entry.(*File), SHA256)
+		if err != nil {
+			return nil, errors.Errorf("unable to create RECORD: %v", err)
+		}
+		record.Entries = append(record.Entries, recordEntry)
+	}
+	if !recordIsListed {
+		record.Entries = append(record.Entries, WheelRecordEntry{Path: recordPath, Size: -1})
+	}
+	if previous != nil {
+		for _, entry := range previous.Entries {
+			if _, isInTree := wheelRecordTreePath(entry.Path); !isInTree {
+				record.Entries = append(record.Entries, entry)
+			}
+		}
+	}
+	sort.SliceStable(record.Entries, func(i, j int) bool { return record.Entries[i].Path < record.Entries[j].Path })
+	return &record, nil
+}
+
+// wheelRecordDigest returns the hex-encoded digest of file, computed with algorithm, which must be allowed in RECORD
+// files.
+func (o *scanOptions) wheelRecordDigest(file *File, algorithm HashAlgorithm) (string, error) {
+	if !wheelRecordAlgorithms[algorithm.Name] {
+		return "", errors.Errorf("the %s algorithm is not allowed in RECORD files", algorithm.Name)
+	}
+	digest, ok := o.digest(file, algorithm.Name)
+	if !ok {
+		return "", errors.Errorf("the tree must be scanned with %s digests (see WithExtraHashers)", algorithm.Name)
+	}
+	return digest, nil
+}
+
+// wheelRecordEntry returns the RECORD entry of file, which has the provided path, with a hash of the provided
+// algorithm.
+func (o *scanOptions) wheelRecordEntry(recordPath string, file *File, algorithm HashAlgorithm) (WheelRecordEntry,
+	error) {
+	digest, err := o.wheelRecordDigest(file, algorithm)
+	if err != nil {
+		return WheelRecordEntry{}, err
+	}
+	hash, err := formatWheelRecordHash(algorithm, digest)
+	if err != nil {
+		return WheelRecordEntry{}, err
+	}
+	return WheelRecordEntry{Path: recordPath, Hash: hash, Size: file.metadata.Size}, nil
+}
+
+// formatWheelRecordHash returns the hash column of a RECORD entry for the provided hex-encoded digest.
+func formatWheelRecordHash(algorithm HashAlgorithm, digest string) (string, error) {
+	rawDigest, err := hex.DecodeString(digest)
+	if err != nil {
+		return "", errors.Errorf("invalid %s digest '%s': %v", algorithm.Name, digest, err)
+	}
+	return algorithm.Name + "=" + base64.RawURLEncoding.EncodeToString(rawDigest), nil
+}
+
+// parseWheelRecordHash parses the hash column of a RECORD entry and returns the hash algorithm and the hex-encoded
+// digest.
+func parseWheelRecordHash(hash string) (HashAlgorithm, string, error) {
+	algorithmName, encodedDigest, found := strings.Cut(hash, "=")
+	algorithm, ok := hashAlgorithms[algorithmName]
+	if !found || !ok || !wheelRecordAlgorithms[algorithmName] {
+		return HashAlgorithm{}, "", errors.Errorf("unsupported hash '%s': expected <algorithm>=<digest> with one "+
+			"of the algorithms %s", hash, strings.Join(sortedKeys(wheelRecordAlgorithms), ", "))
+	}
+	rawDigest, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encodedDigest, "="))
+	if err != nil || len(rawDigest) != algorithm.New().Size() {
+		return HashAlgorithm{}, "", errors.Errorf("invalid %s digest '%s'", algorithm.Name, encodedDigest)
+	}
+	return algorithm, hex.EncodeToString(rawDigest), nil
+}
+
+// wheelRecordTreePath returns the cleaned path of a RECORD entry, and false if the path is outside of the root
+// directory (like "../../bin/script" or absolute paths).
+func wheelRecordTreePath(recordPath string) (string, bool) {
+	cleanPath := path.Clean(recordPath)
+	if path.IsAbs(cleanPath) || cleanPath == ".." || strings.HasPrefix(cleanPath, "../") || cleanPath == "." {
+		return cleanPath, false
+	}
+	return cleanPath, true
+}
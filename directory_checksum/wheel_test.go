@@ -0,0 +1,207 @@
+package directory_checksum
+
+import (
+	"bytes"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Expected hashes were computed with Python's hashlib and base64.urlsafe_b64encode, like pip and wheel do.
+const wheelTestRecord = `pkg/__init__.py,sha256=LCa0a2j_xo_5m0U8HTBBNBNCLXBkg7-g-YpeiGJm564,3
+pkg/__pycache__/__init__.cpython-312.pyc,,
+"pkg/a,b.py",sha256=_N4rLtula_QIYB-3If6bXDONEO5CnqBPrlURto-_j7k,3
+../../../bin/script,sha256=zEIVUIj8pXMHWNtysqW8ozESqUHfqi1DCY7EIs5OohM,9
+pkg-1.0.dist-info/RECORD,,
+`
+
+func TestReadWheelRecord(t *testing.T) {
+	record, err := ReadWheelRecord(strings.NewReader(wheelTestRecord))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(record.Entries) != 5 {
+		t.Fatalf("Got %d entries, want 5", len(record.Entries))
+	}
+	want := WheelRecordEntry{Path: "pkg/a,b.py", Hash: "sha256=_N4rLtula_QIYB-3If6bXDONEO5CnqBPrlURto-_j7k", Size: 3}
+	if record.Entries[2] != want {
+		t.Fatalf("Got %+v, want %+v", record.Entries[2], want)
+	}
+	if record.Entries[1].Size != -1 {
+		t.Fatalf("Got size %d for an entry without size", record.Entries[1].Size)
+	}
+
+	// writing the record again must reproduce the original content
+	buffer := bytes.Buffer{}
+	if err = record.Write(&buffer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buffer.String() != wheelTestRecord {
+		t.Fatalf("Got %s, want %s", buffer.String(), wheelTestRecord)
+	}
+
+	crlfRecord := strings.ReplaceAll(wheelTestRecord, "\n", "\r\n")
+	record, err = ReadWheelRecord(strings.NewReader(crlfRecord))
+	if err != nil || !record.UseCRLF {
+		t.Fatalf("Unexpected result for a record with CRLF line endings: %v", err)
+	}
+	buffer.Reset()
+	record.Write(&buffer)
+	if buffer.String() != crlfRecord {
+		t.Fatalf("Got %q, want %q", buffer.String(), crlfRecord)
+	}
+
+	for _, invalid := range []string{"a,sha256=abc,1\n", "a,md5=rL0Y20zC-Fzt72VPzMSk2A,3\n", "a,,x\n", "a,,\nb\n",
+		",,\n", "a,sha256=LCa0a2j_xo_5m0U8HTBBNBNCLXBkg7-g-YpeiGJm564,-1\n"} {
+		if _, err = ReadWheelRecord(strings.NewReader(invalid)); err == nil {
+			t.Fatalf("Expected error for %q but did not get any", invalid)
+		}
+	}
+}
+
+func TestWheelRecordVerify(t *testing.T) {
+	record, _ := ReadWheelRecord(strings.NewReader(wheelTestRecord))
+	d, _ := NewTree(WithHasher(SHA256)).
+		AddFile("pkg/__init__.py", strings.NewReader("foo")).
+		AddFile("pkg/__pycache__/__init__.cpython-312.pyc", strings.NewReader("anything")).
+		AddFile("pkg/a,b.py", strings.NewReader("bar")).
+		AddFile("pkg-1.0.dist-info/RECORD", strings.NewReader(wheelTestRecord)).
+		Build()
+	differences, err := record.Verify(d)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(differences) != 0 {
+		t.Fatalf("Expected no differences, got %v", differences)
+	}
+
+	d, _ = NewTree(WithHasher(SHA256)).
+		AddFile("pkg/__init__.py", strings.NewReader("foo!")).
+		AddFile("pkg/a,b.py/c", strings.NewReader("bar")).
+		AddFile("pkg/extra.py", strings.NewReader("")).
+		AddSymlink("pkg-1.0.dist-info/RECORD", "elsewhere").
+		Build()
+	differences, err = record.Verify(d)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got []string
+	for _, difference := range differences {
+		got = append(got, difference.String())
+	}
+	want := []string{
+		"type changed: pkg-1.0.dist-info/RECORD (type: expected file, got link)",
+		"modified: pkg/__init__.py (hash: expected sha256=LCa0a2j_xo_5m0U8HTBBNBNCLXBkg7-g-YpeiGJm564, got " +
+			"sha256=wOCqrqBQvPO-JsDCPVj6iQwN-3nIojAWtKhs0oym6nE)",
+		"modified: pkg/__init__.py (size: expected 3, got 4)",
+		"removed: pkg/__pycache__/__init__.cpython-312.pyc",
+		"type changed: pkg/a,b.py (type: expected file, got dir)",
+		"added: pkg/a,b.py/c",
+		"added: pkg/extra.py",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Got differences %v, want %v", got, want)
+	}
+}
+
+func TestWheelRecordVerifyModeZero(t *testing.T) {
+	record, _ := ReadWheelRecord(strings.NewReader("f,sha256=LCa0a2j_xo_5m0U8HTBBNBNCLXBkg7-g-YpeiGJm564,3\n"))
+	d, _ := NewTree(WithHasher(SHA256)).AddFile("f", strings.NewReader("foo")).Build()
+	// a file without any permissions, whose size differs from the record
+	d.files["f"].metadata.Mode = 0
+	d.files["f"].metadata.Size = 4
+	differences, err := record.Verify(d)
+	if err != nil || len(differences) != 1 || differences[0].Field != "size" {
+		t.Fatalf("Unexpected verification result: %v, %v", differences, err)
+	}
+}
+
+func TestWheelRecordVerifySHA512(t *testing.T) {
+	record, _ := ReadWheelRecord(strings.NewReader("f,sha512=9_u6bgY2-JDlb7vzKD5STG-jIErimDgtYkdB0NxmODJuKCxBvl5CVNiCB" +
+		"3LFUYosWowMf37aGVlKfrU5RT4e1w,3\n"))
+	if algorithms := record.HashAlgorithms(); len(algorithms) != 1 || algorithms[0].Name != SHA512.Name {
+		t.Fatalf("Got algorithms %v", algorithms)
+	}
+	d, _ := NewTree(WithHasher(SHA256)).AddFile("f", strings.NewReader("foo")).Build()
+	if _, err := record.Verify(d); err == nil {
+		t.Fatal("Expected error for missing SHA512 digests but did not get any")
+	}
+	d, _ = NewTree(WithHasher(SHA256), WithExtraHashers(SHA512)).AddFile("f", strings.NewReader("foo")).Build()
+	differences, err := record.Verify(d)
+	if err != nil || len(differences) != 0 {
+		t.Fatalf("Unexpected verification result: %v, %v", differences, err)
+	}
+}
+
+func TestWheelRecordUpdate(t *testing.T) {
+	record, _ := ReadWheelRecord(strings.NewReader(wheelTestRecord))
+	d, _ := NewTree(WithHasher(SHA256)).
+		AddFile("pkg/__init__.py", strings.NewReader("print(1)\n")).
+		AddFile("pkg/a,b.py", strings.NewReader("bar")).
+		AddFile("pkg/unlisted.py", strings.NewReader("")).
+		AddFile("pkg-1.0.dist-info/RECORD", strings.NewReader(wheelTestRecord)).
+		Build()
+	updated, err := record.Update(d)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	buffer := bytes.Buffer{}
+	updated.Write(&buffer)
+	want := `pkg/__init__.py,sha256=zEIVUIj8pXMHWNtysqW8ozESqUHfqi1DCY7EIs5OohM,9
+"pkg/a,b.py",sha256=_N4rLtula_QIYB-3If6bXDONEO5CnqBPrlURto-_j7k,3
+../../../bin/script,sha256=zEIVUIj8pXMHWNtysqW8ozESqUHfqi1DCY7EIs5OohM,9
+pkg-1.0.dist-info/RECORD,,
+`
+	if buffer.String() != want {
+		t.Fatalf("Got %s, want %s", buffer.String(), want)
+	}
+}
+
+func TestDirectoryWheelRecord(t *testing.T) {
+	tempDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tempDir, "pkg-1.0.dist-info"), 0755)
+	os.MkdirAll(filepath.Join(tempDir, "pkg", "__pycache__"), 0755)
+	os.WriteFile(filepath.Join(tempDir, "pkg", "__pycache__", "__init__.cpython-312.pyc"), []byte("pyc"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "pkg", "__init__.py"), []byte("foo"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "pkg-1.0.dist-info", "METADATA"), []byte("bar"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "pkg-1.0.dist-info", "RECORD.jws"), []byte("signature"), 0644)
+
+	d, err := ScanDirectory(tempDir, afero.NewOsFs(), WithHasher(SHA256))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	previous, _ := ReadWheelRecord(strings.NewReader(wheelTestRecord))
+	record, err := d.WheelRecord("pkg-1.0.dist-info/RECORD", previous)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	buffer := bytes.Buffer{}
+	record.Write(&buffer)
+	// the .pyc file stays unhashed, because it is unhashed in the previous record
+	want := `../../../bin/script,sha256=zEIVUIj8pXMHWNtysqW8ozESqUHfqi1DCY7EIs5OohM,9
+pkg-1.0.dist-info/METADATA,sha256=_N4rLtula_QIYB-3If6bXDONEO5CnqBPrlURto-_j7k,3
+pkg-1.0.dist-info/RECORD,,
+pkg-1.0.dist-info/RECORD.jws,,
+pkg/__init__.py,sha256=LCa0a2j_xo_5m0U8HTBBNBNCLXBkg7-g-YpeiGJm564,3
+pkg/__pycache__/__init__.cpython-312.pyc,,
+`
+	if buffer.String() != want {
+		t.Fatalf("Got %s, want %s", buffer.String(), want)
+	}
+
+	// the generated record must verify the tree, once the RECORD file exists
+	os.WriteFile(filepath.Join(tempDir, "pkg-1.0.dist-info", "RECORD"), buffer.Bytes(), 0644)
+	d, _ = ScanDirectory(tempDir, afero.NewOsFs(), WithHasher(SHA256))
+	if differences, err := record.Verify(d); err != nil || len(differences) != 0 {
+		t.Fatalf("Unexpected verification result: %v, %v", differences, err)
+	}
+
+	os.Symlink("pkg", filepath.Join(tempDir, "link"))
+	d, _ = ScanDirectory(tempDir, afero.NewOsFs(), WithHasher(SHA256))
+	if _, err = d.WheelRecord("pkg-1.0.dist-info/RECORD", nil); err == nil {
+		t.Fatal("Expected error for a symbolic link but did not get any")
+	}
+}
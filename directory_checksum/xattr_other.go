@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package directory_checksum
+
+// readExtendedAttributes always returns nil, because extended attributes are not supported on this platform.
+func readExtendedAttributes(_ string) (map[string]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,59 @@
+//go:build linux || darwin
+
+package directory_checksum
+
+import (
+	"bytes"
+	"github.com/go-errors/errors"
+	"golang.org/x/sys/unix"
+)
+
+// readExtendedAttributes returns the extended attributes of the file at absolutePath, without following symbolic
+// links. It returns nil if the file has none, or if the file system does not support them. Like BuildKit, attributes
+// that vanish while they are read are skipped.
+func readExtendedAttributes(absolutePath string) (map[string]string, error) {
+	for {
+		size, err := unix.Llistxattr(absolutePath, nil)
+		if err == unix.ENOTSUP || err == unix.EOPNOTSUPP {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.Errorf("unable to list the extended attributes of %s: %v", absolutePath, err)
+		}
+		if size == 0 {
+			return nil, nil
+		}
+		names := make([]byte, size)
+		size, err = unix.Llistxattr(absolutePath, names)
+		if err == unix.ERANGE {
+			// The list grew between the two calls
+			continue
+		}
+		if err != nil {
+			return nil, errors.Errorf("unable to list the extended attributes of %s: %v", absolutePath, err)
+		}
+		return readExtendedAttributeValues(absolutePath, names[:size]), nil
+	}
+}
+
+// readExtendedAttributeValues returns the values of the extended attributes whose NUL-terminated names are
+// concatenated in names.
+func readExtendedAttributeValues(absolutePath string, names []byte) map[string]string {
+	xattrs := map[string]string{}
+	for _, name := range bytes.Split(bytes.TrimSuffix(names, []byte{0}), []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		size, err := unix.Lgetxattr(absolutePath, string(name), nil)
+		if err != nil {
+			continue
+		}
+		value := make([]byte, size)
+		size, err = unix.Lgetxattr(absolutePath, string(name), value)
+		if err != nil {
+			continue
+		}
+		xattrs[string(name)] = string(value[:size])
+	}
+	return xattrs
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/MShekow/directory-checksum/directory_checksum"
+	"github.com/spf13/afero"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// runExportTar implements the "export-tar" subcommand, which writes a reproducible tar of a directory and prints its
+// digests, i.e. the diff_id and digest of an OCI image layer with the directory's content.
+func runExportTar(arguments []string) {
+	flagSet := flag.NewFlagSet("export-tar", flag.ExitOnError)
+	flagSet.SetOutput(os.Stdout)
+	outputPath := flagSet.String("output", "", "Path of the tar file to write. If omitted, only the digests are "+
+		"printed")
+	compression := flagSet.String("compression", directory_checksum.TarCompressionNone, "Compression: 'none', "+
+		"'gzip' or 'zstd'")
+	uid := flagSet.Int("uid", 0, "Owner UID of all entries, or -1 to keep the owner of the scanned files")
+	gid := flagSet.Int("gid", 0, "Owner GID of all entries, or -1 to keep the group of the scanned files")
+	normalizeModes := flagSet.Bool("normalize-modes", false, "Replace the permissions with 0755 (directories and "+
+		"executable files), 0644 (other files) or 0777 (symbolic links)")
+	prefix := flagSet.String("prefix", "", "Directory (e.g. 'app') in which the entries are placed, like the "+
+		"destination of a COPY instruction")
+	xattrs := flagSet.Bool("xattrs", false, "Include the extended attributes of the scanned files (Linux and macOS "+
+		"only)")
+	flagSet.Usage = func() {
+		fmt.Printf("Usage of Directory Checksum Tool %s:\n\n", version)
+		fmt.Println("directory-checksum export-tar [--output=<file>] [--compression=C] [--uid=N] [--gid=N] " +
+			"[--normalize-modes] [--prefix=DIR] [--xattrs] <path>")
+		fmt.Println("\nWrites a reproducible tar of the directory (sorted entries in PAX format, without user and " +
+			"group names),\nand prints the SHA-256 digests of the uncompressed tar (the 'diff_id' of an OCI image " +
+			"layer) and of the\ncompressed tar (the layer's 'digest'). The modification time of all entries is taken " +
+			"from the\nSOURCE_DATE_EPOCH environment variable, and is 0 (1970-01-01) if it is not set.")
+		flagSet.PrintDefaults()
+		os.Exit(1)
+	}
+	_ = flagSet.Parse(arguments)
+
+	if flagSet.NArg() != 1 {
+		log.Fatal("You must provide exactly one argument: the path to the directory to be exported")
+	}
+	if *uid < -1 || *gid < -1 {
+		log.Fatal("uid and gid arguments must be -1 or larger")
+	}
+	if *compression != directory_checksum.TarCompressionNone && *compression != directory_checksum.TarCompressionGzip &&
+		*compression != directory_checksum.TarCompressionZstd {
+		log.Fatalf("Unsupported compression '%s'", *compression)
+	}
+
+	scanOptions := []directory_checksum.ScanOption{directory_checksum.WithHasher(directory_checksum.SHA256)}
+	if *xattrs {
+		scanOptions = append(scanOptions, directory_checksum.WithExtendedAttributes())
+	}
+	directory, err := directory_checksum.ScanDirectory(flagSet.Arg(0), afero.NewOsFs(), scanOptions...)
+	if err != nil {
+		exitWithError("Unable to scan the directory", err)
+	}
+	modTime, ok := sourceDateEpoch()
+	if !ok {
+		modTime = time.Unix(0, 0)
+	}
+	options := directory_checksum.TarOptions{ModTime: modTime, UID: *uid, GID: *gid, NormalizeModes: *normalizeModes,
+		Prefix: *prefix, Compression: *compression}
+
+	var digests directory_checksum.TarDigests
+	if *outputPath == "" {
+		digests, err = directory.WriteTar(io.Discard, options)
+	} else {
+		digests, err = writeTar(directory, *outputPath, options)
+	}
+	if err != nil {
+		exitWithError("Unable to write the tar", err)
+	}
+	fmt.Printf("diff_id: %s\n", digests.DiffID)
+	fmt.Printf("digest:  %s\n", digests.Digest)
+}
+
+// writeTar writes the reproducible tar of directory to the file at path, and returns its digests.
+func writeTar(directory *directory_checksum.Directory, path string,
+	options directory_checksum.TarOptions) (directory_checksum.TarDigests, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return directory_checksum.TarDigests{}, err
+	}
+	bufferedWriter := bufio.NewWriter(f)
+	digests, err := directory.WriteTar(bufferedWriter, options)
+	if err == nil {
+		err = bufferedWriter.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return digests, err
+}
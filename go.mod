@@ -6,7 +6,10 @@ toolchain go1.26.4
 
 require (
 	github.com/go-errors/errors v1.5.1
+	github.com/klauspost/compress v1.18.0
 	github.com/spf13/afero v1.15.0
+	golang.org/x/crypto v0.41.0
+	golang.org/x/sys v0.35.0
 )
 
 require golang.org/x/text v0.28.0 // indirect
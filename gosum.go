@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/MShekow/directory-checksum/directory_checksum"
+	"github.com/spf13/afero"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// printGoSumLines prints the go.sum lines of the module directory that was scanned (as fsys) with the go-h1 scheme,
+// whose files are prefixed with module ("<module path>@<version>"). The line of the go.mod file is only printed if it
+// exists in fsys, which may be a directory of an archive or image.
+func printGoSumLines(directory *directory_checksum.Directory, fsys fs.FS, module string) {
+	modulePath, version, found := strings.Cut(module, "@")
+	if !found {
+		log.Fatalf("Invalid module '%s': must have the format '<module path>@<version>'", module)
+	}
+	h1, err := directory_checksum.FormatGoH1(directory.Checksum())
+	if err != nil {
+		exitWithError("Unable to print the go.sum lines", err)
+	}
+	fmt.Printf("%s %s %s\n", modulePath, version, h1)
+
+	if fsys == nil {
+		return
+	}
+	if goMod, err := fsys.Open("go.mod"); err == nil {
+		defer goMod.Close()
+		goModH1, err := directory_checksum.GoModH1(goMod)
+		if err != nil {
+			exitWithError("Unable to hash go.mod", err)
+		}
+		fmt.Printf("%s %s/go.mod %s\n", modulePath, version, goModH1)
+	}
+}
+
+// goModFileH1 returns the "h1:" hash of the go.mod file at path.
+func goModFileH1(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return directory_checksum.GoModH1(f)
+}
+
+// runVerifyGoSum implements the "verify-gosum" subcommand, which checks the modules in a module cache or vendor
+// directory against the entries of a go.sum file.
+func runVerifyGoSum(arguments []string) {
+	flagSet := flag.NewFlagSet("verify-gosum", flag.ExitOnError)
+	flagSet.SetOutput(os.Stdout)
+	flagSet.Usage = func() {
+		fmt.Printf("Usage of Directory Checksum Tool %s:\n\n", version)
+		fmt.Println("directory-checksum verify-gosum <go.sum> <module-cache-or-vendor-dir>")
+		fmt.Println("\nComputes the 'h1:' hashes of the modules listed in <go.sum> and reports every module whose " +
+			"hash\ndiffers. The directory is either a module cache (e.g. $(go env GOMODCACHE)), or a vendor " +
+			"directory\n(detected by its modules.txt file) that contains complete copies of the modules. Modules " +
+			"that are not\npresent in the directory are skipped.")
+		flagSet.PrintDefaults()
+		os.Exit(1)
+	}
+	_ = flagSet.Parse(arguments)
+
+	if flagSet.NArg() != 2 {
+		log.Fatal("You must provide exactly two arguments: the path to the go.sum file, and the path to the module " +
+			"cache or vendor directory")
+	}
+	goSumPath := flagSet.Arg(0)
+	root := flagSet.Arg(1)
+	f, err := os.Open(goSumPath)
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to read %s", goSumPath), err)
+	}
+	entries, err := directory_checksum.ReadGoSum(f)
+	_ = f.Close()
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to read %s", goSumPath), err)
+	}
+	vendoredModules, isVendorDir := readVendoredModules(root)
+
+	verified, skipped, failed := 0, 0, 0
+	for _, entry := range entries {
+		var actual string
+		var err error
+		if isVendorDir {
+			actual, err = vendoredModuleH1(root, entry, vendoredModules)
+		} else {
+			actual, err = cachedModuleH1(root, entry)
+		}
+		if err != nil {
+			exitWithError(fmt.Sprintf("Unable to hash %s %s", entry.Module, entry.Version), err)
+		}
+		switch actual {
+		case "":
+			skipped++
+		case entry.Hash:
+			verified++
+		default:
+			failed++
+			fmt.Printf("mismatch: %s (directory has %s)\n", entry, actual)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("Verification FAILED: found %d mismatching go.sum entries\n", failed)
+		if isVendorDir {
+			fmt.Println("Note: 'go mod vendor' copies only the packages that are needed to build the main module, " +
+				"so the\nhashes of modules vendored by it never match. Only complete copies of modules can be verified.")
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("Verification succeeded: %d go.sum entries match (%d skipped because the module is not present)\n",
+		verified, skipped)
+}
+
+// cachedModuleH1 returns the "h1:" hash of the module (or go.mod file) that entry refers to, which is located in the
+// module cache at root. It returns an empty string if the module is not present in the cache.
+func cachedModuleH1(root string, entry directory_checksum.GoSumEntry) (string, error) {
+	escapedModule := filepath.FromSlash(directory_checksum.EscapeModulePath(entry.Module))
+	escapedVersion := directory_checksum.EscapeModulePath(entry.ModuleVersion())
+	moduleDir := filepath.Join(root, escapedModule+"@"+escapedVersion)
+	if entry.IsGoMod() {
+		// the go.mod files are downloaded separately, also for modules whose content was never downloaded
+		for _, goModPath := range []string{filepath.Join(root, "cache", "download", escapedModule, "@v",
+			escapedVersion+".mod"), filepath.Join(moduleDir, "go.mod")} {
+			if _, err := os.Stat(goModPath); err == nil {
+				return goModFileH1(goModPath)
+			}
+		}
+		return "", nil
+	}
+	return moduleDirH1(moduleDir, entry, nil)
+}
+
+// vendoredModuleH1 returns the "h1:" hash of the module (or go.mod file) that entry refers to, which is located in the
+// vendor directory at root. It returns an empty string if the module is not vendored in the version of entry.
+func vendoredModuleH1(root string, entry directory_checksum.GoSumEntry,
+	vendoredModules map[string]string) (string, error) {
+	if vendoredModules[entry.Module] != entry.ModuleVersion() {
+		return "", nil
+	}
+	moduleDir := filepath.Join(root, filepath.FromSlash(entry.Module))
+	if entry.IsGoMod() {
+		goModPath := filepath.Join(moduleDir, "go.mod")
+		if _, err := os.Stat(goModPath); err != nil {
+			return "", nil
+		}
+		return goModFileH1(goModPath)
+	}
+	// modules whose path is below entry.Module are vendored in sub-directories, but are not part of the module
+	return moduleDirH1(moduleDir, entry, func(relativePath string, info fs.FileInfo) bool {
+		_, isOtherModule := vendoredModules[path.Join(entry.Module, filepath.ToSlash(relativePath))]
+		return !info.IsDir() || !isOtherModule
+	})
+}
+
+// moduleDirH1 returns the "h1:" hash of the module directory at moduleDir, or an empty string if it does not exist.
+func moduleDirH1(moduleDir string, entry directory_checksum.GoSumEntry,
+	filter directory_checksum.Filter) (string, error) {
+	if info, err := os.Stat(moduleDir); err != nil || !info.IsDir() {
+		return "", nil
+	}
+	directory, err := directory_checksum.ScanDirectory(moduleDir, afero.NewOsFs(),
+		directory_checksum.WithHasher(directory_checksum.SHA256),
+		directory_checksum.WithScheme(directory_checksum.GoModuleScheme(entry.Module+"@"+entry.ModuleVersion())),
+		directory_checksum.WithFilter(filter))
+	if err != nil {
+		return "", err
+	}
+	checksum, err := directory.ComputeDirectoryChecksums()
+	if err != nil {
+		return "", err
+	}
+	return directory_checksum.FormatGoH1(checksum)
+}
+
+// readVendoredModules reads the modules.txt file of the vendor directory at root, and returns a map from the path of
+// each vendored module to its version. Replaced modules are omitted, because their content does not match go.sum. The
+// second return value is false if root is not a vendor directory.
+func readVendoredModules(root string) (map[string]string, bool) {
+	f, err := os.Open(filepath.Join(root, "modules.txt"))
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	modules := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// module lines have the format "# <module path> <version>", followed by " => <replacement>" if replaced
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "#" {
+			modules[fields[1]] = fields[2]
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		exitWithError("Unable to read modules.txt", err)
+	}
+	return modules, true
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/MShekow/directory-checksum/directory_checksum"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// runImageLayers implements the "image-layers" subcommand, which prints the checksum of a directory of an image after
+// each of its layers, and the layer that last wrote each entry of the directory.
+func runImageLayers(arguments []string) {
+	flagSet := flag.NewFlagSet("image-layers", flag.ExitOnError)
+	flagSet.SetOutput(os.Stdout)
+	directoryPath := flagSet.String("path", "/", "The directory of the image's root file system to scan, e.g. '/app'")
+	algorithm := flagSet.String("algorithm", directory_checksum.SHA1.Name, algorithmUsage)
+	platform := flagSet.String("platform", "", "The platform of a multi-platform image, e.g. 'linux/amd64' or "+
+		"'linux/arm64/v8'")
+	reference := flagSet.String("image-ref", "", "The tag of the image, if the archive or layout contains several "+
+		"images, e.g. 'app:1.0' for 'docker save' archives, or '1.0' for OCI image layouts")
+	flagSet.Usage = func() {
+		fmt.Printf("Usage of Directory Checksum Tool %s:\n\n", version)
+		fmt.Println("directory-checksum image-layers [--path=DIR] [--algorithm=A] [--platform=P] [--image-ref=R] " +
+			"<image>")
+		fmt.Println("\nApplies the layers of the image (an OCI image layout directory, or an archive created by " +
+			"'docker save' or\n'podman save') in order, and prints one line per layer: its number, the checksum of " +
+			"the directory after\napplying the layer ('-' if it does not exist yet), its diff_id and the command " +
+			"that created it. After an\nempty line, it prints one line per entry of the directory in the final " +
+			"image: the number of the layer\nthat last wrote it, its checksum, its type and its path. Comparing " +
+			"the output for two images shows the\nfirst layer after which the directory differs, and which layers " +
+			"wrote the differing files.")
+		flagSet.PrintDefaults()
+		os.Exit(1)
+	}
+	_ = flagSet.Parse(arguments)
+
+	if flagSet.NArg() != 1 {
+		log.Fatal("You must provide exactly one argument: the path to the image")
+	}
+	hashAlgorithm, ok := directory_checksum.HashAlgorithmByName(*algorithm)
+	if !ok {
+		log.Fatalf("Unsupported algorithm '%s'", *algorithm)
+	}
+	root := flagSet.Arg(0)
+	if root == stdinRoot {
+		log.Fatal("The image-layers command requires the path of an image, it cannot be read from stdin")
+	}
+
+	image, err := directory_checksum.OpenImage(root, directory_checksum.ImageOptions{Reference: *reference,
+		Platform: *platform})
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to read the image %s", root), err)
+	}
+	defer image.Close()
+	fsRoot := strings.Trim(path.Clean("/"+*directoryPath), "/")
+	if fsRoot == "" {
+		fsRoot = "."
+	}
+	snapshots, rootFS, err := image.ScanLayers(fsRoot, directory_checksum.WithHasher(hashAlgorithm))
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to scan the layers of the image %s", root), err)
+	}
+
+	for i, snapshot := range snapshots {
+		checksum := "-"
+		if snapshot.Directory != nil {
+			checksum = snapshot.Directory.Checksum()
+		}
+		// commands may span several lines (e.g. RUN instructions with here-documents)
+		createdBy := strings.Join(strings.Fields(snapshot.Layer.CreatedBy), " ")
+		fmt.Println(strings.TrimSpace(fmt.Sprintf("%d %s %s %s", i+1, checksum, snapshot.Layer.DiffID, createdBy)))
+	}
+	if len(snapshots) == 0 || snapshots[len(snapshots)-1].Directory == nil {
+		log.Fatalf("The directory %s does not exist in the image", *directoryPath)
+	}
+
+	fmt.Println()
+	for relativePath, entry := range snapshots[len(snapshots)-1].Directory.PreOrder() {
+		entryPath := path.Join("/", fsRoot, filepath.ToSlash(relativePath))
+		layer, err := rootFS.LayerOf(path.Join(fsRoot, filepath.ToSlash(relativePath)))
+		if err != nil {
+			exitWithError(fmt.Sprintf("Unable to determine the layer of %s", entryPath), err)
+		}
+		fmt.Printf("%d %s %s %s\n", layer, entry.Checksum(), entry.Type().Letter(), entryPath)
+	}
+}
@@ -1,28 +1,157 @@
 package main
 
 import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/MShekow/directory-checksum/directory_checksum"
 	"github.com/go-errors/errors"
-	"github.com/spf13/afero"
+	"io/fs"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const version = "1.4"
 
-var maxDepth int
+// algorithmUsage is the usage of the --algorithm flags, which accept the names of HashAlgorithmByName.
+const algorithmUsage = "Hash algorithm: 'md5', 'sha1', 'sha256', 'sha384' or 'sha512'"
+
+// outputOptions control how printDirectory prints the checksums of a directory.
+type outputOptions struct {
+	format   string
+	maxDepth int
+	dsse     bool
+	tag      bool
+	// name is the name of the scanned directory, used in SBOMs
+	name string
+	// fsys is the scanned directory, from which files such as go.mod are read. It is nil for merged trees.
+	fsys fs.FS
+}
+
+var output outputOptions
+var algorithm string
+var scheme string
+var narOutputPath string
+var goModule string
+var ipfsChunkSize int
+var includeHidden bool
+var fsVeritySalt string
+var sriAlgorithms string
+var buildKitSource string
+var buildKitIncludePatterns string
+var buildKitExcludePatterns string
+var archivePath string
+var isImage bool
+var imagePlatform string
+var imageReference string
 
 func init() {
-	flag.IntVar(&maxDepth, "max-depth", 2, "Max directory depth (level) of the listing to be printed")
+	registerOutputFlags(flag.CommandLine, &output)
+	flag.StringVar(&algorithm, "algorithm", directory_checksum.SHA1.Name, algorithmUsage+
+		". Defaults to 'sha256' for --format=in-toto and for the nar, go-h1, ipfs, fsverity and buildkit schemes")
+	flag.StringVar(&scheme, "scheme", directory_checksum.DefaultScheme.Name, "Checksum scheme: '"+
+		directory_checksum.DefaultScheme.Name+"', 'git' (git blob and tree object IDs, requires --algorithm "+
+		"sha1 or sha256), 'nar' (hashes of the Nix Archive serialization, like 'nix hash path'), 'go-h1' "+
+		"(Go module 'h1:' hashes, as in go.sum files), 'ipfs' (CIDv1 of the UnixFS DAG, like "+
+		"'ipfs add --only-hash -r --cid-version=1'), 'fsverity' (fs-verity file digests, like 'fsverity digest', "+
+		"requires --algorithm sha256 or sha512), or 'buildkit' (BuildKit's content checksums of a build context, "+
+		"requires --algorithm sha256)")
+	flag.StringVar(&narOutputPath, "nar-output", "", "Path of a file to which the Nix Archive (NAR) "+
+		"serialization of the directory is written")
+	flag.StringVar(&goModule, "module", "", "For --scheme=go-h1: the '<module path>@<version>' that prefixes the "+
+		"file names, which is required to get the hash that is stored in go.sum")
+	flag.IntVar(&ipfsChunkSize, "ipfs-chunk-size", directory_checksum.IPFSDefaultChunkSize, "For --scheme=ipfs: "+
+		"the size (in bytes) of the chunks into which files are split, like 'ipfs add --chunker=size-<N>'")
+	flag.BoolVar(&includeHidden, "hidden", false, "For --scheme=ipfs: include hidden files and directories "+
+		"(whose name starts with a dot), like 'ipfs add --hidden'")
+	flag.StringVar(&sriAlgorithms, "sri-algorithms", directory_checksum.SHA384.Name, "For --format=sri: "+
+		"comma-separated list of the hash algorithms of the integrity metadata ('sha256', 'sha384' or 'sha512')")
+	flag.StringVar(&fsVeritySalt, "fsverity-salt", "", "For --scheme=fsverity: the salt in hexadecimal notation, "+
+		"like 'fsverity digest --salt'")
+	flag.StringVar(&buildKitSource, "buildkit-source", "", "For --scheme=buildkit: print only the checksum that "+
+		"BuildKit computes for this source path of a COPY or ADD instruction (relative to the build context, may "+
+		"contain wildcards)")
+	flag.StringVar(&buildKitIncludePatterns, "buildkit-include", "", "For --buildkit-source: comma-separated list "+
+		"of include patterns, like the patterns that COPY --parents derives from the source path")
+	flag.StringVar(&buildKitExcludePatterns, "buildkit-exclude", "", "For --buildkit-source: comma-separated list "+
+		"of exclude patterns, like COPY --exclude")
+	flag.StringVar(&archivePath, "archive-path", "", "If <path> is an archive or --image is set: the directory "+
+		"inside the archive or the image's root file system to scan, e.g. the top-level directory of a release "+
+		"tarball, or '/app'. Defaults to the root")
+	flag.BoolVar(&isImage, "image", false, "<path> is a container image: an OCI image layout directory, or an "+
+		"archive created by 'docker save' or 'podman save'. Its layers are applied in order, and the resulting root "+
+		"file system is scanned")
+	flag.StringVar(&imagePlatform, "platform", "", "For --image: the platform of a multi-platform image, e.g. "+
+		"'linux/amd64' or 'linux/arm64/v8'")
+	flag.StringVar(&imageReference, "image-ref", "", "For --image: the tag of the image, if the archive or layout "+
+		"contains several images, e.g. 'app:1.0' for 'docker save' archives, or '1.0' for OCI image layouts")
+}
+
+// registerOutputFlags registers the flags that populate the provided outputOptions.
+func registerOutputFlags(flagSet *flag.FlagSet, options *outputOptions) {
+	flagSet.IntVar(&options.maxDepth, "max-depth", 2, "Max directory depth (level) of the listing to be printed")
+	flagSet.StringVar(&options.format, "format", "text", "Output format: 'text' (listing up to --max-depth), "+
+		"'manifest' (complete listing with header, as used by the merge command), 'in-toto' (in-toto Statement "+
+		"with one subject per file), 'spdx-json' or 'cyclonedx-json' (file-level SBOM), 'coreutils' (checksum "+
+		"of every regular file, like sha256sum), 'mtree' (BSD mtree specification), 'nix' (listing up to "+
+		"--max-depth with checksums in Nix's SRI and base-32 encodings), 'gosum' (the go.sum lines of the "+
+		"module directory, requires --scheme=go-h1), 'fsverity' (the digest of every regular file, like "+
+		"'fsverity digest', requires --scheme=fsverity), or 'sri' (JSON map from the URL path of every regular "+
+		"file to its Subresource Integrity metadata)")
+	flagSet.BoolVar(&options.dsse, "dsse", false, "For --format=in-toto: wrap the statement in an unsigned DSSE "+
+		"envelope")
+	flagSet.BoolVar(&options.tag, "tag", false, "For --format=coreutils: use the BSD style '<ALGORITHM> (<path>) = "+
+		"<checksum>'")
+}
+
+// isFlagSet returns true if the flag with the provided name was explicitly set on the command line.
+func isFlagSet(flagSet *flag.FlagSet, name string) bool {
+	found := false
+	flagSet.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
+
+// subcommands maps the names of the subcommands to their implementation, which receives the remaining arguments.
+var subcommands = map[string]func(arguments []string){
+	"export-tar":            runExportTar,
+	"image-layers":          runImageLayers,
+	"merge":                 runMerge,
+	"prove":                 runProve,
+	"sign":                  runSign,
+	"update-cargo-checksum": runUpdateCargoChecksum,
+	"update-record":         runUpdateRecord,
+	"verify":                runVerify,
+	"verify-cargo":          runVerifyCargo,
+	"verify-gosum":          runVerifyGoSum,
+	"verify-proof":          runVerifyProof,
+	"verify-record":         runVerifyRecord,
+	"verify-signature":      runVerifySignature,
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			subcommand(os.Args[2:])
+			return
+		}
+	}
+
 	flag.CommandLine.SetOutput(os.Stdout) // ensure that flag.PrintDefaults() does NOT print to stderr by default
 	flag.Usage = func() {
 		fmt.Printf("Usage of Directory Checksum Tool %s:\n\n", version)
-		fmt.Println("directory-checksum [--max-depth=N] <path>")
+		fmt.Println("directory-checksum [--max-depth=N] [--format=F] [--algorithm=A] [--scheme=S] <path>")
+		fmt.Println("directory-checksum export-tar|image-layers|merge|prove|sign|update-cargo-checksum|" +
+			"update-record|verify|verify-cargo|verify-gosum|verify-proof|verify-record|verify-signature [--help] ...")
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
@@ -30,33 +159,354 @@ func main() {
 
 	if flag.NArg() != 1 {
 		log.Fatal("You must provide exactly one argument: the absolute or relative path to the directory \n" +
-			"to be scanned (may just be a dot for the current working directory)")
+			"to be scanned (may just be a dot for the current working directory), or to an archive ('-' for a " +
+			"tar archive on stdin)")
 	}
-	if maxDepth < 0 {
+	if output.maxDepth < 0 {
 		log.Fatal("max-depth argument must be 0 or larger")
 	}
+	if (output.format == "in-toto" || scheme == directory_checksum.NarScheme.Name ||
+		scheme == directory_checksum.GoH1Scheme.Name || scheme == directory_checksum.IPFSScheme.Name ||
+		scheme == directory_checksum.FsVerityScheme.Name || scheme == directory_checksum.BuildKitScheme.Name) &&
+		!isFlagSet(flag.CommandLine, "algorithm") {
+		algorithm = directory_checksum.SHA256.Name
+	}
+	hashAlgorithm, ok := directory_checksum.HashAlgorithmByName(algorithm)
+	if !ok {
+		log.Fatalf("Unsupported algorithm '%s'", algorithm)
+	}
+	checksumScheme, ok := directory_checksum.SchemeByName(scheme)
+	if !ok {
+		log.Fatalf("Unsupported scheme '%s'", scheme)
+	}
+	if checksumScheme.Name == directory_checksum.GoH1Scheme.Name {
+		if hashAlgorithm.Name != directory_checksum.SHA256.Name {
+			log.Fatal("The go-h1 scheme requires the sha256 algorithm")
+		}
+		checksumScheme = directory_checksum.GoModuleScheme(goModule)
+	} else if goModule != "" {
+		log.Fatal("The --module flag requires --scheme=go-h1")
+	}
+	if checksumScheme.Name == directory_checksum.IPFSScheme.Name {
+		if hashAlgorithm.Name != directory_checksum.SHA256.Name {
+			log.Fatal("The ipfs scheme requires the sha256 algorithm")
+		}
+		if ipfsChunkSize < 1 {
+			log.Fatal("ipfs-chunk-size argument must be 1 or larger")
+		}
+		checksumScheme = directory_checksum.IPFSSchemeWithChunkSize(ipfsChunkSize)
+	}
+	if checksumScheme.Name == directory_checksum.FsVerityScheme.Name {
+		if hashAlgorithm.Name != directory_checksum.SHA256.Name && hashAlgorithm.Name != directory_checksum.SHA512.Name {
+			log.Fatal("The fsverity scheme requires the sha256 or sha512 algorithm")
+		}
+		salt, err := hex.DecodeString(fsVeritySalt)
+		if err != nil || len(salt) > directory_checksum.FsVerityMaxSaltSize {
+			log.Fatalf("Invalid fsverity-salt '%s': must be at most %d bytes in hexadecimal notation", fsVeritySalt,
+				directory_checksum.FsVerityMaxSaltSize)
+		}
+		checksumScheme = directory_checksum.FsVeritySchemeWithSalt(salt)
+	} else if fsVeritySalt != "" {
+		log.Fatal("The --fsverity-salt flag requires --scheme=fsverity")
+	}
+	if checksumScheme.Name == directory_checksum.BuildKitScheme.Name {
+		if hashAlgorithm.Name != directory_checksum.SHA256.Name {
+			log.Fatal("The buildkit scheme requires the sha256 algorithm")
+		}
+		if buildKitSource != "" && output.format != "text" {
+			log.Fatal("The --buildkit-source flag requires --format=text")
+		}
+	} else if buildKitSource != "" {
+		log.Fatal("The --buildkit-source flag requires --scheme=buildkit")
+	}
+	if (buildKitIncludePatterns != "" || buildKitExcludePatterns != "") && buildKitSource == "" {
+		log.Fatal("The --buildkit-include and --buildkit-exclude flags require --buildkit-source")
+	}
+	if output.format == "fsverity" && checksumScheme.Name != directory_checksum.FsVerityScheme.Name {
+		log.Fatal("--format=fsverity requires --scheme=fsverity")
+	}
+	if output.format == "gosum" && (checksumScheme.Name != directory_checksum.GoH1Scheme.Name || goModule == "") {
+		log.Fatal("--format=gosum requires --scheme=go-h1 and --module")
+	}
 
 	root := flag.Arg(0)
-	directory, err := directory_checksum.ScanDirectory(root, afero.NewOsFs())
-	if err != nil {
-		if errorWithStacktrace, ok := err.(*errors.Error); ok {
-			fmt.Println("Unable to scan the directory:")
-			fmt.Println(errorWithStacktrace.ErrorStack())
-		} else {
-			fmt.Printf("Unable to scan the directory: %v\n", err)
+	if archivePath != "" && !isImage && !isArchiveRoot(root) {
+		log.Fatal("The --archive-path flag requires --image, or that <path> is an archive")
+	}
+	if isImage && root == stdinRoot {
+		log.Fatal("The --image flag requires the path of an image, it cannot be read from stdin")
+	}
+	if (imagePlatform != "" || imageReference != "") && !isImage {
+		log.Fatal("The --platform and --image-ref flags require --image")
+	}
+	scanOptions := []directory_checksum.ScanOption{directory_checksum.WithHasher(hashAlgorithm),
+		directory_checksum.WithScheme(checksumScheme)}
+	if checksumScheme.Name == directory_checksum.GitScheme.Name {
+		if hashAlgorithm.Name != directory_checksum.SHA1.Name && hashAlgorithm.Name != directory_checksum.SHA256.Name {
+			log.Fatal("The git scheme requires the sha1 or sha256 algorithm")
 		}
-		os.Exit(1)
+		// git never tracks its own directory, so there is no need to scan it
+		scanOptions = append(scanOptions, directory_checksum.WithFilter(func(_ string, info fs.FileInfo) bool {
+			return info.Name() != ".git"
+		}))
+	}
+	if checksumScheme.Name == directory_checksum.IPFSScheme.Name && !includeHidden {
+		// like "ipfs add -r", skip hidden files and directories by default
+		scanOptions = append(scanOptions, directory_checksum.WithFilter(func(_ string, info fs.FileInfo) bool {
+			return !strings.HasPrefix(info.Name(), ".")
+		}))
+	}
+	var extraHashers []directory_checksum.HashAlgorithm
+	for _, digestAlgorithm := range formatDigestAlgorithms(output.format, hashAlgorithm) {
+		if digestAlgorithm.Name != hashAlgorithm.Name || checksumScheme.Name != directory_checksum.DefaultScheme.Name {
+			extraHashers = append(extraHashers, digestAlgorithm)
+		}
+	}
+	scanOptions = append(scanOptions, directory_checksum.WithExtraHashers(extraHashers...))
+	directory, scannedFS, err := scanRoot(root, scanOptions...)
+	if err != nil {
+		exitWithError("Unable to scan the directory", err)
 	}
 	_, err = directory.ComputeDirectoryChecksums()
 	if err != nil {
-		if errorWithStacktrace, ok := err.(*errors.Error); ok {
-			fmt.Println("Unexpected error while computing directory checksum:")
-			fmt.Println(errorWithStacktrace.ErrorStack())
+		exitWithError("Unexpected error while computing directory checksums", err)
+	}
+	if narOutputPath != "" {
+		writeNAR(directory, narOutputPath)
+	}
+	output.name = scannedName(root)
+	output.fsys = scannedFS
+	printDirectory(directory, output)
+}
+
+// formatDigestAlgorithms returns the hash algorithms whose plain file digests the provided output format requires,
+// given the hashAlgorithm that is used for the checksums.
+func formatDigestAlgorithms(format string,
+	hashAlgorithm directory_checksum.HashAlgorithm) []directory_checksum.HashAlgorithm {
+	switch format {
+	case "spdx-json", "cyclonedx-json":
+		return []directory_checksum.HashAlgorithm{directory_checksum.SHA1, directory_checksum.SHA256}
+	case "mtree", "in-toto":
+		return []directory_checksum.HashAlgorithm{directory_checksum.SHA256}
+	case "coreutils":
+		return []directory_checksum.HashAlgorithm{hashAlgorithm}
+	case "sri":
+		return parseSRIAlgorithms(sriAlgorithms)
+	default:
+		return nil
+	}
+}
+
+// parseSRIAlgorithms returns the hash algorithms of the comma-separated list of names, exiting the program if one of
+// them is not supported by Subresource Integrity.
+func parseSRIAlgorithms(names string) []directory_checksum.HashAlgorithm {
+	var algorithms []directory_checksum.HashAlgorithm
+	for _, name := range strings.Split(names, ",") {
+		algorithm, ok := directory_checksum.HashAlgorithmByName(strings.TrimSpace(name))
+		if !ok || !directory_checksum.IsSRIAlgorithm(algorithm) {
+			log.Fatalf("Unsupported SRI algorithm '%s'", name)
+		}
+		algorithms = append(algorithms, algorithm)
+	}
+	return algorithms
+}
+
+// sourceDateEpoch returns the time stored in the SOURCE_DATE_EPOCH environment variable (see
+// https://reproducible-builds.org/specs/source-date-epoch/). The second return value is false if it is not set.
+func sourceDateEpoch() (time.Time, bool) {
+	value, ok := os.LookupEnv("SOURCE_DATE_EPOCH")
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Fatalf("Invalid SOURCE_DATE_EPOCH '%s'", value)
+	}
+	return time.Unix(seconds, 0), true
+}
+
+// sbomCreationTime returns the time stored in the SOURCE_DATE_EPOCH environment variable, or the current time if it is
+// not set.
+func sbomCreationTime() time.Time {
+	if creationTime, ok := sourceDateEpoch(); ok {
+		return creationTime
+	}
+	return time.Now()
+}
+
+// printDirectory prints the checksums of directory to stdout, as configured by options.
+func printDirectory(directory *directory_checksum.Directory, options outputOptions) {
+	switch options.format {
+	case "text":
+		if scheme == directory_checksum.IPFSScheme.Name {
+			printListing(directory, options.maxDepth, directory_checksum.FormatCID)
+		} else if scheme == directory_checksum.BuildKitScheme.Name {
+			printBuildKitChecksums(directory, options.maxDepth)
 		} else {
-			fmt.Printf("Unexpected error while computing directory checksums: %v\n", err)
+			fmt.Print(directory.PrintChecksums(options.maxDepth))
 		}
-		os.Exit(1)
+	case "manifest":
+		if err := directory.WriteManifest(os.Stdout); err != nil {
+			exitWithError("Unable to write the manifest", err)
+		}
+	case "nix":
+		printNixHashes(directory, options.maxDepth)
+	case "gosum":
+		printGoSumLines(directory, options.fsys, goModule)
+	case "fsverity":
+		printFsVerityDigests(directory)
+	case "sri":
+		sriMap, err := directory.SRIMap(parseSRIAlgorithms(sriAlgorithms)...)
+		if err != nil {
+			exitWithError("Unable to create the SRI map", err)
+		}
+		printJSON(sriMap)
+	case "coreutils":
+		if err := directory.WriteChecksumList(os.Stdout, options.tag); err != nil {
+			exitWithError("Unable to write the checksum list", err)
+		}
+	case "mtree":
+		if err := directory.WriteMtree(os.Stdout); err != nil {
+			exitWithError("Unable to write the mtree specification", err)
+		}
+	case "in-toto":
+		statement, err := directory.InTotoStatement()
+		if err != nil {
+			exitWithError("Unable to create the in-toto statement", err)
+		}
+		if options.dsse {
+			envelope, err := directory_checksum.NewDSSEEnvelope(statement)
+			if err != nil {
+				exitWithError("Unable to create the DSSE envelope", err)
+			}
+			printJSON(envelope)
+		} else {
+			printJSON(statement)
+		}
+	case "spdx-json":
+		document, err := directory.SPDXDocument(options.name, sbomCreationTime())
+		if err != nil {
+			exitWithError("Unable to create the SPDX document", err)
+		}
+		printJSON(document)
+	case "cyclonedx-json":
+		bom, err := directory.CycloneDXBOM(options.name, sbomCreationTime())
+		if err != nil {
+			exitWithError("Unable to create the CycloneDX BOM", err)
+		}
+		printJSON(bom)
+	default:
+		log.Fatalf("Unsupported format '%s'", options.format)
+	}
+}
+
+// printNixHashes prints the listing of directory up to maxDepth, with each checksum encoded in the SRI format (e.g.
+// "sha256-<base64>") and in Nix's base-32 encoding, as printed by "nix hash path" and "nix hash path --base32".
+func printNixHashes(directory *directory_checksum.Directory, maxDepth int) {
+	algorithmName := directory.Algorithm().Name
+	printListing(directory, maxDepth, func(hexChecksum string) (string, error) {
+		checksum, err := hex.DecodeString(hexChecksum)
+		if err != nil {
+			return "", errors.Wrap(err, 0)
+		}
+		return fmt.Sprintf("%s-%s %s", algorithmName, base64.StdEncoding.EncodeToString(checksum),
+			directory_checksum.EncodeNixBase32(checksum)), nil
+	})
+}
+
+// printFsVerityDigests prints the digest of every regular file of directory, in the format of "fsverity digest":
+// "<algorithm>:<digest> <path>".
+func printFsVerityDigests(directory *directory_checksum.Directory) {
+	for relativePath, entry := range directory.PreOrder() {
+		if entry.Type() == directory_checksum.TypeFile {
+			fmt.Printf("%s:%s %s\n", directory.Algorithm().Name, entry.Checksum(), relativePath)
+		}
+	}
+}
+
+// printListing prints the listing of directory up to maxDepth, like PrintChecksums() does, but with each checksum
+// converted by formatChecksum.
+func printListing(directory *directory_checksum.Directory, maxDepth int,
+	formatChecksum func(checksum string) (string, error)) {
+	err := directory.Walk(func(relativePath string, entry directory_checksum.Entry) error {
+		checksum, err := formatChecksum(entry.Checksum())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s %s %s\n", checksum, entry.Type().Letter(), relativePath)
+		depth := 0
+		if relativePath != "." {
+			depth = strings.Count(relativePath, string(os.PathSeparator)) + 1
+		}
+		if entry.Type() == directory_checksum.TypeDir && depth >= maxDepth {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		exitWithError("Unable to print the checksums", err)
+	}
+}
+
+// printBuildKitChecksums prints the listing of directory up to maxDepth with the checksums in BuildKit's notation, or
+// only the checksum of the --buildkit-source path, if it is set.
+func printBuildKitChecksums(directory *directory_checksum.Directory, maxDepth int) {
+	if buildKitSource == "" {
+		printListing(directory, maxDepth, func(checksum string) (string, error) {
+			return directory_checksum.FormatBuildKitDigest(checksum), nil
+		})
+		return
+	}
+	checksum, err := directory.BuildKitChecksum(buildKitSource, splitPatterns(buildKitIncludePatterns),
+		splitPatterns(buildKitExcludePatterns))
+	if err != nil {
+		exitWithError("Unable to compute the BuildKit checksum", err)
+	}
+	fmt.Printf("%s %s\n", checksum, buildKitSource)
+}
+
+// splitPatterns returns the patterns of the comma-separated list, which is empty if patterns is empty.
+func splitPatterns(patterns string) []string {
+	if patterns == "" {
+		return nil
+	}
+	return strings.Split(patterns, ",")
+}
+
+// writeNAR writes the Nix Archive serialization of directory to the file at path.
+func writeNAR(directory *directory_checksum.Directory, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to create %s", path), err)
+	}
+	bufferedWriter := bufio.NewWriter(f)
+	if err = directory.WriteNAR(bufferedWriter); err == nil {
+		err = bufferedWriter.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to write the NAR serialization to %s", path), err)
+	}
+}
+
+// printJSON prints v to stdout as indented JSON.
+func printJSON(v any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		exitWithError("Unable to print JSON", err)
+	}
+}
+
+// exitWithError prints the message and err (including its stack trace, if available) and exits the program.
+func exitWithError(message string, err error) {
+	if errorWithStacktrace, ok := err.(*errors.Error); ok {
+		fmt.Printf("%s:\n", message)
+		fmt.Println(errorWithStacktrace.ErrorStack())
+	} else {
+		fmt.Printf("%s: %v\n", message, err)
 	}
-	output := directory.PrintChecksums(maxDepth)
-	fmt.Print(output)
+	os.Exit(1)
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runMainEnv is the environment variable that makes the test binary run main() instead of the tests, see runCLI.
+const runMainEnv = "DIRECTORY_CHECKSUM_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCLI runs the tool with the provided arguments (in a separate process, because it exits on errors), and returns
+// its output. The test fails if the tool exits with an error.
+func runCLI(t *testing.T, arguments ...string) string {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], arguments...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Running the tool with %v failed: %v\n%s", arguments, err, output)
+	}
+	return string(output)
+}
+
+func TestExtraDigestsWithNonDefaultAlgorithm(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "f"), []byte("foo"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sha1Digest := sha1.Sum([]byte("foo"))
+	sha256Digest := sha256.Sum256([]byte("foo"))
+	sha512Digest := sha512.Sum512([]byte("foo"))
+
+	for _, arguments := range [][]string{
+		{"--algorithm", "md5", "--format", "spdx-json"},
+		{"--algorithm", "sha512", "--format", "spdx-json"},
+		{"--algorithm", "sha512", "--format", "cyclonedx-json"},
+	} {
+		output := runCLI(t, append(arguments, dir)...)
+		for _, digest := range [][]byte{sha1Digest[:], sha256Digest[:]} {
+			if !strings.Contains(output, hex.EncodeToString(digest)) {
+				t.Fatalf("The output of %v does not contain the digest %x:\n%s", arguments, digest, output)
+			}
+		}
+	}
+
+	output := runCLI(t, "--algorithm", "sha512", "--format", "coreutils", dir)
+	if want := hex.EncodeToString(sha512Digest[:]) + "  f\n"; output != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", output, want)
+	}
+}
+
+func TestGoSumLinesOfArchive(t *testing.T) {
+	files := map[string]string{"go.mod": "module example.com/m\n", "m.go": "package m\n"}
+	dir := t.TempDir()
+	archive := bytes.Buffer{}
+	tarWriter := tar.NewWriter(&archive)
+	for _, name := range []string{"go.mod", "m.go"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(files[name]), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		tarWriter.WriteHeader(&tar.Header{Name: "m/" + name, Mode: 0644, Size: int64(len(files[name]))})
+		tarWriter.Write([]byte(files[name]))
+	}
+	tarWriter.Close()
+	archivePath := filepath.Join(t.TempDir(), "m.tar")
+	if err := os.WriteFile(archivePath, archive.Bytes(), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	arguments := []string{"--scheme", "go-h1", "--module", "example.com/m@v1.0.0", "--format", "gosum"}
+	want := runCLI(t, append(arguments, dir)...)
+	if !strings.Contains(want, "example.com/m v1.0.0/go.mod h1:") {
+		t.Fatalf("The output does not contain the go.mod line:\n%s", want)
+	}
+	if got := runCLI(t, append(arguments, "--archive-path", "m", archivePath)...); got != want {
+		t.Fatalf("Got\n%s\n\nwant\n%s", got, want)
+	}
+}
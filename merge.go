@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/MShekow/directory-checksum/directory_checksum"
+	"log"
+	"os"
+	"strings"
+)
+
+// runMerge implements the "merge" subcommand, which grafts subtree manifests into a parent tree and prints the
+// checksums of the combined tree.
+func runMerge(arguments []string) {
+	flagSet := flag.NewFlagSet("merge", flag.ExitOnError)
+	flagSet.SetOutput(os.Stdout)
+	var mergeOutput outputOptions
+	registerOutputFlags(flagSet, &mergeOutput)
+	parentManifestPath := flagSet.String("parent", "", "Path to the manifest of the parent tree. If omitted, "+
+		"the parent tree is empty")
+	flagSet.StringVar(&mergeOutput.name, "name", "merged", "Name of the merged tree, which names the package or "+
+		"component of SBOMs")
+	flagSet.Usage = func() {
+		fmt.Printf("Usage of Directory Checksum Tool %s:\n\n", version)
+		fmt.Println("directory-checksum merge [--max-depth=N] [--format=F] [--parent=<manifest>] [--name=N] " +
+			"<relative-path>=<manifest> ...")
+		fmt.Println("\nGrafts each subtree manifest at the given relative path into the parent tree and prints the " +
+			"checksums\nof the combined tree, which are identical to scanning the combined tree at once.")
+		flagSet.PrintDefaults()
+		os.Exit(1)
+	}
+	_ = flagSet.Parse(arguments)
+
+	if flagSet.NArg() == 0 {
+		log.Fatal("You must provide at least one argument of the form <relative-path>=<manifest>")
+	}
+	if mergeOutput.maxDepth < 0 {
+		log.Fatal("max-depth argument must be 0 or larger")
+	}
+
+	var directory *directory_checksum.Directory
+	if *parentManifestPath != "" {
+		directory = readManifestFile(*parentManifestPath)
+	}
+	for _, argument := range flagSet.Args() {
+		relativePath, manifestPath, found := strings.Cut(argument, "=")
+		if !found || relativePath == "" || manifestPath == "" {
+			log.Fatalf("Invalid argument '%s', expected <relative-path>=<manifest>", argument)
+		}
+		subtree := readManifestFile(manifestPath)
+		if directory == nil {
+			var err error
+			directory, err = directory_checksum.NewTree(directory_checksum.WithHasher(subtree.Algorithm())).Build()
+			if err != nil {
+				exitWithError("Unable to create the parent tree", err)
+			}
+		}
+		if err := directory.Graft(relativePath, subtree); err != nil {
+			exitWithError(fmt.Sprintf("Unable to merge manifest %s", manifestPath), err)
+		}
+	}
+
+	if _, err := directory.ComputeDirectoryChecksums(); err != nil {
+		exitWithError("Unexpected error while computing directory checksums", err)
+	}
+	printDirectory(directory, mergeOutput)
+}
+
+// readManifestFile reads the manifest file located at path, exiting the program on failure.
+func readManifestFile(path string) *directory_checksum.Directory {
+	f, err := os.Open(path)
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to open manifest %s", path), err)
+	}
+	defer f.Close()
+	directory, err := directory_checksum.ReadManifest(f)
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to read manifest %s", path), err)
+	}
+	return directory
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/MShekow/directory-checksum/directory_checksum"
+	"github.com/spf13/afero"
+	"io"
+	"log"
+	"os"
+)
+
+// runProve implements the "prove" subcommand, which prints an inclusion proof (as JSON) for one file or directory.
+func runProve(arguments []string) {
+	flagSet := flag.NewFlagSet("prove", flag.ExitOnError)
+	flagSet.SetOutput(os.Stdout)
+	proveAlgorithm := flagSet.String("algorithm", directory_checksum.SHA1.Name, algorithmUsage)
+	flagSet.Usage = func() {
+		fmt.Printf("Usage of Directory Checksum Tool %s:\n\n", version)
+		fmt.Println("directory-checksum prove [--algorithm=A] <path> <relative-path>")
+		fmt.Println("\nPrints a proof that the file or directory at <relative-path> is part of the directory at " +
+			"<path>,\nwhich can be checked with verify-proof against just the root checksum.")
+		flagSet.PrintDefaults()
+		os.Exit(1)
+	}
+	_ = flagSet.Parse(arguments)
+
+	if flagSet.NArg() != 2 {
+		log.Fatal("You must provide exactly two arguments: the path to the directory to be scanned, and the " +
+			"relative path of the file or directory to be proven")
+	}
+	hashAlgorithm, ok := directory_checksum.HashAlgorithmByName(*proveAlgorithm)
+	if !ok {
+		log.Fatalf("Unsupported algorithm '%s'", *proveAlgorithm)
+	}
+
+	directory, err := directory_checksum.ScanDirectory(flagSet.Arg(0), afero.NewOsFs(),
+		directory_checksum.WithHasher(hashAlgorithm))
+	if err != nil {
+		exitWithError("Unable to scan the directory", err)
+	}
+	proof, err := directory.Prove(flagSet.Arg(1))
+	if err != nil {
+		exitWithError("Unable to create the proof", err)
+	}
+	printJSON(proof)
+}
+
+// runVerifyProof implements the "verify-proof" subcommand, which checks an inclusion proof against a root checksum.
+func runVerifyProof(arguments []string) {
+	flagSet := flag.NewFlagSet("verify-proof", flag.ExitOnError)
+	flagSet.SetOutput(os.Stdout)
+	flagSet.Usage = func() {
+		fmt.Printf("Usage of Directory Checksum Tool %s:\n\n", version)
+		fmt.Println("directory-checksum verify-proof <proof-file> <root-checksum>")
+		fmt.Println("\nChecks a proof created by the prove command. Use '-' as <proof-file> to read it from stdin.")
+		flagSet.PrintDefaults()
+		os.Exit(1)
+	}
+	_ = flagSet.Parse(arguments)
+
+	if flagSet.NArg() != 2 {
+		log.Fatal("You must provide exactly two arguments: the path to the proof file, and the root checksum")
+	}
+
+	var proofReader io.Reader = os.Stdin
+	if flagSet.Arg(0) != "-" {
+		f, err := os.Open(flagSet.Arg(0))
+		if err != nil {
+			exitWithError("Unable to open the proof", err)
+		}
+		defer f.Close()
+		proofReader = f
+	}
+	var proof directory_checksum.InclusionProof
+	if err := json.NewDecoder(proofReader).Decode(&proof); err != nil {
+		exitWithError("Unable to read the proof", err)
+	}
+	if err := proof.Verify(flagSet.Arg(1)); err != nil {
+		fmt.Printf("The proof is INVALID: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("The proof is valid: %s %s %s is part of the directory with checksum %s\n", proof.Checksum,
+		proof.Type, proof.Path, flagSet.Arg(1))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/MShekow/directory-checksum/directory_checksum"
+	"log"
+	"os"
+)
+
+// runSign implements the "sign" subcommand, which prints a detached signature of a manifest.
+func runSign(arguments []string) {
+	flagSet := flag.NewFlagSet("sign", flag.ExitOnError)
+	flagSet.SetOutput(os.Stdout)
+	keyPath := flagSet.String("key", "", "Path to the private key: an OpenSSH private key, or a raw Ed25519 key "+
+		"(PKCS#8 PEM, or base64-encoded)")
+	namespace := flagSet.String("namespace", directory_checksum.DefaultSignatureNamespace, "Namespace of SSH "+
+		"signatures (as in 'ssh-keygen -Y sign -n')")
+	outputPath := flagSet.String("output", "", "Path of the signature file to write. If omitted, the signature "+
+		"is printed to stdout")
+	flagSet.Usage = func() {
+		fmt.Printf("Usage of Directory Checksum Tool %s:\n\n", version)
+		fmt.Println("directory-checksum sign --key=<private-key> [--namespace=N] [--output=<file>] <manifest>")
+		fmt.Println("\nCreates a detached signature of the canonical form of the manifest.")
+		flagSet.PrintDefaults()
+		os.Exit(1)
+	}
+	_ = flagSet.Parse(arguments)
+
+	if flagSet.NArg() != 1 || *keyPath == "" {
+		log.Fatal("You must provide the --key flag and exactly one argument: the path to the manifest")
+	}
+
+	privateKey, err := os.ReadFile(*keyPath)
+	if err != nil {
+		exitWithError("Unable to read the private key", err)
+	}
+	signature, err := directory_checksum.SignManifest(readCanonicalManifest(flagSet.Arg(0)), privateKey, *namespace)
+	if err != nil {
+		exitWithError("Unable to sign the manifest", err)
+	}
+
+	if *outputPath == "" {
+		fmt.Print(string(signature))
+	} else if err := os.WriteFile(*outputPath, signature, 0644); err != nil {
+		exitWithError("Unable to write the signature", err)
+	}
+}
+
+// runVerifySignature implements the "verify-signature" subcommand, which checks a detached signature of a manifest.
+func runVerifySignature(arguments []string) {
+	flagSet := flag.NewFlagSet("verify-signature", flag.ExitOnError)
+	flagSet.SetOutput(os.Stdout)
+	publicKeyPath := flagSet.String("public-key", "", "Path to the public key: in authorized_keys format for SSH "+
+		"signatures, otherwise a raw Ed25519 key (PKIX PEM, or base64-encoded)")
+	namespace := flagSet.String("namespace", directory_checksum.DefaultSignatureNamespace, "Namespace of SSH "+
+		"signatures (as in 'ssh-keygen -Y verify -n')")
+	flagSet.Usage = func() {
+		fmt.Printf("Usage of Directory Checksum Tool %s:\n\n", version)
+		fmt.Println("directory-checksum verify-signature --public-key=<public-key> [--namespace=N] <manifest> " +
+			"<signature>")
+		flagSet.PrintDefaults()
+		os.Exit(1)
+	}
+	_ = flagSet.Parse(arguments)
+
+	if flagSet.NArg() != 2 || *publicKeyPath == "" {
+		log.Fatal("You must provide the --public-key flag and exactly two arguments: the paths to the manifest and " +
+			"to the signature")
+	}
+
+	verifySignatureOrExit(readCanonicalManifest(flagSet.Arg(0)), flagSet.Arg(1), *publicKeyPath, *namespace)
+	fmt.Println("The signature is valid")
+}
+
+// verifySignatureOrExit verifies the signature stored at signaturePath, exiting the program if it is invalid.
+func verifySignatureOrExit(canonicalManifest []byte, signaturePath string, publicKeyPath string, namespace string) {
+	signature, err := os.ReadFile(signaturePath)
+	if err != nil {
+		exitWithError("Unable to read the signature", err)
+	}
+	publicKey, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		exitWithError("Unable to read the public key", err)
+	}
+	err = directory_checksum.VerifyManifestSignature(canonicalManifest, signature, publicKey, namespace)
+	if err != nil {
+		fmt.Printf("The signature is INVALID: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// readCanonicalManifest reads the manifest file located at path and returns its canonical form, exiting the program
+// on failure.
+func readCanonicalManifest(path string) []byte {
+	f, err := os.Open(path)
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to open manifest %s", path), err)
+	}
+	defer f.Close()
+	canonicalManifest, err := directory_checksum.CanonicalManifest(f)
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to read manifest %s", path), err)
+	}
+	return canonicalManifest
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/MShekow/directory-checksum/directory_checksum"
+	"github.com/spf13/afero"
+	"log"
+	"os"
+)
+
+// runVerify implements the "verify" subcommand, which checks a directory against a manifest or a checksum list.
+func runVerify(arguments []string) {
+	flagSet := flag.NewFlagSet("verify", flag.ExitOnError)
+	flagSet.SetOutput(os.Stdout)
+	signaturePath := flagSet.String("signature", "", "Path to a detached signature of the manifest. If provided, "+
+		"the signature must be valid before the manifest is trusted")
+	publicKeyPath := flagSet.String("public-key", "", "Path to the public key that verifies --signature")
+	namespace := flagSet.String("namespace", directory_checksum.DefaultSignatureNamespace, "Namespace of SSH "+
+		"signatures")
+	flagSet.Usage = func() {
+		fmt.Printf("Usage of Directory Checksum Tool %s:\n\n", version)
+		fmt.Println("directory-checksum verify [--signature=<file> --public-key=<file>] <manifest> <path>")
+		fmt.Println("\nScans the directory at <path> and reports every file or directory that differs from the " +
+			"manifest.\nInstead of a manifest, a checksum list in the format of sha256sum (or sha1sum, md5sum, ...) " +
+			"may be\nprovided. Then, only regular files are verified, but unlike 'sha256sum -c', files that are " +
+			"missing\nfrom the list are reported as well. An mtree specification may also be provided, in which " +
+			"case\nthe differences are reported per mtree keyword.")
+		flagSet.PrintDefaults()
+		os.Exit(1)
+	}
+	_ = flagSet.Parse(arguments)
+
+	if flagSet.NArg() != 2 {
+		log.Fatal("You must provide exactly two arguments: the path to the manifest (or checksum list), and the path " +
+			"to the directory to be verified")
+	}
+	if (*signaturePath == "") != (*publicKeyPath == "") {
+		log.Fatal("The --signature and --public-key flags must be provided together")
+	}
+
+	manifestPath := flagSet.Arg(0)
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to read %s", manifestPath), err)
+	}
+	if *signaturePath != "" && !directory_checksum.IsManifest(data) {
+		log.Fatal("The --signature flag is only supported for manifests")
+	}
+	if !directory_checksum.IsManifest(data) && directory_checksum.IsMtree(data) {
+		verifyMtree(data, manifestPath, flagSet.Arg(1))
+		return
+	}
+
+	var expected *directory_checksum.Directory
+	isChecksumList := !directory_checksum.IsManifest(data)
+	if isChecksumList {
+		expected, err = directory_checksum.ReadChecksumList(bytes.NewReader(data))
+		if err != nil {
+			exitWithError(fmt.Sprintf("Unable to read checksum list %s", manifestPath), err)
+		}
+	} else {
+		canonicalManifest, err := directory_checksum.CanonicalManifest(bytes.NewReader(data))
+		if err != nil {
+			exitWithError(fmt.Sprintf("Unable to read manifest %s", manifestPath), err)
+		}
+		if *signaturePath != "" {
+			verifySignatureOrExit(canonicalManifest, *signaturePath, *publicKeyPath, *namespace)
+		}
+		expected, err = directory_checksum.ReadManifest(bytes.NewReader(canonicalManifest))
+		if err != nil {
+			exitWithError("Unable to read the manifest", err)
+		}
+	}
+
+	actual, err := directory_checksum.ScanDirectory(flagSet.Arg(1), afero.NewOsFs(),
+		directory_checksum.WithHasher(expected.Algorithm()))
+	if err != nil {
+		exitWithError("Unable to scan the directory", err)
+	}
+	if isChecksumList {
+		// checksum lists can only describe regular files
+		actual = actual.RegularFilesOnly()
+	}
+	if _, err = actual.ComputeDirectoryChecksums(); err != nil {
+		exitWithError("Unexpected error while computing directory checksums", err)
+	}
+
+	differences := directory_checksum.Compare(expected, actual)
+	for _, difference := range differences {
+		fmt.Println(difference)
+	}
+	if len(differences) > 0 {
+		fmt.Printf("Verification FAILED: found %d differences\n", len(differences))
+		os.Exit(1)
+	}
+	if isChecksumList {
+		fmt.Println("Verification succeeded: the directory matches the checksum list")
+	} else {
+		fmt.Printf("Verification succeeded: the directory matches the manifest (checksum %s)\n", actual.Checksum())
+	}
+}
+
+// verifyMtree checks the directory at path against the mtree specification contained in data (read from specPath),
+// and exits the program with a non-zero code if they differ.
+func verifyMtree(data []byte, specPath string, path string) {
+	spec, err := directory_checksum.ReadMtree(bytes.NewReader(data))
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to read mtree specification %s", specPath), err)
+	}
+
+	scanOptions := []directory_checksum.ScanOption{}
+	if algorithms := spec.HashAlgorithms(); len(algorithms) > 0 {
+		scanOptions = append(scanOptions, directory_checksum.WithHasher(algorithms[0]),
+			directory_checksum.WithExtraHashers(algorithms[1:]...))
+	}
+	actual, err := directory_checksum.ScanDirectory(path, afero.NewOsFs(), scanOptions...)
+	if err != nil {
+		exitWithError("Unable to scan the directory", err)
+	}
+
+	differences, err := spec.Verify(actual)
+	if err != nil {
+		exitWithError("Unable to verify the directory", err)
+	}
+	for _, difference := range differences {
+		fmt.Println(difference)
+	}
+	if len(differences) > 0 {
+		fmt.Printf("Verification FAILED: found %d differences\n", len(differences))
+		os.Exit(1)
+	}
+	fmt.Println("Verification succeeded: the directory matches the mtree specification")
+}
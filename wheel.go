@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/MShekow/directory-checksum/directory_checksum"
+	"github.com/spf13/afero"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// distInfoRecords returns the slash-separated paths (relative to root) of the RECORD files of all ".dist-info"
+// directories in root, which is an unpacked wheel or a site-packages directory.
+func distInfoRecords(root string) []string {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to read %s", root), err)
+	}
+	var recordPaths []string
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasSuffix(entry.Name(), ".dist-info") {
+			continue
+		}
+		if _, err = os.Stat(filepath.Join(root, entry.Name(), "RECORD")); err == nil {
+			recordPaths = append(recordPaths, path.Join(entry.Name(), "RECORD"))
+		}
+	}
+	if len(recordPaths) == 0 {
+		log.Fatalf("'%s' is neither an unpacked wheel nor a site-packages directory: no .dist-info/RECORD file was "+
+			"found", root)
+	}
+	return recordPaths
+}
+
+// readWheelRecord reads the RECORD file at recordPath (relative to root), and returns its parsed and its raw content.
+func readWheelRecord(root string, recordPath string) (*directory_checksum.WheelRecord, []byte) {
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(recordPath)))
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to read %s", recordPath), err)
+	}
+	record, err := directory_checksum.ReadWheelRecord(bytes.NewReader(data))
+	if err != nil {
+		exitWithError(fmt.Sprintf("Unable to read %s", recordPath), err)
+	}
+	return record, data
+}
+
+// scanWheel scans the directory at root with SHA256 digests, and the digests of the provided extra algorithms.
+func scanWheel(root string, algorithms []directory_checksum.HashAlgorithm) *directory_checksum.Directory {
+	var extraAlgorithms []directory_checksum.HashAlgorithm
+	for _, algorithm := range algorithms {
+		if algorithm.Name != directory_checksum.SHA256.Name {
+			extraAlgorithms = append(extraAlgorithms, algorithm)
+		}
+	}
+	directory, err := directory_checksum.ScanDirectory(root, afero.NewOsFs(),
+		directory_checksum.WithHasher(directory_checksum.SHA256),
+		directory_checksum.WithExtraHashers(extraAlgorithms...))
+	if err != nil {
+		exitWithError("Unable to scan the directory", err)
+	}
+	return directory
+}
+
+// runVerifyRecord implements the "verify-record" subcommand, which checks an unpacked wheel or a site-packages
+// directory against the RECORD files of its distributions.
+func runVerifyRecord(arguments []string) {
+	flagSet := flag.NewFlagSet("verify-record", flag.ExitOnError)
+	flagSet.SetOutput(os.Stdout)
+	flagSet.Usage = func() {
+		fmt.Printf("Usage of Directory Checksum Tool %s:\n\n", version)
+		fmt.Println("directory-checksum verify-record <wheel-or-site-packages-dir>")
+		fmt.Println("\nChecks the files of an unpacked Python wheel, or of a site-packages directory, against the " +
+			"RECORD\nfiles of its .dist-info directories, and reports every file whose hash or size differs, that " +
+			"is\nmissing ('removed'), or that is not listed in any RECORD file ('added'). Files that were " +
+			"installed\noutside of the directory (e.g. scripts in ../../../bin) are not verified.")
+		flagSet.PrintDefaults()
+		os.Exit(1)
+	}
+	_ = flagSet.Parse(arguments)
+
+	if flagSet.NArg() != 1 {
+		log.Fatal("You must provide exactly one argument: the path to an unpacked wheel or a site-packages directory")
+	}
+	root := flagSet.Arg(0)
+
+	recordPaths := distInfoRecords(root)
+	merged := &directory_checksum.WheelRecord{}
+	for _, recordPath := range recordPaths {
+		record, _ := readWheelRecord(root, recordPath)
+		merged.Entries = append(merged.Entries, record.Entries...)
+	}
+	differences, err := merged.Verify(scanWheel(root, merged.HashAlgorithms()))
+	if err != nil {
+		exitWithError("Unable to verify the directory", err)
+	}
+	for _, difference := range differences {
+		fmt.Println(difference)
+	}
+	if len(differences) > 0 {
+		fmt.Printf("Verification FAILED: found %d differences\n", len(differences))
+		os.Exit(1)
+	}
+	fmt.Printf("Verification succeeded: the directory matches %d RECORD files\n", len(recordPaths))
+}
+
+// runUpdateRecord implements the "update-record" subcommand, which regenerates the RECORD files of an unpacked wheel
+// or a site-packages directory after its files were changed.
+func runUpdateRecord(arguments []string) {
+	flagSet := flag.NewFlagSet("update-record", flag.ExitOnError)
+	flagSet.SetOutput(os.Stdout)
+	listedOnly := flagSet.Bool("listed-only", false, "Only update the entries of the files that are already "+
+		"listed, even if the directory contains only one .dist-info directory")
+	flagSet.Usage = func() {
+		fmt.Printf("Usage of Directory Checksum Tool %s:\n\n", version)
+		fmt.Println("directory-checksum update-record [--listed-only] <wheel-or-site-packages-dir>")
+		fmt.Println("\nRewrites the RECORD files of the .dist-info directories of an unpacked Python wheel, or of a " +
+			"site-packages\ndirectory. If there is only one .dist-info directory, the directory is treated as an " +
+			"unpacked wheel,\nand its RECORD lists all of its files. Otherwise, the hash and size of every listed " +
+			"file is updated,\nand entries of files that no longer exist are removed, but new files are not " +
+			"added. Files are only\nwritten if their content changes.")
+		flagSet.PrintDefaults()
+		os.Exit(1)
+	}
+	_ = flagSet.Parse(arguments)
+
+	if flagSet.NArg() != 1 {
+		log.Fatal("You must provide exactly one argument: the path to an unpacked wheel or a site-packages directory")
+	}
+	root := flagSet.Arg(0)
+
+	recordPaths := distInfoRecords(root)
+	records := map[string]*directory_checksum.WheelRecord{}
+	oldData := map[string][]byte{}
+	var algorithms []directory_checksum.HashAlgorithm
+	for _, recordPath := range recordPaths {
+		records[recordPath], oldData[recordPath] = readWheelRecord(root, recordPath)
+		algorithms = append(algorithms, records[recordPath].HashAlgorithms()...)
+	}
+	directory := scanWheel(root, algorithms)
+
+	updated := 0
+	for _, recordPath := range recordPaths {
+		var record *directory_checksum.WheelRecord
+		var err error
+		if len(recordPaths) == 1 && !*listedOnly {
+			record, err = directory.WheelRecord(recordPath, records[recordPath])
+		} else {
+			record, err = records[recordPath].Update(directory)
+		}
+		if err != nil {
+			exitWithError(fmt.Sprintf("Unable to update %s", recordPath), err)
+		}
+		data := bytes.Buffer{}
+		if err = record.Write(&data); err != nil {
+			exitWithError("Unable to encode the RECORD", err)
+		}
+		if bytes.Equal(oldData[recordPath], data.Bytes()) {
+			continue
+		}
+		if err = os.WriteFile(filepath.Join(root, filepath.FromSlash(recordPath)), data.Bytes(), 0644); err != nil {
+			exitWithError(fmt.Sprintf("Unable to write %s", recordPath), err)
+		}
+		fmt.Printf("Updated %s\n", recordPath)
+		updated++
+	}
+	fmt.Printf("Updated %d of %d RECORD files\n", updated, len(recordPaths))
+}